@@ -6,15 +6,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/ThraaxSession/Hash/internal/auth"
 	"github.com/ThraaxSession/Hash/internal/config"
 	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
 	"github.com/ThraaxSession/Hash/internal/ha"
 	"github.com/ThraaxSession/Hash/internal/handlers"
 	"github.com/ThraaxSession/Hash/internal/middleware"
+	"github.com/ThraaxSession/Hash/internal/migrations"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/ThraaxSession/Hash/internal/mqtt"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,6 +27,9 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// Existing share links are audited against the share entity policy during migrations
+	migrations.SetShareEntityPolicy(cfg.ShareEntityPolicy, cfg.ShareEntityAllowlist)
+
 	// Initialize database
 	if err := database.Initialize(cfg.DBPath); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -41,14 +49,79 @@ func main() {
 	haClient := ha.NewClient(cfg.HomeAssistantURL, cfg.Token)
 
 	// Create handler
-	handler := handlers.NewHandler(haClient)
+	handler := handlers.NewHandler(haClient, cfg)
+
+	// Background jobs are stopped through this context on shutdown
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	var jobs sync.WaitGroup
+	handler.SetBackgroundJobs(ctx, &jobs)
 
 	// Start refresh timer
-	go startRefreshTimer(handler, cfg.RefreshInterval)
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startRefreshTimer(ctx, handler, cfg.RefreshInterval)
+	}()
+
+	// Start share link sweeper
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startShareSweeper(ctx, handler, cfg.ShareSweepInterval, cfg.SharePurgeDays)
+	}()
+
+	// Start auto-revert scheduler
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startRevertScheduler(ctx, handler, cfg.AutoRevertInterval)
+	}()
+
+	// Start reservation sweeper
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startReservationSweeper(ctx, handler, cfg.ShareSweepInterval, cfg.ReservationNoShow)
+	}()
+
+	// Start sweeper for expired user shares
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startUserShareSweeper(ctx, handler, cfg.ShareSweepInterval)
+	}()
+
+	// Queue outbound webhook deliveries for events and send them in the background
+	events.Subscribe(handler.QueueWebhookDeliveries)
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		startWebhookDispatcher(ctx, handler, cfg.WebhookDeliveryInterval, cfg.WebhookMaxAttempts)
+	}()
+
+	// Bridge entity states and events to MQTT when a broker is configured
+	if cfg.MQTTBrokerURL != "" {
+		mqttClient, err := startMQTTBridge(cfg, handler)
+		if err != nil {
+			log.Fatalf("Failed to connect to MQTT broker: %v", err)
+		}
+		defer mqttClient.Close()
+	}
 
 	// Setup Gin router
 	r := gin.Default()
 
+	// Resolve client IPs ourselves so forwarding headers are only honored from trusted proxies
+	if err := r.SetTrustedProxies(nil); err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
+	clientIP, err := middleware.ClientIPMiddleware(cfg.TrustedProxies, cfg.TrustedProxyHeader)
+	if err != nil {
+		log.Fatalf("Failed to configure trusted proxies: %v", err)
+	}
+	r.Use(clientIP)
+
 	// Serve static files
 	r.Static("/static", "./static")
 	r.LoadHTMLGlob("templates/*")
@@ -70,20 +143,36 @@ func main() {
 		c.HTML(http.StatusOK, "settings.html", nil)
 	})
 
-	r.GET("/share/:id", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "share.html", nil)
-	})
+	r.GET("/share/:id", handler.SharePage)
+
+	// Embeddable share widgets
+	r.GET("/embed/:id", handler.EmbedShareLink)
+	r.GET("/embed/:id/feed", handler.GetShareFeed)
+
+	// Full-screen kiosk view of kiosk share links (e.g. wall tablets)
+	r.GET("/kiosk/:id", handler.KioskPage)
+
+	// Action links (e.g. NFC tags): GET shows a confirmation page, POST performs the action
+	r.GET("/a/:id", handler.ActionLinkPage)
+	r.POST("/a/:id", handler.RunActionLink)
 
 	// API routes
 	api := r.Group("/api")
 	{
 		// Public endpoints
 		api.POST("/login", handler.Login)
-		api.POST("/verify-otp", handler.VerifyOTP)                       // OTP verification during login
-		api.POST("/register", handler.Register)                          // Public registration (only when no admin exists)
-		api.GET("/admin-exists", handler.AdminExists)                    // Check if admin exists
-		api.GET("/shares/:id", handler.GetShareLink)                     // Public share link access
-		api.POST("/shares/:id/trigger/:entityId", handler.TriggerEntity) // Public trigger for triggerable shares
+		api.POST("/verify-otp", handler.VerifyOTP)                                         // OTP verification during login
+		api.POST("/register", handler.Register)                                            // Public registration (only when no admin exists)
+		api.GET("/admin-exists", handler.AdminExists)                                      // Check if admin exists
+		api.GET("/shares/:id", handler.GetShareLink)                                       // Public share link access
+		api.POST("/shares/:id/trigger/:entityId", handler.TriggerEntity)                   // Public trigger for triggerable shares
+		api.POST("/shares/:id/access-requests", handler.RequestShareAccess)                // Request access to a share link requiring approval
+		api.GET("/shares/:id/access-requests/:requestId", handler.GetShareAccessRequest)   // Poll the outcome of an access request
+		api.GET("/shares/:id/actions/:requestId", handler.GetShareActionRequest)           // Poll the outcome of an action waiting for approval
+		api.GET("/shares/:id/actions/:requestId/stream", handler.StreamShareActionRequest) // Stream the outcome (server-sent events)
+		api.POST("/shares/:id/kiosk/heartbeat", handler.KioskHeartbeat)                    // Kiosk device reports it is online
+		api.GET("/oembed", handler.OEmbed)                                                 // oEmbed provider for embeddable share links
+		api.POST("/hooks/:id", handler.ReceiveWebhook)                                     // HMAC-signed inbound webhook
 
 		// Protected endpoints (require authentication)
 		protected := api.Group("")
@@ -93,6 +182,9 @@ func main() {
 			protected.GET("/settings", handler.GetUserSettings)
 			protected.POST("/settings/ha", handler.ConfigureHA)
 			protected.POST("/settings/password", handler.ChangePassword)
+			protected.POST("/settings/notifications", handler.UpdateNotificationSettings)
+			protected.POST("/settings/mqtt-key", handler.CreateMQTTKey)   // Key authorizing MQTT commands (shown once)
+			protected.DELETE("/settings/mqtt-key", handler.DeleteMQTTKey) // Revoke the MQTT key
 
 			// OTP management
 			protected.POST("/otp/setup", handler.SetupOTP)
@@ -107,20 +199,87 @@ func main() {
 			protected.POST("/entities", handler.AddEntity)
 			protected.DELETE("/entities/:id", handler.DeleteEntity)
 			protected.GET("/ha/entities", handler.GetAllHAEntities)
+			protected.POST("/selectors/preview", handler.PreviewSelectors) // Entities currently matching pattern/domain selectors
 
 			// Entity sharing with other users
 			protected.POST("/share-entity", handler.ShareEntityWithUser)
 			protected.GET("/shared-with-me", handler.GetSharedWithMe)
+			protected.POST("/shared-with-me/:id/leave", handler.LeaveSharedEntity)
 			protected.GET("/my-shares", handler.GetMyShares)
 			protected.DELETE("/shared-entity/:id", handler.UnshareEntity)
 			protected.GET("/shared-entity/:entityId/state", handler.GetSharedEntityState)
 			protected.POST("/shared-entity/:entityId/trigger", handler.TriggerSharedEntity)
 
+			// Invitations to entities shared with the user
+			protected.GET("/share-invitations", handler.ListShareInvitations)
+			protected.POST("/share-invitations/:id/accept", handler.AcceptShareInvitation)
+			protected.POST("/share-invitations/:id/decline", handler.DeclineShareInvitation)
+
+			// Groups of users to share entities with
+			protected.GET("/groups", handler.ListGroups)
+			protected.POST("/groups", handler.CreateGroup)
+			protected.PUT("/groups/:id", handler.UpdateGroup)
+			protected.DELETE("/groups/:id", handler.DeleteGroup)
+			protected.POST("/groups/:id/members", handler.AddGroupMember)
+			protected.DELETE("/groups/:id/members/:userId", handler.RemoveGroupMember) // Members may remove themselves to leave
+
 			// Share link management
 			protected.POST("/shares", handler.CreateShareLink)
 			protected.GET("/shares", handler.ListShareLinks)
 			protected.PUT("/shares/:id", handler.UpdateShareLink)
 			protected.DELETE("/shares/:id", handler.DeleteShareLink)
+			protected.GET("/shares/:id/qr", handler.GetShareLinkQR)        // QR code (PNG/SVG) for a share link
+			protected.GET("/shares/:id/card", handler.GetShareLinkCard)    // Printable guest card (PDF)
+			protected.GET("/shares/:id/audit", handler.GetShareLinkAudit)  // Audit log (e.g. geofenced triggers)
+			protected.GET("/shares/:id/devices", handler.ListShareDevices) // Devices bound to device-bound and kiosk links
+			protected.DELETE("/shares/:id/devices/:deviceId", handler.RevokeShareDevice)
+			protected.GET("/shares/:id/kiosk", handler.GetKioskStatus)
+			protected.POST("/shares/:id/kiosk/revoke", handler.RevokeKioskDevice)
+
+			// Access requests to share links requiring approval
+			protected.GET("/access-requests", handler.ListAccessRequests)
+			protected.POST("/access-requests/:id/approve", handler.ApproveAccessRequest)
+			protected.POST("/access-requests/:id/deny", handler.DenyAccessRequest)
+			protected.POST("/access-requests/:id/revoke", handler.RevokeAccessRequest)
+
+			// Action requests for entities requiring approval
+			protected.GET("/action-requests", handler.ListActionRequests)
+			protected.GET("/action-requests/:id", handler.GetActionRequest)
+			protected.GET("/action-requests/:id/stream", handler.StreamActionRequest)
+			protected.POST("/action-requests/:id/approve", handler.ApproveActionRequest)
+			protected.POST("/action-requests/:id/reject", handler.RejectActionRequest)
+
+			// Auto-revert jobs scheduled by triggers of share entries
+			protected.GET("/revert-jobs", handler.ListRevertJobs)
+			protected.POST("/revert-jobs/:id/cancel", handler.CancelRevertJob)
+			protected.POST("/chains/preview", handler.PreviewActionChain)
+
+			// Reservations of entities shared with several users
+			protected.GET("/reservations", handler.ListReservations)
+			protected.POST("/reservations", handler.CreateReservation)
+			protected.POST("/reservations/:id/release", handler.ReleaseReservation)
+
+			// Inbound webhooks triggering entities from external systems
+			protected.GET("/webhooks", handler.ListWebhooks)
+			protected.POST("/webhooks", handler.CreateWebhook)
+			protected.PUT("/webhooks/:id", handler.UpdateWebhook)
+			protected.DELETE("/webhooks/:id", handler.DeleteWebhook)
+			protected.POST("/webhooks/:id/rotate", handler.RotateWebhookSecret)
+			protected.GET("/webhooks/:id/audit", handler.GetWebhookAudit)
+
+			// Outbound webhooks delivering events to external systems
+			protected.GET("/webhook-subscriptions", handler.ListWebhookSubscriptions)
+			protected.POST("/webhook-subscriptions", handler.CreateWebhookSubscription)
+			protected.PUT("/webhook-subscriptions/:id", handler.UpdateWebhookSubscription)
+			protected.DELETE("/webhook-subscriptions/:id", handler.DeleteWebhookSubscription)
+			protected.POST("/webhook-subscriptions/:id/rotate", handler.RotateWebhookSubscriptionSecret)
+			protected.GET("/webhook-subscriptions/:id/deliveries", handler.ListWebhookDeliveries)
+			protected.POST("/webhook-deliveries/:id/retry", handler.RetryWebhookDelivery)
+
+			// Notifications
+			protected.GET("/notifications", handler.GetNotifications)
+			protected.POST("/notifications/read", handler.MarkAllNotificationsRead)
+			protected.POST("/notifications/:id/read", handler.MarkNotificationRead)
 
 			// Admin endpoints (require admin access)
 			admin := protected.Group("")
@@ -156,24 +315,170 @@ func main() {
 	<-quit
 	log.Println("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
+	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
+	// Stop background jobs
+	stop()
+	jobs.Wait()
+
 	log.Println("Server exited")
 }
 
-func startRefreshTimer(handler *handlers.Handler, intervalSeconds int) {
+func startMQTTBridge(cfg *models.Config, handler *handlers.Handler) (*mqtt.Client, error) {
+	client, err := mqtt.Connect(cfg, func(client *mqtt.Client) {
+		log.Printf("Connected to MQTT broker %s", cfg.MQTTBrokerURL)
+		if !cfg.MQTTCommands {
+			return
+		}
+		// Subscriptions are lost with the session, so they are renewed on every connect
+		if err := handler.SubscribeMQTTCommands(client); err != nil {
+			log.Printf("Failed to subscribe to MQTT commands: %v", err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events.Subscribe(func(event events.Event) {
+		handler.PublishMQTTEvent(client, cfg.MQTTEventTypes, event)
+	})
+	return client, nil
+}
+
+func startRefreshTimer(ctx context.Context, handler *handlers.Handler, intervalSeconds int) {
+	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := handler.RefreshEntities(); err != nil {
+				log.Printf("Error refreshing entities: %v", err)
+			} else {
+				log.Println("Entities refreshed successfully")
+			}
+		}
+	}
+}
+
+func startShareSweeper(ctx context.Context, handler *handlers.Handler, intervalSeconds, purgeDays int) {
+	purgeAfter := time.Duration(purgeDays) * 24 * time.Hour
+
+	// Sweep once on startup so stale links are cleaned up immediately
+	if err := handler.SweepShareLinks(purgeAfter); err != nil {
+		log.Printf("Error sweeping share links: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := handler.SweepShareLinks(purgeAfter); err != nil {
+				log.Printf("Error sweeping share links: %v", err)
+			}
+		}
+	}
+}
+
+func startRevertScheduler(ctx context.Context, handler *handlers.Handler, intervalSeconds int) {
+	// Jobs survive restarts: requeue interrupted jobs and run overdue ones immediately
+	if err := handler.RecoverRevertJobs(); err != nil {
+		log.Printf("Error recovering auto-revert jobs: %v", err)
+	}
+	if err := handler.RunRevertJobs(); err != nil {
+		log.Printf("Error running auto-revert jobs: %v", err)
+	}
+
 	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if err := handler.RefreshEntities(); err != nil {
-			log.Printf("Error refreshing entities: %v", err)
-		} else {
-			log.Println("Entities refreshed successfully")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := handler.RunRevertJobs(); err != nil {
+				log.Printf("Error running auto-revert jobs: %v", err)
+			}
+		}
+	}
+}
+
+func startUserShareSweeper(ctx context.Context, handler *handlers.Handler, intervalSeconds int) {
+	// Remove shares that expired while the server was down
+	if err := handler.SweepSharedEntities(); err != nil {
+		log.Printf("Error sweeping user shares: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := handler.SweepSharedEntities(); err != nil {
+				log.Printf("Error sweeping user shares: %v", err)
+			}
+		}
+	}
+}
+
+func startReservationSweeper(ctx context.Context, handler *handlers.Handler, intervalSeconds, noShowMinutes int) {
+	noShow := time.Duration(noShowMinutes) * time.Minute
+
+	// Release reservations that ended while the server was down
+	if err := handler.ReleaseReservations(noShow); err != nil {
+		log.Printf("Error releasing reservations: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := handler.ReleaseReservations(noShow); err != nil {
+				log.Printf("Error releasing reservations: %v", err)
+			}
+		}
+	}
+}
+
+func startWebhookDispatcher(ctx context.Context, handler *handlers.Handler, intervalSeconds, maxAttempts int) {
+	// Deliveries survive restarts: requeue interrupted deliveries and send due ones immediately
+	if err := handler.RecoverWebhookDeliveries(); err != nil {
+		log.Printf("Error recovering webhook deliveries: %v", err)
+	}
+	if err := handler.DeliverWebhooks(maxAttempts); err != nil {
+		log.Printf("Error delivering webhooks: %v", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-handlers.WebhookQueued():
+		}
+		if err := handler.DeliverWebhooks(maxAttempts); err != nil {
+			log.Printf("Error delivering webhooks: %v", err)
 		}
 	}
 }
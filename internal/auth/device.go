@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DeviceClaims represents the claims of the credential of a device bound to a share link
+type DeviceClaims struct {
+	ShareLinkID string `json:"share_link_id"`
+	DeviceID    string `json:"device_id"` // Device bound to the share link
+	jwt.RegisteredClaims
+}
+
+// deviceSecret derives the signing key for device credentials, so they can never be used as user or viewer tokens
+func deviceSecret() []byte {
+	sum := sha256.Sum256(append([]byte("hassh-share-device:"), jwtSecret...))
+	return sum[:]
+}
+
+// GenerateDeviceToken generates a device credential scoped to a single share link
+func GenerateDeviceToken(shareLinkID, deviceID string, expiresAt time.Time) (string, error) {
+	claims := &DeviceClaims{
+		ShareLinkID: shareLinkID,
+		DeviceID:    deviceID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(deviceSecret())
+}
+
+// ValidateDeviceToken validates a device credential and returns the claims
+func ValidateDeviceToken(tokenString string) (*DeviceClaims, error) {
+	claims := &DeviceClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return deviceSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EmbedViewClaims represents the claims of a view of an embedded share link that was already counted
+type EmbedViewClaims struct {
+	ShareLinkID string `json:"share_link_id"`
+	jwt.RegisteredClaims
+}
+
+// embedViewSecret derives the signing key for embed views, so they can never be used as other tokens
+func embedViewSecret() []byte {
+	sum := sha256.Sum256(append([]byte("hassh-embed-view:"), jwtSecret...))
+	return sum[:]
+}
+
+// GenerateEmbedViewToken generates a token that continues a counted view of a single share link
+func GenerateEmbedViewToken(shareLinkID string, expiresAt time.Time) (string, error) {
+	claims := &EmbedViewClaims{
+		ShareLinkID: shareLinkID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(embedViewSecret())
+}
+
+// ValidateEmbedViewToken validates an embed view token and returns the claims
+func ValidateEmbedViewToken(tokenString string) (*EmbedViewClaims, error) {
+	claims := &EmbedViewClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return embedViewSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ViewerClaims represents the claims of a share link viewer session
+type ViewerClaims struct {
+	ShareLinkID string `json:"share_link_id"`
+	RequestID   string `json:"request_id"` // Approved access request the session was granted by
+	jwt.RegisteredClaims
+}
+
+// viewerSecret derives the signing key for viewer sessions, so they can never be used as user tokens
+func viewerSecret() []byte {
+	sum := sha256.Sum256(append([]byte("hassh-share-viewer:"), jwtSecret...))
+	return sum[:]
+}
+
+// GenerateViewerToken generates a session token scoped to a single share link
+func GenerateViewerToken(shareLinkID, requestID string, expiresAt time.Time) (string, error) {
+	claims := &ViewerClaims{
+		ShareLinkID: shareLinkID,
+		RequestID:   requestID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(viewerSecret())
+}
+
+// ValidateViewerToken validates a viewer session token and returns the claims
+func ValidateViewerToken(tokenString string) (*ViewerClaims, error) {
+	claims := &ViewerClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return viewerSecret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/ThraaxSession/Hash/internal/models"
 )
@@ -24,7 +25,7 @@ func Load() *models.Config {
 
 	haURL := os.Getenv("HOME_ASSISTANT_URL")
 	token := os.Getenv("HA_TOKEN")
-	
+
 	refreshInterval := 30 // default 30 seconds
 	if interval := os.Getenv("REFRESH_INTERVAL"); interval != "" {
 		if parsed, err := strconv.Atoi(interval); err == nil && parsed > 0 {
@@ -32,6 +33,102 @@ func Load() *models.Config {
 		}
 	}
 
+	shareSweepInterval := 60 // default 60 seconds
+	if interval := os.Getenv("SHARE_SWEEP_INTERVAL"); interval != "" {
+		if parsed, err := strconv.Atoi(interval); err == nil && parsed > 0 {
+			shareSweepInterval = parsed
+		}
+	}
+
+	sharePurgeDays := 0 // disabled by default
+	if days := os.Getenv("SHARE_PURGE_DAYS"); days != "" {
+		if parsed, err := strconv.Atoi(days); err == nil && parsed >= 0 {
+			sharePurgeDays = parsed
+		}
+	}
+
+	accessRequestTTL := 15 // default 15 minutes
+	if ttl := os.Getenv("ACCESS_REQUEST_TTL"); ttl != "" {
+		if parsed, err := strconv.Atoi(ttl); err == nil && parsed > 0 {
+			accessRequestTTL = parsed
+		}
+	}
+
+	viewerSessionHours := 24 // default 24 hours
+	if hours := os.Getenv("VIEWER_SESSION_HOURS"); hours != "" {
+		if parsed, err := strconv.Atoi(hours); err == nil && parsed > 0 {
+			viewerSessionHours = parsed
+		}
+	}
+
+	actionRequestTTL := 5 // default 5 minutes
+	if ttl := os.Getenv("ACTION_REQUEST_TTL"); ttl != "" {
+		if parsed, err := strconv.Atoi(ttl); err == nil && parsed > 0 {
+			actionRequestTTL = parsed
+		}
+	}
+
+	kioskHeartbeatInterval := 60 // default 60 seconds
+	if interval := os.Getenv("KIOSK_HEARTBEAT_INTERVAL"); interval != "" {
+		if parsed, err := strconv.Atoi(interval); err == nil && parsed > 0 {
+			kioskHeartbeatInterval = parsed
+		}
+	}
+
+	autoRevertInterval := 15 // default 15 seconds
+	if interval := os.Getenv("AUTO_REVERT_INTERVAL"); interval != "" {
+		if parsed, err := strconv.Atoi(interval); err == nil && parsed > 0 {
+			autoRevertInterval = parsed
+		}
+	}
+
+	reservationNoShow := 15 // default 15 minutes, 0 disables
+	if minutes := os.Getenv("RESERVATION_NO_SHOW"); minutes != "" {
+		if parsed, err := strconv.Atoi(minutes); err == nil && parsed >= 0 {
+			reservationNoShow = parsed
+		}
+	}
+
+	webhookDeliveryInterval := 10 // default 10 seconds
+	if interval := os.Getenv("WEBHOOK_DELIVERY_INTERVAL"); interval != "" {
+		if parsed, err := strconv.Atoi(interval); err == nil && parsed > 0 {
+			webhookDeliveryInterval = parsed
+		}
+	}
+
+	webhookMaxAttempts := 8 // default 8 attempts (about an hour of retries)
+	if attempts := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); attempts != "" {
+		if parsed, err := strconv.Atoi(attempts); err == nil && parsed > 0 {
+			webhookMaxAttempts = parsed
+		}
+	}
+
+	// Optional MQTT bridge (disabled when no broker is configured)
+	mqttBrokerURL := strings.TrimSpace(os.Getenv("MQTT_BROKER_URL"))
+	mqttClientID := os.Getenv("MQTT_CLIENT_ID")
+	if mqttClientID == "" {
+		mqttClientID = "hassh"
+	}
+	mqttTopicPrefix := strings.Trim(os.Getenv("MQTT_TOPIC_PREFIX"), "/")
+	if mqttTopicPrefix == "" {
+		mqttTopicPrefix = "hassh"
+	}
+
+	// Event types or patterns forwarded to MQTT (default: none, "*" for all)
+	var mqttEventTypes []string
+	for _, eventType := range strings.Split(os.Getenv("MQTT_EVENT_TYPES"), ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			mqttEventTypes = append(mqttEventTypes, eventType)
+		}
+	}
+
+	mqttCommands := false
+	if commands := os.Getenv("MQTT_COMMANDS"); commands != "" {
+		if parsed, err := strconv.ParseBool(commands); err == nil {
+			mqttCommands = parsed
+		}
+	}
+
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = "hassh.db"
@@ -43,14 +140,69 @@ func Load() *models.Config {
 		jwtSecret = generateRandomSecret()
 	}
 
+	// Public base URL used when rendering share links into QR codes and guest cards
+	// (falls back to the request host when empty)
+	publicURL := strings.TrimRight(os.Getenv("PUBLIC_URL"), "/")
+
+	// Reverse proxies (IPs or CIDRs) whose forwarding headers are trusted when resolving client IPs
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+
+	// Forwarding header the trusted proxies set: "x-forwarded-for" (default) or "forwarded"
+	trustedProxyHeader := strings.ToLower(strings.TrimSpace(os.Getenv("TRUSTED_PROXY_HEADER")))
+	if trustedProxyHeader != "forwarded" {
+		trustedProxyHeader = "x-forwarded-for"
+	}
+
+	// Which entities share links may expose: "tracked" (tracked by the owner or allowlisted),
+	// "allowlist" (allowlisted only) or "off" (any entity of the owner's Home Assistant)
+	shareEntityPolicy := strings.ToLower(strings.TrimSpace(os.Getenv("SHARE_ENTITY_POLICY")))
+	if shareEntityPolicy != "allowlist" && shareEntityPolicy != "off" {
+		shareEntityPolicy = "tracked"
+	}
+
+	// Entity IDs or patterns (e.g. "sensor.outdoor_*") every user may share
+	var shareEntityAllowlist []string
+	for _, pattern := range strings.Split(os.Getenv("SHARE_ENTITY_ALLOWLIST"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			shareEntityAllowlist = append(shareEntityAllowlist, pattern)
+		}
+	}
+
 	return &models.Config{
-		HomeAssistantURL: haURL,
-		Token:            token,
-		Host:             host,
-		Port:             port,
-		RefreshInterval:  refreshInterval,
-		DBPath:           dbPath,
-		JWTSecret:        jwtSecret,
+		HomeAssistantURL:        haURL,
+		Token:                   token,
+		Host:                    host,
+		Port:                    port,
+		RefreshInterval:         refreshInterval,
+		DBPath:                  dbPath,
+		JWTSecret:               jwtSecret,
+		PublicURL:               publicURL,
+		ShareSweepInterval:      shareSweepInterval,
+		SharePurgeDays:          sharePurgeDays,
+		TrustedProxies:          trustedProxies,
+		TrustedProxyHeader:      trustedProxyHeader,
+		AccessRequestTTL:        accessRequestTTL,
+		ViewerSessionHours:      viewerSessionHours,
+		ActionRequestTTL:        actionRequestTTL,
+		ShareEntityPolicy:       shareEntityPolicy,
+		ShareEntityAllowlist:    shareEntityAllowlist,
+		KioskHeartbeatInterval:  kioskHeartbeatInterval,
+		AutoRevertInterval:      autoRevertInterval,
+		ReservationNoShow:       reservationNoShow,
+		WebhookDeliveryInterval: webhookDeliveryInterval,
+		WebhookMaxAttempts:      webhookMaxAttempts,
+		MQTTBrokerURL:           mqttBrokerURL,
+		MQTTUsername:            os.Getenv("MQTT_USERNAME"),
+		MQTTPassword:            os.Getenv("MQTT_PASSWORD"),
+		MQTTClientID:            mqttClientID,
+		MQTTTopicPrefix:         mqttTopicPrefix,
+		MQTTEventTypes:          mqttEventTypes,
+		MQTTCommands:            mqttCommands,
 	}
 }
 
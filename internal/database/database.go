@@ -27,6 +27,19 @@ func Initialize(dbPath string) error {
 		&models.Entity{},
 		&models.ShareLink{},
 		&models.SharedEntity{},
+		&models.Group{},
+		&models.GroupMember{},
+		&models.SharedEntityMember{},
+		&models.AuditLog{},
+		&models.AccessRequest{},
+		&models.ActionRequest{},
+		&models.Notification{},
+		&models.ShareDevice{},
+		&models.RevertJob{},
+		&models.Reservation{},
+		&models.Webhook{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
 	)
 	if err != nil {
 		return err
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	ShareLinkCreated   = "share_link.created"   // User created a share link
+	ShareLinkTriggered = "share_link.triggered" // Guest triggered an entity through a share link (or ran an action link)
+	ShareLinkExpired   = "share_link.expired"   // Time-based share link passed its expiry
+	ShareLinkExhausted = "share_link.exhausted" // Counter-based share link reached its maximum access count
+	ShareLinkDeleted   = "share_link.deleted"   // Share link was deleted by its owner or purged while inactive
+
+	AccessRequested       = "access_request.created"  // Visitor requested access to a share link
+	AccessRequestApproved = "access_request.approved" // Owner approved an access request
+	AccessRequestDenied   = "access_request.denied"   // Owner denied an access request
+	AccessRequestExpired  = "access_request.expired"  // Pending access request was not decided in time
+
+	ActionRequested      = "action_request.created"  // Guest or user requested a trigger that needs approval
+	ActionExecuted       = "action_request.executed" // Owner approved an action request and it was executed
+	ActionFailed         = "action_request.failed"   // Owner approved an action request but Home Assistant failed
+	ActionRejected       = "action_request.rejected" // Owner rejected an action request
+	ActionRequestExpired = "action_request.expired"  // Pending action request was not decided in time
+
+	ShareDeviceBound   = "share_device.bound"   // A device was bound to a device-bound or kiosk share link on first use
+	ShareDeviceRevoked = "share_device.revoked" // Owner revoked a device bound to a share link
+
+	RevertScheduled = "revert_job.scheduled" // A trigger scheduled an auto-revert of the entity
+	RevertExecuted  = "revert_job.executed"  // Auto-revert called the inverse service
+	RevertCancelled = "revert_job.cancelled" // Auto-revert was cancelled (by the owner, a new trigger or a manual state change)
+	RevertFailed    = "revert_job.failed"    // Home Assistant rejected the inverse service call
+
+	ChainCompleted = "action_chain.completed" // Every step of an action chain succeeded (or was allowed to fail)
+	ChainFailed    = "action_chain.failed"    // A step of an action chain failed and stopped the chain
+
+	ReservationCreated   = "reservation.created"   // A user reserved an entity for a time slot
+	ReservationCompleted = "reservation.completed" // A reservation's slot ended
+	ReservationReleased  = "reservation.released"  // A reservation was released early (by its user, or unused after RESERVATION_NO_SHOW)
+	ReservationCancelled = "reservation.cancelled" // The owner cancelled a reservation or overrode it with their own
+
+	SharedEntityTriggered = "shared_entity.triggered" // User triggered an entity shared with them
+	SharedEntityExpired   = "shared_entity.expired"   // A user share passed its expiry and was removed
+	SharedEntityInvited   = "shared_entity.invited"   // User shared an entity with another user, who still has to accept
+	SharedEntityAccepted  = "shared_entity.accepted"  // User accepted a share invitation
+	SharedEntityDeclined  = "shared_entity.declined"  // User declined a share invitation
+	SharedEntityLeft      = "shared_entity.left"      // User left an entity shared with them
+
+	EntityStateChanged = "entity.state_changed" // Home Assistant reported a new state of a tracked entity
+
+	UserCreated     = "user.created"      // A user registered or was created by an admin
+	UserOTPDisabled = "user.otp_disabled" // A user turned off two-factor authentication
+
+	WebhookTriggered = "webhook.triggered" // A signed webhook request triggered its entity
+	WebhookFailed    = "webhook.failed"    // Home Assistant rejected the service call of a webhook request
+)
+
+// Event represents something that happened in Hassh that other components may react to
+type Event struct {
+	Type   string                 `json:"type"`
+	UserID uint                   `json:"user_id"` // User the event concerns (e.g. the share link owner)
+	Data   map[string]interface{} `json:"data,omitempty"`
+	Time   time.Time              `json:"time"`
+}
+
+// Handler handles a published event
+type Handler func(Event)
+
+var (
+	mu          sync.RWMutex
+	subscribers []Handler
+)
+
+// Subscribe registers a handler that is called for every published event
+func Subscribe(handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	subscribers = append(subscribers, handler)
+}
+
+// Publish delivers an event to all subscribers asynchronously
+func Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, handler := range subscribers {
+		go handler(event)
+	}
+}
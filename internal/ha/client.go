@@ -153,3 +153,37 @@ func (c *Client) CallService(domain, service string, data map[string]interface{}
 	
 	return nil
 }
+
+// FireEvent fires an event on the Home Assistant event bus
+func (c *Client) FireEvent(eventType string, data map[string]interface{}) error {
+	url := fmt.Sprintf("%s/api/events/%s", c.BaseURL, eventType)
+	
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Content-Type", "application/json")
+	
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to fire event: %s - %s", resp.Status, string(body))
+	}
+	
+	return nil
+}
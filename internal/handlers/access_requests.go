@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/auth"
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxAccessRequestNameLength    = 64
+	maxAccessRequestMessageLength = 280
+	maxPendingAccessRequests      = 20 // Per share link, limits request spam
+	viewerSessionHeader           = "X-Share-Session"
+)
+
+// RequestShareAccess lets a visitor request access to a share link that requires approval (public endpoint)
+func (h *Handler) RequestShareAccess(c *gin.Context) {
+	shareID := c.Param("id")
+
+	var req struct {
+		Name    string `json:"name" binding:"required"`
+		Message string `json:"message"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var shareLink models.ShareLink
+	if err := database.DB.Preload("User").First(&shareLink, "id = ?", shareID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	// Check if link is active
+	if !shareLink.Active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Share link is no longer active"})
+		return
+	}
+
+	if !shareLink.RequireApproval {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This share link does not require approval"})
+		return
+	}
+
+	// Check network restriction
+	if !allowsClientIP(shareLink.IPRestriction, clientIP(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access to this share link is not allowed from your network"})
+		return
+	}
+
+	name, err := sanitizeLine(req.Name, "name", maxAccessRequestNameLength)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	message, err := sanitizeLine(req.Message, "message", maxAccessRequestMessageLength)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Limit open requests per link
+	var pending int64
+	database.DB.Model(&models.AccessRequest{}).
+		Where("share_link_id = ? AND status = ? AND expires_at > ?", shareLink.ID, "pending", time.Now()).
+		Count(&pending)
+	if pending >= maxPendingAccessRequests {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many pending access requests for this share link. Please try again later"})
+		return
+	}
+
+	accessRequest := models.AccessRequest{
+		ID:          generateID(),
+		ShareLinkID: shareLink.ID,
+		UserID:      shareLink.UserID,
+		Name:        name,
+		Message:     message,
+		Status:      "pending",
+		ClientIP:    clientIP(c).String(),
+		ExpiresAt:   time.Now().Add(time.Duration(h.accessRequestTTL()) * time.Minute),
+	}
+
+	if err := database.DB.Create(&accessRequest).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access request"})
+		return
+	}
+
+	// Let the owner know
+	shareName := shareLink.Title
+	if shareName == "" {
+		shareName = "your share link"
+	}
+	notificationText := fmt.Sprintf("%s requests access to %s", name, shareName)
+	if message != "" {
+		notificationText += ": " + message
+	}
+	notifyUser(&shareLink.User, "access_request", "Access request", notificationText, map[string]interface{}{
+		"share_id":          shareLink.ID,
+		"access_request_id": accessRequest.ID,
+	})
+	publishAccessRequestEvent(events.AccessRequested, &accessRequest)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         accessRequest.ID,
+		"status":     accessRequest.Status,
+		"expires_at": accessRequest.ExpiresAt,
+	})
+}
+
+// GetShareAccessRequest returns the outcome of an access request and, once approved, a viewer session (public endpoint).
+// The request ID is only known to the visitor who created it and the owner.
+func (h *Handler) GetShareAccessRequest(c *gin.Context) {
+	shareID := c.Param("id")
+	requestID := c.Param("requestId")
+
+	var accessRequest models.AccessRequest
+	if err := database.DB.Where("id = ? AND share_link_id = ?", requestID, shareID).First(&accessRequest).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access request not found"})
+		return
+	}
+
+	// Expire undecided requests
+	if accessRequest.Status == "pending" && time.Now().After(accessRequest.ExpiresAt) {
+		accessRequest.Status = "expired"
+		database.DB.Save(&accessRequest)
+		publishAccessRequestEvent(events.AccessRequestExpired, &accessRequest)
+	}
+
+	response := gin.H{
+		"id":         accessRequest.ID,
+		"status":     accessRequest.Status,
+		"expires_at": accessRequest.ExpiresAt,
+	}
+
+	if accessRequest.Status == "approved" {
+		var shareLink models.ShareLink
+		if err := database.DB.First(&shareLink, "id = ?", shareID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+			return
+		}
+
+		sessionExpiresAt := h.viewerSessionExpiry(&shareLink, &accessRequest)
+		if time.Now().After(sessionExpiresAt) {
+			accessRequest.Status = "expired"
+			database.DB.Save(&accessRequest)
+			response["status"] = accessRequest.Status
+		} else {
+			token, err := auth.GenerateViewerToken(shareLink.ID, accessRequest.ID, sessionExpiresAt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create viewer session"})
+				return
+			}
+			response["session_token"] = token
+			response["session_expires_at"] = sessionExpiresAt
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListAccessRequests lists access requests to the user's share links (optionally filtered by share_id and status)
+func (h *Handler) ListAccessRequests(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	// Expire undecided requests before listing them
+	expirePendingAccessRequests()
+
+	query := database.DB.Where("user_id = ?", userID)
+	if shareID := c.Query("share_id"); shareID != "" {
+		query = query.Where("share_link_id = ?", shareID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var accessRequests []models.AccessRequest
+	if err := query.Order("created_at DESC").Limit(100).Find(&accessRequests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch access requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accessRequests)
+}
+
+// ApproveAccessRequest approves a pending access request
+func (h *Handler) ApproveAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, "pending", "approved", events.AccessRequestApproved)
+}
+
+// DenyAccessRequest denies a pending access request
+func (h *Handler) DenyAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, "pending", "denied", events.AccessRequestDenied)
+}
+
+// RevokeAccessRequest ends the viewer session granted by an approved access request
+func (h *Handler) RevokeAccessRequest(c *gin.Context) {
+	h.decideAccessRequest(c, "approved", "revoked", "")
+}
+
+// decideAccessRequest moves an access request owned by the user from one status to another
+func (h *Handler) decideAccessRequest(c *gin.Context, from, to, eventType string) {
+	userID := c.MustGet("userID").(uint)
+	requestID := c.Param("id")
+
+	var accessRequest models.AccessRequest
+	if err := database.DB.Where("id = ? AND user_id = ?", requestID, userID).First(&accessRequest).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access request not found or not owned by you"})
+		return
+	}
+
+	if accessRequest.Status == "pending" && time.Now().After(accessRequest.ExpiresAt) {
+		accessRequest.Status = "expired"
+		database.DB.Save(&accessRequest)
+		publishAccessRequestEvent(events.AccessRequestExpired, &accessRequest)
+	}
+
+	if accessRequest.Status != from {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Access request is %s", accessRequest.Status)})
+		return
+	}
+
+	now := time.Now()
+	accessRequest.Status = to
+	accessRequest.DecidedAt = &now
+	if err := database.DB.Save(&accessRequest).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update access request"})
+		return
+	}
+
+	if eventType != "" {
+		publishAccessRequestEvent(eventType, &accessRequest)
+	}
+
+	c.JSON(http.StatusOK, accessRequest)
+}
+
+// hasViewerSession reports whether the request carries a valid viewer session for the share link
+func hasViewerSession(c *gin.Context, link *models.ShareLink) bool {
+	_, ok := viewerSession(c, link)
+	return ok
+}
+
+// viewerSession returns the approved access request behind the request's viewer session, if any
+func viewerSession(c *gin.Context, link *models.ShareLink) (*models.AccessRequest, bool) {
+	token := c.GetHeader(viewerSessionHeader)
+	if token == "" {
+		return nil, false
+	}
+
+	claims, err := auth.ValidateViewerToken(token)
+	if err != nil || claims.ShareLinkID != link.ID {
+		return nil, false
+	}
+
+	// The owner can revoke sessions at any time
+	var accessRequest models.AccessRequest
+	if err := database.DB.Where("id = ? AND share_link_id = ?", claims.RequestID, link.ID).First(&accessRequest).Error; err != nil {
+		return nil, false
+	}
+	if accessRequest.Status != "approved" {
+		return nil, false
+	}
+	return &accessRequest, true
+}
+
+// viewerSessionExpiry returns when the session granted by an approved request ends,
+// never outliving a time-limited share link
+func (h *Handler) viewerSessionExpiry(link *models.ShareLink, accessRequest *models.AccessRequest) time.Time {
+	hours := 24
+	if h.Config != nil && h.Config.ViewerSessionHours > 0 {
+		hours = h.Config.ViewerSessionHours
+	}
+
+	approvedAt := accessRequest.UpdatedAt
+	if accessRequest.DecidedAt != nil {
+		approvedAt = *accessRequest.DecidedAt
+	}
+
+	expiresAt := approvedAt.Add(time.Duration(hours) * time.Hour)
+	if link.Type == "time" && link.ExpiresAt.Before(expiresAt) {
+		expiresAt = link.ExpiresAt
+	}
+	return expiresAt
+}
+
+// accessRequestTTL returns how long pending access requests stay open, in minutes
+func (h *Handler) accessRequestTTL() int {
+	if h.Config != nil && h.Config.AccessRequestTTL > 0 {
+		return h.Config.AccessRequestTTL
+	}
+	return 15
+}
+
+// expirePendingAccessRequests marks undecided access requests past their expiry as expired
+func expirePendingAccessRequests() int {
+	var expired []models.AccessRequest
+	if err := database.DB.Where("status = ? AND expires_at < ?", "pending", time.Now()).Find(&expired).Error; err != nil {
+		log.Printf("Failed to find expired access requests: %v", err)
+		return 0
+	}
+
+	count := 0
+	for i := range expired {
+		expired[i].Status = "expired"
+		if err := database.DB.Save(&expired[i]).Error; err != nil {
+			log.Printf("Failed to expire access request %s: %v", expired[i].ID, err)
+			continue
+		}
+		publishAccessRequestEvent(events.AccessRequestExpired, &expired[i])
+		count++
+	}
+	return count
+}
+
+// publishAccessRequestEvent publishes an access request lifecycle event
+func publishAccessRequestEvent(eventType string, accessRequest *models.AccessRequest) {
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: accessRequest.UserID,
+		Data: map[string]interface{}{
+			"access_request_id": accessRequest.ID,
+			"share_id":          accessRequest.ShareLinkID,
+			"name":              accessRequest.Name,
+		},
+	})
+}
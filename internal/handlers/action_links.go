@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const maxActionDataSize = 4096
+
+// ActionLinkPage renders the page of an action link opened in a browser, e.g. from an NFC tag. It asks
+// for confirmation, or runs the action right away through a POST, so link previews never trigger it (public endpoint).
+func (h *Handler) ActionLinkPage(c *gin.Context) {
+	data := gin.H{"ShareID": c.Param("id")}
+
+	var shareLink models.ShareLink
+	if err := database.DB.First(&shareLink, "id = ?", c.Param("id")).Error; err != nil || !isActionLink(&shareLink) {
+		data["Error"] = "Action link not found"
+		c.HTML(http.StatusNotFound, "action.html", data)
+		return
+	}
+	data["Title"] = shareLink.Title
+
+	if !shareLink.Active {
+		data["Error"] = "This action link is no longer active"
+		c.HTML(http.StatusForbidden, "action.html", data)
+		return
+	}
+
+	data["Confirm"] = shareLink.Action.Confirm
+	data["Geofence"] = shareLink.Geofence.Enabled
+	c.HTML(http.StatusOK, "action.html", data)
+}
+
+// RunActionLink performs the service call of an action link. It applies the share link's rules, counts
+// as an access of counter links and never returns entity states (public endpoint).
+func (h *Handler) RunActionLink(c *gin.Context) {
+	// The body is optional; shortcuts and NFC automations may post nothing
+	var req struct {
+		Position *geoPosition `json:"position"` // Required for geofenced links
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var shareLink models.ShareLink
+	if err := database.DB.Preload("User").First(&shareLink, "id = ?", c.Param("id")).Error; err != nil || !isActionLink(&shareLink) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Action link not found"})
+		return
+	}
+
+	// Check validity, quota, schedule, network restriction and conditions
+	if status, denial := checkShareRules(c, &shareLink); denial != nil {
+		c.JSON(status, denial)
+		return
+	}
+
+	// Bind the device to device-bound links on first use
+	if status, denial := h.bindShareDevice(c, &shareLink); denial != nil {
+		c.JSON(status, denial)
+		return
+	}
+
+	action := shareLink.Action
+	entry, found := shareLink.Entries.Find(action.EntityID)
+	if !found {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Action link is misconfigured"})
+		return
+	}
+
+	haClient := ha.NewClient(shareLink.User.HAURL, shareLink.User.HAToken)
+
+	// Check the guest's position against the geofence
+	if shareLink.Geofence.Enabled {
+		check, err := checkGeofence(haClient, shareLink.Geofence, req.Position)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to resolve geofence: " + err.Error()})
+			return
+		}
+
+		auditGeofenceCheck(c, &shareLink, action.EntityID, action.Service, req.Position, check)
+		if !check.Allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": check.Reason, "geofence": true})
+			return
+		}
+	}
+
+	// Every run uses up an access of counter links
+	recordShareAccess(&shareLink)
+
+	err := callEntityService(haClient, action.EntityID, action.Service, actionServiceData(action))
+
+	result, details := "executed", map[string]interface{}{"service": action.Service}
+	if err != nil {
+		result = "failed"
+		details["error"] = err.Error()
+	}
+	recordAudit(models.AuditLog{
+		UserID:      shareLink.UserID,
+		ShareLinkID: shareLink.ID,
+		EntityID:    action.EntityID,
+		Action:      "share_link.action",
+		Result:      result,
+		ClientIP:    clientIP(c).String(),
+	}, details)
+
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to run action: " + err.Error()})
+		return
+	}
+
+	// Auto-revert and action chains apply like for triggers on the share page
+	response := gin.H{"message": "Done"}
+	if job := scheduleRevert(&shareLink, *entry, action.Service); job != nil {
+		response["auto_revert_at"] = job.DueAt
+	}
+	h.startActionChain(&shareLink, *entry, action.Service, clientIP(c).String())
+	publishShareTriggerEvent(&shareLink, action.EntityID, action.Service)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// normalizeShareAction validates the action of an action link. Links without an action entity are regular share links.
+func normalizeShareAction(action models.ShareAction) (models.ShareAction, error) {
+	action.EntityID = strings.ToLower(strings.TrimSpace(action.EntityID))
+	action.Service = strings.ToLower(strings.TrimSpace(action.Service))
+	if action.EntityID == "" {
+		if action.Service != "" || len(action.Data) > 0 {
+			return action, errors.New("action needs an entity_id")
+		}
+		return models.ShareAction{}, nil
+	}
+
+	if !entityIDPattern.MatchString(action.EntityID) {
+		return action, fmt.Errorf("invalid action entity_id %q", action.EntityID)
+	}
+	if !domainPattern.MatchString(action.Service) {
+		return action, fmt.Errorf("invalid action service %q", action.Service)
+	}
+	if action.Data != nil {
+		data, err := json.Marshal(action.Data)
+		if err != nil || len(data) > maxActionDataSize {
+			return action, fmt.Errorf("action data must be at most %d bytes of JSON", maxActionDataSize)
+		}
+	}
+	return action, nil
+}
+
+// actionLinkEntries returns the single entry of an action link: its action's entity, triggerable with
+// only the action's service. Auto-revert, chain and display settings are kept from a matching entry.
+func actionLinkEntries(action models.ShareAction, entries []models.ShareEntry) []models.ShareEntry {
+	entry := models.ShareEntry{EntityID: action.EntityID}
+	for _, existing := range entries {
+		if existing.EntityID == action.EntityID {
+			entry = existing
+			break
+		}
+	}
+	entry.AccessMode = "triggerable"
+	entry.AllowedServices = []string{action.Service}
+	entry.RequiresApproval = false
+	return []models.ShareEntry{entry}
+}
+
+// validateActionLink rejects settings that need the share page, which action links do not have
+func validateActionLink(link *models.ShareLink) error {
+	if !isActionLink(link) {
+		return nil
+	}
+	if link.Type == "kiosk" {
+		return errors.New("action links cannot be kiosk links")
+	}
+	if len(link.Selectors) > 0 {
+		return errors.New("action links cannot have selectors")
+	}
+	if link.RequireApproval {
+		return errors.New("action links cannot require approval")
+	}
+	if link.Embed.Enabled {
+		return errors.New("action links cannot be embedded")
+	}
+	return nil
+}
+
+// isActionLink reports whether a share link performs a single action instead of showing entities
+func isActionLink(link *models.ShareLink) bool {
+	return link.Action.EntityID != ""
+}
+
+// actionServiceData returns a copy of the service data of an action, so calls never change the link's action
+func actionServiceData(action models.ShareAction) map[string]interface{} {
+	data := make(map[string]interface{}, len(action.Data)+1)
+	for key, value := range action.Data {
+		data[key] = value
+	}
+	return data
+}
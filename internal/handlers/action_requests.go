@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxPendingActionRequests = 20 // Per share link or requesting user
+	actionRequestListLimit   = 100
+	actionStreamHeartbeat    = 15 * time.Second
+)
+
+var errTooManyActionRequests = errors.New("too many pending action requests")
+
+// actionWaiters wakes up streams waiting for the decision on an action request
+var (
+	actionWaitersMu sync.Mutex
+	actionWaiters   = make(map[string][]chan struct{})
+)
+
+// GetShareActionRequest returns the outcome of an action request made via a share link (public endpoint).
+// The request ID is only known to the guest who created it and the owner.
+func (h *Handler) GetShareActionRequest(c *gin.Context) {
+	actionRequest, ok := findShareActionRequest(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, actionRequestStatus(actionRequest))
+}
+
+// StreamShareActionRequest streams the outcome of an action request made via a share link (public endpoint)
+func (h *Handler) StreamShareActionRequest(c *gin.Context) {
+	actionRequest, ok := findShareActionRequest(c)
+	if !ok {
+		return
+	}
+	streamActionRequest(c, actionRequest.ID)
+}
+
+// ListActionRequests lists action requests waiting for the user's approval,
+// or with role=requester the requests the user made
+func (h *Handler) ListActionRequests(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	// Expire undecided requests before listing them
+	expirePendingActionRequests()
+
+	query := database.DB.Where("user_id = ?", userID)
+	if c.Query("role") == "requester" {
+		query = database.DB.Where("requester_id = ?", userID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var actionRequests []models.ActionRequest
+	if err := query.Order("created_at DESC").Limit(actionRequestListLimit).Find(&actionRequests).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch action requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, actionRequests)
+}
+
+// GetActionRequest returns an action request to its owner or requester
+func (h *Handler) GetActionRequest(c *gin.Context) {
+	actionRequest, ok := findUserActionRequest(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, actionRequest)
+}
+
+// StreamActionRequest streams the outcome of an action request to its owner or requester
+func (h *Handler) StreamActionRequest(c *gin.Context) {
+	actionRequest, ok := findUserActionRequest(c)
+	if !ok {
+		return
+	}
+	streamActionRequest(c, actionRequest.ID)
+}
+
+// ApproveActionRequest approves a pending action request and executes it with the owner's credentials
+func (h *Handler) ApproveActionRequest(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	user := c.MustGet("user").(*models.User)
+
+	actionRequest, ok := claimActionRequest(c, userID, "approved")
+	if !ok {
+		return
+	}
+
+	// Execute the stored service call
+	haClient := ha.NewClient(user.HAURL, user.HAToken)
+	err := executeActionRequest(haClient, actionRequest)
+
+	eventType := events.ActionExecuted
+	actionRequest.Status = "executed"
+	if err != nil {
+		eventType = events.ActionFailed
+		actionRequest.Status = "failed"
+		actionRequest.Error = err.Error()
+	}
+	if err := database.DB.Save(actionRequest).Error; err != nil {
+		log.Printf("Failed to save action request %s: %v", actionRequest.ID, err)
+	}
+	finishActionRequest(eventType, actionRequest)
+
+	if actionRequest.Status == "failed" {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to trigger entity: " + actionRequest.Error, "action_request": actionRequest})
+		return
+	}
+
+	// Approved share link actions are reverted and chained like direct triggers
+	h.followUpApprovedAction(actionRequest)
+
+	c.JSON(http.StatusOK, actionRequest)
+}
+
+// followUpApprovedAction schedules the auto-revert and starts the action chain of a share link
+// action the owner approved
+func (h *Handler) followUpApprovedAction(actionRequest *models.ActionRequest) {
+	if actionRequest.ShareLinkID == "" {
+		return
+	}
+
+	var link models.ShareLink
+	if err := database.DB.Preload("User").First(&link, "id = ?", actionRequest.ShareLinkID).Error; err != nil {
+		return
+	}
+	entry, found, err := h.findShareEntry(&link, actionRequest.EntityID)
+	if err != nil || !found {
+		return
+	}
+	scheduleRevert(&link, *entry, actionRequest.Service)
+	h.startActionChain(&link, *entry, actionRequest.Service, "")
+}
+
+// RejectActionRequest rejects a pending action request
+func (h *Handler) RejectActionRequest(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	actionRequest, ok := claimActionRequest(c, userID, "rejected")
+	if !ok {
+		return
+	}
+	finishActionRequest(events.ActionRejected, actionRequest)
+
+	c.JSON(http.StatusOK, actionRequest)
+}
+
+// createActionRequest stores a pending action request and asks the owner for approval
+func (h *Handler) createActionRequest(clientIP string, owner *models.User, actionRequest models.ActionRequest, data map[string]interface{}) (*models.ActionRequest, error) {
+	// Limit open requests per share link or requesting user
+	query := database.DB.Model(&models.ActionRequest{}).Where("status = ? AND expires_at > ?", "pending", time.Now())
+	if actionRequest.ShareLinkID != "" {
+		query = query.Where("share_link_id = ?", actionRequest.ShareLinkID)
+	} else {
+		query = query.Where("requester_id = ?", actionRequest.RequesterID)
+	}
+	var pending int64
+	query.Count(&pending)
+	if pending >= maxPendingActionRequests {
+		return nil, errTooManyActionRequests
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := 5
+	if h.Config != nil && h.Config.ActionRequestTTL > 0 {
+		ttl = h.Config.ActionRequestTTL
+	}
+
+	actionRequest.ID = generateID()
+	actionRequest.UserID = owner.ID
+	actionRequest.Data = encoded
+	actionRequest.Status = "pending"
+	actionRequest.ClientIP = clientIP
+	actionRequest.ExpiresAt = time.Now().Add(time.Duration(ttl) * time.Minute)
+
+	if err := database.DB.Create(&actionRequest).Error; err != nil {
+		return nil, err
+	}
+
+	notifyUser(owner, "action_request", "Approval needed",
+		fmt.Sprintf("%s wants to call %s on %s", actionRequest.RequesterName, actionRequest.Service, actionRequest.EntityID),
+		map[string]interface{}{
+			"action_request_id": actionRequest.ID,
+			"entity_id":         actionRequest.EntityID,
+		})
+	publishActionRequestEvent(events.ActionRequested, &actionRequest)
+
+	return &actionRequest, nil
+}
+
+// respondActionRequestCreated answers a trigger that was turned into an action request
+func respondActionRequestCreated(c *gin.Context, actionRequest *models.ActionRequest, err error) {
+	c.JSON(actionRequestCreated(actionRequest, err))
+}
+
+// actionRequestCreated builds the answer to a trigger that was turned into an action request
+func actionRequestCreated(actionRequest *models.ActionRequest, err error) (int, gin.H) {
+	if errors.Is(err, errTooManyActionRequests) {
+		return http.StatusTooManyRequests, gin.H{"error": "Too many actions are waiting for approval. Please try again later"}
+	}
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to create action request"}
+	}
+
+	return http.StatusAccepted, gin.H{
+		"message":        "Action is waiting for the owner's approval",
+		"action_request": actionRequestStatus(actionRequest),
+	}
+}
+
+// findShareActionRequest loads the action request of a share link, expiring it when undecided for too long
+func findShareActionRequest(c *gin.Context) (*models.ActionRequest, bool) {
+	var actionRequest models.ActionRequest
+	if err := database.DB.Where("id = ? AND share_link_id = ?", c.Param("requestId"), c.Param("id")).First(&actionRequest).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Action request not found"})
+		return nil, false
+	}
+	expireActionRequest(&actionRequest)
+	return &actionRequest, true
+}
+
+// findUserActionRequest loads an action request visible to the authenticated user (owner or requester)
+func findUserActionRequest(c *gin.Context) (*models.ActionRequest, bool) {
+	userID := c.MustGet("userID").(uint)
+
+	var actionRequest models.ActionRequest
+	if err := database.DB.Where("id = ? AND (user_id = ? OR requester_id = ?)", c.Param("id"), userID, userID).First(&actionRequest).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Action request not found"})
+		return nil, false
+	}
+	expireActionRequest(&actionRequest)
+	return &actionRequest, true
+}
+
+// claimActionRequest atomically moves a pending action request owned by the user to the given status
+func claimActionRequest(c *gin.Context, userID uint, status string) (*models.ActionRequest, bool) {
+	var actionRequest models.ActionRequest
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&actionRequest).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Action request not found or not owned by you"})
+		return nil, false
+	}
+	expireActionRequest(&actionRequest)
+
+	// Only one decision wins, even when the owner decides from several devices at once
+	now := time.Now()
+	result := database.DB.Model(&models.ActionRequest{}).
+		Where("id = ? AND status = ?", actionRequest.ID, "pending").
+		Updates(map[string]interface{}{"status": status, "decided_at": now})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update action request"})
+		return nil, false
+	}
+	if result.RowsAffected == 0 {
+		database.DB.First(&actionRequest, "id = ?", actionRequest.ID)
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Action request is %s", actionRequest.Status)})
+		return nil, false
+	}
+
+	actionRequest.Status = status
+	actionRequest.DecidedAt = &now
+	return &actionRequest, true
+}
+
+// executeActionRequest calls the requested service with the given client
+func executeActionRequest(haClient *ha.Client, actionRequest *models.ActionRequest) error {
+	data := make(map[string]interface{})
+	if len(actionRequest.Data) > 0 {
+		if err := json.Unmarshal(actionRequest.Data, &data); err != nil {
+			return err
+		}
+	}
+	data["entity_id"] = actionRequest.EntityID
+
+	domain := strings.SplitN(actionRequest.EntityID, ".", 2)[0]
+	return haClient.CallService(domain, actionRequest.Service, data)
+}
+
+// finishActionRequest wakes up waiting streams and informs the requester about the decision
+func finishActionRequest(eventType string, actionRequest *models.ActionRequest) {
+	wakeActionWaiters(actionRequest.ID)
+	publishActionRequestEvent(eventType, actionRequest)
+
+	if actionRequest.RequesterID == 0 {
+		return
+	}
+	var requester models.User
+	if err := database.DB.First(&requester, actionRequest.RequesterID).Error; err != nil {
+		return
+	}
+	notifyUser(&requester, "action_request", "Action "+actionRequest.Status,
+		fmt.Sprintf("Your request to call %s on %s was %s", actionRequest.Service, actionRequest.EntityID, actionRequest.Status),
+		map[string]interface{}{
+			"action_request_id": actionRequest.ID,
+			"entity_id":         actionRequest.EntityID,
+		})
+}
+
+// streamActionRequest sends the status of an action request as server-sent events until it is decided
+func streamActionRequest(c *gin.Context, requestID string) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(actionStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		// Register before reading so a decision in between is not missed
+		wake, cancel := waitForActionRequest(requestID)
+
+		var actionRequest models.ActionRequest
+		if err := database.DB.First(&actionRequest, "id = ?", requestID).Error; err != nil {
+			cancel()
+			return
+		}
+		expireActionRequest(&actionRequest)
+
+		c.SSEvent("status", actionRequestStatus(&actionRequest))
+		c.Writer.Flush()
+
+		if actionRequest.Status != "pending" && actionRequest.Status != "approved" {
+			cancel()
+			return
+		}
+
+		expiry := time.NewTimer(time.Until(actionRequest.ExpiresAt) + time.Second)
+		select {
+		case <-wake:
+		case <-expiry.C:
+		case <-heartbeat.C:
+		case <-c.Request.Context().Done():
+			expiry.Stop()
+			cancel()
+			return
+		}
+		expiry.Stop()
+		cancel()
+	}
+}
+
+// actionRequestStatus is the view of an action request shown to requesters
+func actionRequestStatus(actionRequest *models.ActionRequest) gin.H {
+	status := gin.H{
+		"id":         actionRequest.ID,
+		"entity_id":  actionRequest.EntityID,
+		"service":    actionRequest.Service,
+		"status":     actionRequest.Status,
+		"expires_at": actionRequest.ExpiresAt,
+	}
+	if actionRequest.DecidedAt != nil {
+		status["decided_at"] = actionRequest.DecidedAt
+	}
+	if actionRequest.Error != "" {
+		status["error"] = actionRequest.Error
+	}
+	return status
+}
+
+// waitForActionRequest returns a channel that is closed when the action request is decided
+func waitForActionRequest(requestID string) (<-chan struct{}, func()) {
+	wake := make(chan struct{})
+
+	actionWaitersMu.Lock()
+	actionWaiters[requestID] = append(actionWaiters[requestID], wake)
+	actionWaitersMu.Unlock()
+
+	cancel := func() {
+		actionWaitersMu.Lock()
+		defer actionWaitersMu.Unlock()
+		waiters := actionWaiters[requestID]
+		for i, waiter := range waiters {
+			if waiter == wake {
+				actionWaiters[requestID] = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(actionWaiters[requestID]) == 0 {
+			delete(actionWaiters, requestID)
+		}
+	}
+	return wake, cancel
+}
+
+// wakeActionWaiters wakes up all streams waiting for the action request
+func wakeActionWaiters(requestID string) {
+	actionWaitersMu.Lock()
+	defer actionWaitersMu.Unlock()
+	for _, wake := range actionWaiters[requestID] {
+		close(wake)
+	}
+	delete(actionWaiters, requestID)
+}
+
+// expireActionRequest marks an undecided action request past its expiry as expired
+func expireActionRequest(actionRequest *models.ActionRequest) {
+	if actionRequest.Status != "pending" || time.Now().Before(actionRequest.ExpiresAt) {
+		return
+	}
+
+	result := database.DB.Model(&models.ActionRequest{}).
+		Where("id = ? AND status = ?", actionRequest.ID, "pending").
+		Update("status", "expired")
+	if result.Error != nil {
+		log.Printf("Failed to expire action request %s: %v", actionRequest.ID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		// Decided in the meantime
+		database.DB.First(actionRequest, "id = ?", actionRequest.ID)
+		return
+	}
+
+	actionRequest.Status = "expired"
+	finishActionRequest(events.ActionRequestExpired, actionRequest)
+}
+
+// expirePendingActionRequests marks all undecided action requests past their expiry as expired
+func expirePendingActionRequests() int {
+	var expired []models.ActionRequest
+	if err := database.DB.Where("status = ? AND expires_at < ?", "pending", time.Now()).Find(&expired).Error; err != nil {
+		log.Printf("Failed to find expired action requests: %v", err)
+		return 0
+	}
+
+	count := 0
+	for i := range expired {
+		expireActionRequest(&expired[i])
+		if expired[i].Status == "expired" {
+			count++
+		}
+	}
+	return count
+}
+
+// publishActionRequestEvent publishes an action request lifecycle event
+func publishActionRequestEvent(eventType string, actionRequest *models.ActionRequest) {
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: actionRequest.UserID,
+		Data: map[string]interface{}{
+			"action_request_id": actionRequest.ID,
+			"share_id":          actionRequest.ShareLinkID,
+			"entity_id":         actionRequest.EntityID,
+			"service":           actionRequest.Service,
+			"requester":         actionRequest.RequesterName,
+		},
+	})
+}
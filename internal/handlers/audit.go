@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const auditLogLimit = 100
+
+// GetShareLinkAudit lists the most recent audit log entries of a share link (owner only)
+func (h *Handler) GetShareLinkAudit(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	shareID := c.Param("id")
+
+	var shareLink models.ShareLink
+	if err := database.DB.Where("id = ? AND user_id = ?", shareID, userID).First(&shareLink).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not owned by you"})
+		return
+	}
+
+	var logs []models.AuditLog
+	if err := database.DB.Where("share_link_id = ? AND user_id = ?", shareID, userID).
+		Order("created_at DESC, id DESC").Limit(auditLogLimit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
+
+// recordAudit stores an audit log entry; failures are logged but never block the audited action
+func recordAudit(entry models.AuditLog, details map[string]interface{}) {
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			log.Printf("Failed to encode audit details for %s: %v", entry.Action, err)
+		} else {
+			entry.Details = data
+		}
+	}
+
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("Failed to record audit log for %s: %v", entry.Action, err)
+	}
+}
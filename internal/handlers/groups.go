@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxGroupNameLength = 80
+	maxGroupMembers    = 100
+)
+
+// groupResponse is a group as listed to a user
+type groupResponse struct {
+	models.Group
+	CanManage bool `json:"can_manage"`
+}
+
+// ListGroups returns the groups the user owns or belongs to, and every admin-managed group
+func (h *Handler) ListGroups(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	var groups []models.Group
+	if err := database.DB.Preload("Members.User").
+		Where("owner_id = ? OR admin_managed = ? OR id IN (?)", user.ID, true, userGroupIDs(user.ID)).
+		Order("name").Find(&groups).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
+		return
+	}
+
+	response := make([]groupResponse, 0, len(groups))
+	for _, group := range groups {
+		response = append(response, groupResponse{Group: group, CanManage: canManageGroup(user, &group)})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateGroup creates a group, optionally with its first members
+func (h *Handler) CreateGroup(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	var req struct {
+		Name         string `json:"name" binding:"required"`
+		AdminManaged bool   `json:"admin_managed"` // Admins only
+		MemberIDs    []uint `json:"member_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.AdminManaged && !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create admin-managed groups"})
+		return
+	}
+
+	name, err := normalizeGroupName(req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	memberIDs := uniqueIDs(req.MemberIDs)
+	if len(memberIDs) > maxGroupMembers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many members (max %d)", maxGroupMembers)})
+		return
+	}
+	var known int64
+	database.DB.Model(&models.User{}).Where("id IN ?", memberIDs).Count(&known)
+	if int(known) != len(memberIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user in member_ids"})
+		return
+	}
+
+	group := models.Group{
+		Name:         name,
+		OwnerID:      user.ID,
+		AdminManaged: req.AdminManaged,
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		for _, memberID := range memberIDs {
+			if err := tx.Create(&models.GroupMember{GroupID: group.ID, UserID: memberID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+
+	for _, memberID := range memberIDs {
+		if memberID != user.ID {
+			notifyGroupMember(memberID, &group, user)
+		}
+	}
+
+	database.DB.Preload("Members.User").First(&group, group.ID)
+	c.JSON(http.StatusCreated, groupResponse{Group: group, CanManage: true})
+}
+
+// UpdateGroup renames a group
+func (h *Handler) UpdateGroup(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	group, ok := findManagedGroup(c, user)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name, err := normalizeGroupName(req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	group.Name = name
+	if err := database.DB.Model(group).Update("name", name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update group"})
+		return
+	}
+
+	c.JSON(http.StatusOK, groupResponse{Group: *group, CanManage: true})
+}
+
+// DeleteGroup deletes a group together with its memberships and the shares with it
+func (h *Handler) DeleteGroup(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	group, ok := findManagedGroup(c, user)
+	if !ok {
+		return
+	}
+
+	var shares []models.SharedEntity
+	database.DB.Where("group_id = ?", group.ID).Find(&shares)
+	memberIDs := groupMemberIDs(group.ID)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		groupShares := tx.Model(&models.SharedEntity{}).Select("id").Where("group_id = ?", group.ID)
+		if err := tx.Where("shared_entity_id IN (?)", groupShares).Delete(&models.SharedEntityMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.SharedEntity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+
+	// Former members may have lost access to entities they reserved
+	for i := range shares {
+		h.releaseLostReservations(&shares[i], memberIDs)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
+}
+
+// AddGroupMember adds a user to a group. The user is invited to the entities shared with the group
+func (h *Handler) AddGroupMember(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+	group, ok := findManagedGroup(c, user)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID uint `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var member models.User
+	if err := database.DB.First(&member, req.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var existing int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, member.ID).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "User is already a member of the group"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ?", group.ID).Count(&count)
+	if count >= maxGroupMembers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many members (max %d)", maxGroupMembers)})
+		return
+	}
+
+	membership := models.GroupMember{GroupID: group.ID, UserID: member.ID}
+	if err := database.DB.Create(&membership).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add group member"})
+		return
+	}
+	if member.ID != user.ID {
+		notifyGroupMember(member.ID, group, user)
+	}
+
+	var shares []models.SharedEntity
+	database.DB.Preload("Owner").Where("group_id = ?", group.ID).Find(&shares)
+	for i := range shares {
+		inviteGroupMember(&shares[i], &shares[i].Owner, member.ID)
+	}
+
+	membership.User = member
+	c.JSON(http.StatusCreated, membership)
+}
+
+// RemoveGroupMember removes a user from a group. Members may also leave a group themselves
+func (h *Handler) RemoveGroupMember(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	var memberID uint
+	if _, err := fmt.Sscanf(c.Param("userId"), "%d", &memberID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", c.Param("id")).Error; err != nil ||
+		(memberID != user.ID && !canManageGroup(user, &group)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return
+	}
+
+	result := database.DB.Where("group_id = ? AND user_id = ?", group.ID, memberID).Delete(&models.GroupMember{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove group member"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of the group"})
+		return
+	}
+
+	// The membership ends at once, including reservations made through the group
+	groupShares := database.DB.Model(&models.SharedEntity{}).Select("id").Where("group_id = ?", group.ID)
+	database.DB.Where("user_id = ? AND shared_entity_id IN (?)", memberID, groupShares).Delete(&models.SharedEntityMember{})
+	var shares []models.SharedEntity
+	database.DB.Where("group_id = ?", group.ID).Find(&shares)
+	for i := range shares {
+		h.releaseLostReservations(&shares[i], []uint{memberID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Group member removed successfully"})
+}
+
+// findManagedGroup loads the group of the request and checks that the user may manage it
+func findManagedGroup(c *gin.Context, user *models.User) (*models.Group, bool) {
+	var group models.Group
+	if err := database.DB.First(&group, "id = ?", c.Param("id")).Error; err != nil || !canManageGroup(user, &group) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return nil, false
+	}
+	return &group, true
+}
+
+// canManageGroup reports whether the user may rename, delete and change the members of a group
+func canManageGroup(user *models.User, group *models.Group) bool {
+	if group.AdminManaged {
+		return user.IsAdmin
+	}
+	return group.OwnerID == user.ID
+}
+
+// canShareWithGroup reports whether the user may share entities with a group
+func canShareWithGroup(userID uint, group *models.Group) bool {
+	return group.AdminManaged || group.OwnerID == userID
+}
+
+// userGroupIDs is a subquery of the IDs of the groups a user belongs to
+func userGroupIDs(userID uint) *gorm.DB {
+	return database.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)
+}
+
+// groupMemberIDs returns the IDs of a group's members
+func groupMemberIDs(groupID uint) []uint {
+	var ids []uint
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ?", groupID).Pluck("user_id", &ids)
+	return ids
+}
+
+// sharedWithUser limits a query of user shares to those shared with the user directly or through a
+// group share the user accepted
+func sharedWithUser(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("shared_with = ? OR (group_id IN (?) AND id IN (?))", userID, userGroupIDs(userID), memberShareIDs(userID, "accepted"))
+	}
+}
+
+// releaseLostReservations cancels the reservations of users who no longer have access to the
+// entity of a removed share. Users still granted access by another share keep their reservations
+func (h *Handler) releaseLostReservations(share *models.SharedEntity, userIDs []uint) {
+	if share.EntityID == "" {
+		return
+	}
+	for _, userID := range userIDs {
+		if remaining, found := h.findUserShare(userID, share.EntityID); found && remaining.OwnerID == share.OwnerID {
+			continue
+		}
+		cancelUserReservations(share.OwnerID, userID, share.EntityID, "the entity is no longer shared with you")
+	}
+}
+
+// shareRecipients returns the users a share grants access to
+func shareRecipients(share *models.SharedEntity) []uint {
+	if share.GroupID != 0 {
+		return groupMemberIDs(share.GroupID)
+	}
+	return []uint{share.SharedWith}
+}
+
+// notifyGroupMember tells a user that they were added to a group
+func notifyGroupMember(userID uint, group *models.Group, by *models.User) {
+	var member models.User
+	if err := database.DB.First(&member, userID).Error; err != nil {
+		return
+	}
+	notifyUser(&member, "group_member", "Added to group",
+		fmt.Sprintf("%s added you to the group %s", by.Username, group.Name),
+		map[string]interface{}{"group_id": group.ID})
+}
+
+// normalizeGroupName trims and validates the name of a group
+func normalizeGroupName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("group name must not be empty")
+	}
+	if len(name) > maxGroupNameLength {
+		return "", fmt.Errorf("group name is too long (max %d characters)", maxGroupNameLength)
+	}
+	return name, nil
+}
+
+// uniqueIDs returns ids without duplicates and zeros, keeping their order
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if id != 0 && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -1,35 +1,56 @@
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ThraaxSession/Hash/internal/auth"
 	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
 	"github.com/ThraaxSession/Hash/internal/ha"
 	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/ThraaxSession/Hash/internal/redaction"
 	"github.com/gin-gonic/gin"
 	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
 )
 
 // Handler manages all HTTP handlers
 type Handler struct {
 	HAClient *ha.Client
+	Config   *models.Config
+
+	// Work started by requests that outlives them (e.g. action chains) stops with ctx and is tracked in jobs
+	ctx  context.Context
+	jobs *sync.WaitGroup
 }
 
 // NewHandler creates a new handler
-func NewHandler(haClient *ha.Client) *Handler {
+func NewHandler(haClient *ha.Client, cfg *models.Config) *Handler {
 	return &Handler{
 		HAClient: haClient,
+		Config:   cfg,
+		ctx:      context.Background(),
+		jobs:     &sync.WaitGroup{},
 	}
 }
 
+// SetBackgroundJobs ties background work started by requests to the context and wait group of the
+// server's background jobs, so it is cancelled and waited for on shutdown
+func (h *Handler) SetBackgroundJobs(ctx context.Context, jobs *sync.WaitGroup) {
+	h.ctx = ctx
+	h.jobs = jobs
+}
+
 // Login handles user login with username and password
 func (h *Handler) Login(c *gin.Context) {
 	var req struct {
@@ -102,6 +123,7 @@ func (h *Handler) Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	publishUserEvent(events.UserCreated, user)
 
 	// Generate JWT token
 	token, err := auth.GenerateToken(user)
@@ -230,6 +252,8 @@ func (h *Handler) GetUserSettings(c *gin.Context) {
 		"ha_url":                  user.HAURL,
 		"require_password_change": user.RequirePasswordChange,
 		"otp_enabled":             user.OTPEnabled,
+		"notify_service":          user.NotifyService,
+		"mqtt_key_set":            user.MQTTKey != "",
 	})
 }
 
@@ -331,11 +355,24 @@ func (h *Handler) CreateShareLink(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
 
 	var req struct {
-		EntityIDs  []string  `json:"entity_ids" binding:"required"`
-		Type       string    `json:"type" binding:"required"` // "permanent", "counter", "time"
-		AccessMode string    `json:"access_mode"`             // "readonly", "triggerable"
-		MaxAccess  int       `json:"max_access,omitempty"`
-		ExpiresAt  time.Time `json:"expires_at,omitempty"`
+		EntityIDs       []string               `json:"entity_ids"`              // Legacy input: entities sharing the link's access mode
+		Entries         []models.ShareEntry    `json:"entries"`                 // Entities with per-entity access rules
+		Selectors       []models.ShareSelector `json:"selectors"`               // Entities matched by pattern/domains at access time
+		Type            string                 `json:"type" binding:"required"` // "permanent", "counter", "time", "kiosk"
+		AccessMode      string                 `json:"access_mode"`             // "readonly", "triggerable"
+		MaxAccess       int                    `json:"max_access,omitempty"`
+		ExpiresAt       time.Time              `json:"expires_at,omitempty"`
+		Title           string                 `json:"title"`
+		Instructions    string                 `json:"instructions"` // Markdown
+		AttributeFilter models.AttributeFilter `json:"attribute_filter"`
+		IPRestriction   models.IPRestriction   `json:"ip_restriction"`
+		Geofence        models.Geofence        `json:"geofence"`
+		Embed           models.EmbedSettings   `json:"embed"`
+		RequireApproval bool                   `json:"require_approval"`
+		MaxDevices      int                    `json:"max_devices"` // Bind the link to the first N devices that open it
+		Conditions      models.ShareConditions `json:"conditions"`  // Home Assistant states the link is only active in
+		Schedule        models.ShareSchedule   `json:"schedule"`    // Weekly time windows the link works in
+		Action          models.ShareAction     `json:"action"`      // Makes it an action link performing a single service call
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -344,8 +381,8 @@ func (h *Handler) CreateShareLink(c *gin.Context) {
 	}
 
 	// Validate type
-	if req.Type != "permanent" && req.Type != "counter" && req.Type != "time" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type. Must be 'permanent', 'counter', or 'time'"})
+	if !isValidShareLinkType(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type. Must be 'permanent', 'counter', 'time', or 'kiosk'"})
 		return
 	}
 
@@ -358,32 +395,128 @@ func (h *Handler) CreateShareLink(c *gin.Context) {
 		return
 	}
 
-	// Generate unique ID
-	id := generateID()
+	if req.AttributeFilter.LocationPrecisionKm < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location_precision_km. Must not be negative"})
+		return
+	}
+
+	ipRestriction, err := normalizeIPRestriction(req.IPRestriction)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	geofence, err := normalizeGeofence(req.Geofence)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	embed, err := normalizeEmbedSettings(req.Embed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateMaxDevices(req.MaxDevices); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conditions, err := normalizeShareConditions(req.Conditions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	schedule, err := normalizeShareSchedule(req.Schedule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	action, err := normalizeShareAction(req.Action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Action links share exactly the entity of their action
+	if action.EntityID != "" {
+		req.Entries = actionLinkEntries(action, req.Entries)
+		req.EntityIDs = nil
+	}
+
+	// Sanitize guest-facing texts
+	title, err := sanitizeLine(req.Title, "title", maxTitleLength)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	instructions, err := sanitizeInstructions(req.Instructions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Convert entity IDs to JSON
-	entityIDsJSON, err := json.Marshal(req.EntityIDs)
+	// Build per-entity entries (entity_ids inherit the link's access mode)
+	entries, err := buildShareEntries(req.EntityIDs, req.Entries, req.AccessMode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	selectors, err := buildShareSelectors(req.Selectors, req.AccessMode)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process entity IDs"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(entries) == 0 && len(selectors) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one entity or selector is required"})
+		return
+	}
+
+	// Only entities allowed by the share entity policy may be exposed or targeted by chains with the owner's token
+	if status, denial := h.checkShareEntries(userID, entries); denial != nil {
+		c.JSON(status, denial)
 		return
 	}
 
+	// Generate unique ID
+	id := generateID()
+
 	shareLink := models.ShareLink{
-		ID:          id,
-		EntityIDs:   entityIDsJSON,
-		Type:        req.Type,
-		AccessMode:  req.AccessMode,
-		MaxAccess:   req.MaxAccess,
-		AccessCount: 0,
-		ExpiresAt:   req.ExpiresAt,
-		Active:      true,
-		UserID:      userID,
+		ID:              id,
+		Entries:         entries,
+		Selectors:       selectors,
+		Type:            req.Type,
+		AccessMode:      req.AccessMode,
+		MaxAccess:       req.MaxAccess,
+		AccessCount:     0,
+		ExpiresAt:       req.ExpiresAt,
+		Active:          true,
+		Title:           title,
+		Instructions:    instructions,
+		AttributeFilter: req.AttributeFilter,
+		IPRestriction:   ipRestriction,
+		Geofence:        geofence,
+		Embed:           embed,
+		RequireApproval: req.RequireApproval,
+		MaxDevices:      req.MaxDevices,
+		Conditions:      conditions,
+		Schedule:        schedule,
+		Action:          action,
+		KioskBindable:   req.Type == "kiosk", // Bound to the first device that opens it
+		UserID:          userID,
+	}
+
+	if err := validateKioskLink(&shareLink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateActionLink(&shareLink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	if err := database.DB.Create(&shareLink).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
 		return
 	}
+	publishShareLinkEvent(events.ShareLinkCreated, &shareLink)
 
 	c.JSON(http.StatusCreated, shareLink)
 }
@@ -393,59 +526,152 @@ func (h *Handler) GetShareLink(c *gin.Context) {
 	id := c.Param("id")
 
 	var shareLink models.ShareLink
-	if err := database.DB.Preload("User").First(&shareLink, "id = ?", id).Error; err != nil {
+	if err := database.DB.Preload("User").First(&shareLink, "id = ?", id).Error; err != nil || isActionLink(&shareLink) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
 		return
 	}
 
-	// Check if link is still valid
-	if !shareLink.Active {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Share link is no longer active"})
+	// Check validity, network restriction and owner approval
+	if status, denial := checkShareRules(c, &shareLink); denial != nil {
+		c.JSON(status, denial)
 		return
 	}
 
-	// Check counter-based restriction
-	if shareLink.Type == "counter" && shareLink.AccessCount >= shareLink.MaxAccess {
-		shareLink.Active = false
-		database.DB.Save(&shareLink)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Share link has reached maximum access count"})
+	// Bind the device to device-bound links on first use
+	if status, denial := h.bindShareDevice(c, &shareLink); denial != nil {
+		c.JSON(status, denial)
 		return
 	}
 
-	// Check time-based restriction
-	if shareLink.Type == "time" && time.Now().After(shareLink.ExpiresAt) {
-		shareLink.Active = false
-		database.DB.Save(&shareLink)
-		c.JSON(http.StatusForbidden, gin.H{"error": "Share link has expired"})
+	// Increment access count
+	recordShareAccess(&shareLink)
+
+	// Fetch current state of entities
+	entities, err := h.fetchShareEntities(&shareLink)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch entities"})
 		return
 	}
 
-	// Increment access count
-	shareLink.AccessCount++
-	database.DB.Save(&shareLink)
+	// Present entries in the owner's order
+	shareLink.Entries = sortedShareEntries(shareLink.Entries)
+
+	// Guests only learn that their location is required, not where the geofence is
+	shareLink.Geofence = models.Geofence{Enabled: shareLink.Geofence.Enabled, MaxAccuracy: shareLink.Geofence.MaxAccuracy}
+
+	// Nor which networks the owner allows or blocks
+	shareLink.IPRestriction = models.IPRestriction{}
+
+	// Action chains reveal the owner's other entities
+	for i := range shareLink.Entries {
+		shareLink.Entries[i].Chain = nil
+	}
+
+	// So do conditions, together with the states they wait for; guests only learn that there are some
+	conditional := len(shareLink.Conditions) > 0
+	shareLink.Conditions = nil
 
-	// Get entity IDs from JSON
-	var entityIDs []string
-	if err := json.Unmarshal(shareLink.EntityIDs, &entityIDs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process entity IDs"})
+	c.JSON(http.StatusOK, gin.H{
+		"entities":          entities,
+		"share":             shareLink,
+		"conditional":       conditional,
+		"access_mode":       shareAccessSummary(shareLink.Entries),
+		"sections":          shareSections(shareLink.Entries),
+		"instructions_html": renderInstructions(shareLink.Instructions),
+		"auto_revert":       pendingReverts(&shareLink),
+	})
+}
+
+// checkShareAccess applies the rules every guest view of a share link must pass and, for
+// device-bound and kiosk links, requires a bound device. It returns the status and body of the denial, or nil.
+func checkShareAccess(c *gin.Context, link *models.ShareLink) (int, gin.H) {
+	// Action links never show entities
+	if isActionLink(link) {
+		return http.StatusNotFound, gin.H{"error": "Share link not found"}
+	}
+	if status, denial := checkShareRules(c, link); denial != nil {
+		return status, denial
+	}
+	return checkShareDevice(c, link)
+}
+
+// checkShareRules checks a share link's validity, schedule, network restriction, owner approval and conditions.
+// The link's User must be loaded.
+// It returns the status and body of the denial, or nil.
+func checkShareRules(c *gin.Context, link *models.ShareLink) (int, gin.H) {
+	// Check if link is still valid
+	if !link.Active {
+		return http.StatusForbidden, gin.H{"error": "Share link is no longer active"}
+	}
+
+	// Check network restriction
+	if !allowsClientIP(link.IPRestriction, clientIP(c)) {
+		return http.StatusForbidden, gin.H{"error": "Access to this share link is not allowed from your network"}
+	}
+
+	// Check counter-based restriction
+	if link.Type == "counter" && link.AccessCount >= link.MaxAccess {
+		link.Active = false
+		database.DB.Save(link)
+		publishShareLinkEvent(events.ShareLinkExhausted, link)
+		return http.StatusForbidden, gin.H{"error": "Share link has reached maximum access count"}
+	}
+
+	// Check time-based restriction
+	if link.Type == "time" && time.Now().After(link.ExpiresAt) {
+		link.Active = false
+		database.DB.Save(link)
+		publishShareLinkEvent(events.ShareLinkExpired, link)
+		return http.StatusForbidden, gin.H{"error": "Share link has expired"}
+	}
+
+	// Check the weekly schedule
+	if !scheduleAllows(link.Schedule, time.Now()) {
+		return http.StatusForbidden, gin.H{"error": "Share link is not available at this time", "schedule": true}
+	}
+
+	// Check owner approval
+	if link.RequireApproval && !hasViewerSession(c, link) {
+		return http.StatusForbidden, gin.H{
+			"error":             "Access to this share link requires the owner's approval",
+			"approval_required": true,
+			"title":             link.Title,
+		}
+	}
+
+	// Check the owner's Home Assistant conditions
+	return checkShareConditions(&link.User, link.Conditions)
+}
+
+// recordShareAccess counts a guest view of a share link. Kiosk links are polled around the clock
+// and do not consume accesses.
+func recordShareAccess(link *models.ShareLink) {
+	if link.Type == "kiosk" {
 		return
 	}
+	link.AccessCount++
+	database.DB.Save(link)
+}
 
-	// Create HA client with user's token and URL
-	haClient := ha.NewClient(shareLink.User.HAURL, shareLink.User.HAToken)
+// fetchShareEntities fetches the current state of the shared entities with the owner's
+// Home Assistant credentials and strips sensitive attributes. Entities currently matched
+// by the link's selectors are added to its entries.
+func (h *Handler) fetchShareEntities(link *models.ShareLink) ([]*models.Entity, error) {
+	haClient := ha.NewClient(link.User.HAURL, link.User.HAToken)
+	entities, err := haClient.GetEntities(link.Entries.EntityIDs())
+	if err != nil {
+		return nil, err
+	}
 
-	// Fetch current state of entities
-	entities, err := haClient.GetEntities(entityIDs)
+	matched, err := h.resolveShareLinkEntries(link)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch entities"})
-		return
+		return nil, err
 	}
+	entities = append(entities, matched...)
 
-	c.JSON(http.StatusOK, gin.H{
-		"entities":    entities,
-		"share":       shareLink,
-		"access_mode": shareLink.AccessMode,
-	})
+	// Strip sensitive attributes before they leave the server
+	redaction.Entities(entities, link.AttributeFilter)
+	return entities, nil
 }
 
 // ListShareLinks lists all share links for the authenticated user
@@ -461,25 +687,54 @@ func (h *Handler) ListShareLinks(c *gin.Context) {
 	c.JSON(http.StatusOK, links)
 }
 
-// DeleteShareLink deletes a share link
+// DeleteShareLink deletes a share link together with its requests, devices, auto-revert jobs and audit log
 func (h *Handler) DeleteShareLink(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
 	id := c.Param("id")
 
-	result := database.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&models.ShareLink{})
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete share link"})
+	var shareLink models.ShareLink
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&shareLink).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteShareLink(tx, &shareLink)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete share link"})
 		return
 	}
+	publishShareLinkEvent(events.ShareLinkDeleted, &shareLink)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Share link deleted"})
 }
 
+// deleteShareLink deletes a share link and the records that belong to it. Its pending action requests
+// and auto-revert jobs are cancelled first, so a concurrent approval or the scheduler cannot run them
+func deleteShareLink(tx *gorm.DB, link *models.ShareLink) error {
+	if err := tx.Model(&models.ActionRequest{}).Where("share_link_id = ? AND status = ?", link.ID, "pending").
+		Update("status", "cancelled").Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.RevertJob{}).Where("share_link_id = ? AND status = ?", link.ID, "pending").
+		Update("status", "cancelled").Error; err != nil {
+		return err
+	}
+
+	for _, dependent := range []interface{}{
+		&models.AccessRequest{},
+		&models.ActionRequest{},
+		&models.ShareDevice{},
+		&models.RevertJob{},
+		&models.AuditLog{},
+	} {
+		if err := tx.Where("share_link_id = ?", link.ID).Delete(dependent).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(link).Error
+}
+
 // RefreshEntities refreshes all tracked entities from Home Assistant for all users
 func (h *Handler) RefreshEntities() error {
 	var users []models.User
@@ -500,10 +755,12 @@ func (h *Handler) RefreshEntities() error {
 		// Create HA client with user's token and URL
 		haClient := ha.NewClient(user.HAURL, user.HAToken)
 
-		// Get entity IDs
+		// Get entity IDs and the states known so far
 		entityIDs := make([]string, len(entities))
+		known := make(map[string]models.Entity, len(entities))
 		for i, entity := range entities {
 			entityIDs[i] = entity.EntityID
+			known[entity.EntityID] = entity
 		}
 
 		// Fetch updated entities
@@ -527,12 +784,147 @@ func (h *Handler) RefreshEntities() error {
 					"last_changed": updatedEntity.LastChanged,
 					"last_updated": updatedEntity.LastUpdated,
 				})
+
+			if previous, ok := known[updatedEntity.EntityID]; ok && entityChanged(&previous, updatedEntity) {
+				publishEntityStateEvent(user.ID, updatedEntity, previous.State)
+			}
+		}
+	}
+
+	return nil
+}
+
+// entityChanged reports whether Home Assistant updated an entity since it was last stored
+func entityChanged(previous, updated *models.Entity) bool {
+	return previous.State != updated.State || !previous.LastUpdated.Equal(updated.LastUpdated)
+}
+
+// publishEntityStateEvent announces a changed state of an entity tracked by the user.
+// Attributes are stripped of the built-in redactions as the event leaves Hassh
+func publishEntityStateEvent(userID uint, entity *models.Entity, oldState string) {
+	attributes, _ := entity.Attributes.ToMap()
+	events.Publish(events.Event{
+		Type:   events.EntityStateChanged,
+		UserID: userID,
+		Data: map[string]interface{}{
+			"entity_id":    entity.EntityID,
+			"state":        entity.State,
+			"old_state":    oldState,
+			"attributes":   redaction.Attributes(entity.EntityID, attributes, models.AttributeFilter{}),
+			"last_changed": entity.LastChanged,
+			"last_updated": entity.LastUpdated,
+		},
+	})
+}
+
+// SweepShareLinks deactivates expired and exhausted share links and, if purgeAfter is
+// positive, permanently deletes links that have been inactive for longer than purgeAfter
+func (h *Handler) SweepShareLinks(purgeAfter time.Duration) error {
+	now := time.Now()
+
+	// Deactivate time-based links past their expiry
+	var expired []models.ShareLink
+	if err := database.DB.Where("active = ? AND type = ? AND expires_at < ?", true, "time", now).Find(&expired).Error; err != nil {
+		return err
+	}
+	for i := range expired {
+		if err := database.DB.Model(&expired[i]).Update("active", false).Error; err != nil {
+			log.Printf("Failed to deactivate expired share link %s: %v", expired[i].ID, err)
+			continue
+		}
+		publishShareLinkEvent(events.ShareLinkExpired, &expired[i])
+	}
+
+	// Deactivate counter-based links that reached their maximum access count
+	var exhausted []models.ShareLink
+	if err := database.DB.Where("active = ? AND type = ? AND access_count >= max_access", true, "counter").Find(&exhausted).Error; err != nil {
+		return err
+	}
+	for i := range exhausted {
+		if err := database.DB.Model(&exhausted[i]).Update("active", false).Error; err != nil {
+			log.Printf("Failed to deactivate exhausted share link %s: %v", exhausted[i].ID, err)
+			continue
+		}
+		publishShareLinkEvent(events.ShareLinkExhausted, &exhausted[i])
+	}
+
+	if len(expired) > 0 || len(exhausted) > 0 {
+		log.Printf("Share sweeper: deactivated %d expired and %d exhausted share links", len(expired), len(exhausted))
+	}
+
+	// Expire access requests the owner did not decide in time
+	if count := expirePendingAccessRequests(); count > 0 {
+		log.Printf("Share sweeper: expired %d pending access requests", count)
+	}
+	if count := expirePendingActionRequests(); count > 0 {
+		log.Printf("Share sweeper: expired %d pending action requests", count)
+	}
+
+	if purgeAfter <= 0 {
+		return nil
+	}
+
+	// Purge links that have been inactive for too long
+	var stale []models.ShareLink
+	if err := database.DB.Where("active = ? AND updated_at < ?", false, now.Add(-purgeAfter)).Find(&stale).Error; err != nil {
+		return err
+	}
+	for i := range stale {
+		if err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return deleteShareLink(tx, &stale[i])
+		}); err != nil {
+			log.Printf("Failed to purge share link %s: %v", stale[i].ID, err)
+			continue
 		}
+		publishShareLinkEvent(events.ShareLinkDeleted, &stale[i])
+	}
+
+	if len(stale) > 0 {
+		log.Printf("Share sweeper: purged %d inactive share links", len(stale))
 	}
 
 	return nil
 }
 
+// publishShareLinkEvent publishes a share link lifecycle event for the link owner
+func publishShareLinkEvent(eventType string, link *models.ShareLink) {
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: link.UserID,
+		Data: map[string]interface{}{
+			"share_id":     link.ID,
+			"type":         link.Type,
+			"access_count": link.AccessCount,
+			"max_access":   link.MaxAccess,
+			"expires_at":   link.ExpiresAt,
+		},
+	})
+}
+
+// publishShareTriggerEvent announces a successful trigger of a share link's entity
+func publishShareTriggerEvent(link *models.ShareLink, entityID, service string) {
+	events.Publish(events.Event{
+		Type:   events.ShareLinkTriggered,
+		UserID: link.UserID,
+		Data: map[string]interface{}{
+			"share_id":  link.ID,
+			"entity_id": entityID,
+			"service":   service,
+		},
+	})
+}
+
+// publishUserEvent announces a change of a user account
+func publishUserEvent(eventType string, user *models.User) {
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: user.ID,
+		Data: map[string]interface{}{
+			"username": user.Username,
+		},
+	})
+}
+
 // GetAllHAEntities fetches all available entities from Home Assistant for the authenticated user
 func (h *Handler) GetAllHAEntities(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
@@ -561,8 +953,9 @@ func (h *Handler) TriggerEntity(c *gin.Context) {
 	entityID := c.Param("entityId")
 
 	var req struct {
-		Service string                 `json:"service" binding:"required"`
-		Data    map[string]interface{} `json:"data"`
+		Service  string                 `json:"service" binding:"required"`
+		Data     map[string]interface{} `json:"data"`
+		Position *geoPosition           `json:"position"` // Guest's position, required for geofenced links
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -570,69 +963,130 @@ func (h *Handler) TriggerEntity(c *gin.Context) {
 		return
 	}
 
-	// Load share link with user
+	// Load share link with user (action links only run their action, through /a/:id)
 	var shareLink models.ShareLink
-	if err := database.DB.Preload("User").First(&shareLink, "id = ?", shareID).Error; err != nil {
+	if err := database.DB.Preload("User").First(&shareLink, "id = ?", shareID).Error; err != nil || isActionLink(&shareLink) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
 		return
 	}
 
-	// Check if link is active
-	if !shareLink.Active {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Share link is no longer active"})
+	// Apply the rules of viewing the link, including its access limits and bound devices
+	if status, denial := checkShareAccess(c, &shareLink); denial != nil {
+		c.JSON(status, denial)
 		return
 	}
 
-	// Check access mode
-	if shareLink.AccessMode != "triggerable" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "This share link is read-only"})
+	// Check if entity is in the shared entity list (or currently matched by a selector)
+	entry, found, err := h.findShareEntry(&shareLink, entityID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to resolve shared entities: " + err.Error()})
 		return
 	}
-
-	// Check if entity is in the shared entity list
-	var entityIDs []string
-	if err := json.Unmarshal(shareLink.EntityIDs, &entityIDs); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process entity IDs"})
+	if !found {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Entity not included in this share"})
 		return
 	}
 
-	found := false
-	for _, id := range entityIDs {
-		if id == entityID {
-			found = true
-			break
-		}
+	// Check the entity's access mode and allowed services
+	if entry.AccessMode != "triggerable" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This entity is read-only"})
+		return
 	}
 
-	if !found {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Entity not included in this share"})
+	if !entry.AllowsService(req.Service) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Service not allowed for this entity"})
 		return
 	}
 
-	// Parse domain and service from entity_id (e.g., "light.living_room" -> domain: "light")
-	parts := strings.Split(entityID, ".")
-	if len(parts) < 2 {
+	// The domain of the service is taken from entity_id (e.g., "light.living_room" -> domain: "light")
+	if !strings.Contains(entityID, ".") {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID format"})
 		return
 	}
-	domain := parts[0]
 
 	// Create HA client with share owner's token
 	haClient := ha.NewClient(shareLink.User.HAURL, shareLink.User.HAToken)
 
+	// Check the guest's position against the geofence
+	if shareLink.Geofence.Enabled {
+		check, err := checkGeofence(haClient, shareLink.Geofence, req.Position)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to resolve geofence: " + err.Error()})
+			return
+		}
+
+		auditGeofenceCheck(c, &shareLink, entityID, req.Service, req.Position, check)
+		if !check.Allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": check.Reason, "geofence": true})
+			return
+		}
+	}
+
 	// Add entity_id to service data
 	if req.Data == nil {
 		req.Data = make(map[string]interface{})
 	}
 	req.Data["entity_id"] = entityID
 
+	// Sensitive entities wait for the owner's approval
+	if entry.RequiresApproval {
+		requesterName := "Guest"
+		if session, ok := viewerSession(c, &shareLink); ok {
+			requesterName = session.Name
+		}
+		actionRequest, err := h.createActionRequest(clientIP(c).String(), &shareLink.User, models.ActionRequest{
+			ShareLinkID:   shareLink.ID,
+			RequesterName: requesterName,
+			EntityID:      entityID,
+			Service:       req.Service,
+		}, req.Data)
+		respondActionRequestCreated(c, actionRequest, err)
+		return
+	}
+
 	// Call service
-	if err := haClient.CallService(domain, req.Service, req.Data); err != nil {
+	if err := callEntityService(haClient, entityID, req.Service, req.Data); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to trigger entity: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Entity triggered successfully"})
+	// Schedule the entry's auto-revert (e.g. turn the sauna off again) and start its action chain
+	response := gin.H{"message": "Entity triggered successfully"}
+	if job := scheduleRevert(&shareLink, *entry, req.Service); job != nil {
+		response["auto_revert_at"] = job.DueAt
+	}
+	if runID := h.startActionChain(&shareLink, *entry, req.Service, clientIP(c).String()); runID != "" {
+		response["chain"] = gin.H{"run_id": runID, "steps": len(entry.Chain.Steps)}
+	}
+	publishShareTriggerEvent(&shareLink, entityID, req.Service)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// findShareEntry returns the entry of a share link for an entity, including entities currently matched by its selectors
+func (h *Handler) findShareEntry(link *models.ShareLink, entityID string) (*models.ShareEntry, bool, error) {
+	entry, found := link.Entries.Find(entityID)
+	if !found && len(link.Selectors) > 0 {
+		if _, err := h.resolveShareLinkEntries(link); err != nil {
+			return entry, false, err
+		}
+		entry, found = link.Entries.Find(entityID)
+	}
+	return entry, found, nil
+}
+
+// callEntityService calls a service of the entity's domain on the entity. It is the trigger path shared by
+// share links, action links and webhooks; data is targeted at the entity.
+func callEntityService(haClient *ha.Client, entityID, service string, data map[string]interface{}) error {
+	domain, _, found := strings.Cut(entityID, ".")
+	if !found {
+		return fmt.Errorf("invalid entity ID %q", entityID)
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["entity_id"] = entityID
+	return haClient.CallService(domain, service, data)
 }
 
 // Admin endpoints
@@ -690,6 +1144,7 @@ func (h *Handler) CreateUserByAdmin(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	publishUserEvent(events.UserCreated, user)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"user":               user,
@@ -724,10 +1179,83 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 		}
 	}
 
-	// Delete user's entities and share links
+	// Delete the user's share links together with their requests, devices, auto-revert jobs and audit log
+	var links []models.ShareLink
+	if err := database.DB.Where("user_id = ?", userID).Find(&links).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share links of user"})
+		return
+	}
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range links {
+			if err := deleteShareLink(tx, &links[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete share links of user"})
+		return
+	}
+	for i := range links {
+		publishShareLinkEvent(events.ShareLinkDeleted, &links[i])
+	}
+
+	// Shares the user owns, receives or gets through a group, with the users losing access by them
+	ownGroups := database.DB.Model(&models.Group{}).Select("id").Where("owner_id = ? AND admin_managed = ?", userID, false)
+	var removed, memberShares []models.SharedEntity
+	database.DB.Where("owner_id = ? OR shared_with = ? OR group_id IN (?)", userID, userID, ownGroups).Find(&removed)
+	database.DB.Where("owner_id != ? AND group_id IN (?)", userID, userGroupIDs(userID)).Find(&memberShares)
+	recipients := make([][]uint, len(removed))
+	for i := range removed {
+		recipients[i] = shareRecipients(&removed[i])
+	}
+
+	// Delete user's entities, shares, groups and webhooks
 	database.DB.Where("user_id = ?", userID).Delete(&models.Entity{})
-	database.DB.Where("user_id = ?", userID).Delete(&models.ShareLink{})
+	removedShares := database.DB.Model(&models.SharedEntity{}).Select("id").Where("owner_id = ? OR group_id IN (?)", userID, ownGroups)
+	database.DB.Where("user_id = ? OR shared_entity_id IN (?)", userID, removedShares).Delete(&models.SharedEntityMember{})
 	database.DB.Where("owner_id = ? OR shared_with = ?", userID, userID).Delete(&models.SharedEntity{})
+	database.DB.Where("user_id = ?", userID).Delete(&models.GroupMember{})
+	database.DB.Where("group_id IN (?)", ownGroups).Delete(&models.SharedEntity{})
+	database.DB.Where("group_id IN (?)", ownGroups).Delete(&models.GroupMember{})
+	database.DB.Where("owner_id = ? AND admin_managed = ?", userID, false).Delete(&models.Group{})
+	database.DB.Where("user_id = ?", userID).Delete(&models.Webhook{})
+	database.DB.Where("user_id = ?", userID).Delete(&models.WebhookSubscription{})
+	database.DB.Where("user_id = ?", userID).Delete(&models.WebhookDelivery{})
+
+	// Release the reservations made through the removed shares and group memberships, then cancel
+	// the remaining ones of the user and of the user's entities (e.g. reserved through a selector)
+	for i := range removed {
+		h.releaseLostReservations(&removed[i], recipients[i])
+	}
+	for i := range memberShares {
+		h.releaseLostReservations(&memberShares[i], []uint{userID})
+	}
+	var reservations []models.Reservation
+	database.DB.Preload("User").Where("(user_id = ? OR owner_id = ?) AND status = ?", userID, userID, "active").Find(&reservations)
+	for i := range reservations {
+		if !claimReservation(&reservations[i], "cancelled") {
+			continue
+		}
+		if reservations[i].UserID == userID {
+			finishReservation(&reservations[i], "cancelled", "the user's account was deleted", false)
+		} else {
+			finishReservation(&reservations[i], "cancelled", "the owner's account was deleted", true)
+		}
+	}
+
+	// Delete the user's reservations, notifications, requests and auto-revert jobs
+	database.DB.Where("user_id = ? OR owner_id = ?", userID, userID).Delete(&models.Reservation{})
+	database.DB.Where("user_id = ? OR requester_id = ?", userID, userID).Delete(&models.ActionRequest{})
+	for _, dependent := range []interface{}{
+		&models.Notification{},
+		&models.AccessRequest{},
+		&models.RevertJob{},
+		&models.ShareDevice{},
+		&models.AuditLog{},
+	} {
+		database.DB.Where("user_id = ?", userID).Delete(dependent)
+	}
 
 	// Delete user
 	if err := database.DB.Delete(&user).Error; err != nil {
@@ -791,11 +1319,21 @@ func (h *Handler) ToggleUserAdmin(c *gin.Context) {
 // ShareEntityWithUser shares an entity with another user
 func (h *Handler) ShareEntityWithUser(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
+	owner := c.MustGet("user").(*models.User)
 
 	var req struct {
-		EntityID   string `json:"entity_id" binding:"required"`
-		SharedWith uint   `json:"shared_with_id" binding:"required"`
-		AccessMode string `json:"access_mode"`
+		EntityID         string                  `json:"entity_id"`
+		Pattern          string                  `json:"pattern"` // Share every matching entity instead of entity_id
+		Domains          []string                `json:"domains"`
+		SharedWith       uint                    `json:"shared_with_id"`
+		GroupID          uint                    `json:"group_id"` // Share with a group instead of shared_with_id
+		AccessMode       string                  `json:"access_mode"`
+		AttributeFilter  *models.AttributeFilter `json:"attribute_filter"`
+		RequiresApproval *bool                   `json:"requires_approval"`
+		Conditions       *models.ShareConditions `json:"conditions"` // Home Assistant states the share is only active in
+		ExpiresAt        *string                 `json:"expires_at"` // RFC3339, empty for no expiry
+		Schedule         *models.ShareSchedule   `json:"schedule"`   // Weekly time windows the share works in
+		Message          *string                 `json:"message"`    // Shown to the user with the invitation
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -814,30 +1352,135 @@ func (h *Handler) ShareEntityWithUser(c *gin.Context) {
 		return
 	}
 
+	if req.AttributeFilter != nil && req.AttributeFilter.LocationPrecisionKm < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location_precision_km. Must not be negative"})
+		return
+	}
+
+	var conditions models.ShareConditions
+	if req.Conditions != nil {
+		normalized, err := normalizeShareConditions(*req.Conditions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		conditions = normalized
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil {
+		parsed, err := parseUserShareExpiry(*req.ExpiresAt, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		expiresAt = parsed
+	}
+
+	var schedule models.ShareSchedule
+	if req.Schedule != nil {
+		normalized, err := normalizeShareSchedule(*req.Schedule)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		schedule = normalized
+	}
+
+	if req.Message != nil && len(*req.Message) > maxShareMessageLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Message is too long (max %d characters)", maxShareMessageLength)})
+		return
+	}
+
+	// Share with either a user or a group
+	if (req.SharedWith == 0) == (req.GroupID == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either shared_with_id or group_id is required"})
+		return
+	}
+	if req.GroupID != 0 {
+		var group models.Group
+		if err := database.DB.First(&group, req.GroupID).Error; err != nil || !canShareWithGroup(userID, &group) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Target group not found"})
+			return
+		}
+	}
+
 	// Check if target user exists
 	var targetUser models.User
-	if err := database.DB.First(&targetUser, req.SharedWith).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Target user not found"})
-		return
+	if req.SharedWith != 0 {
+		if err := database.DB.First(&targetUser, req.SharedWith).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Target user not found"})
+			return
+		}
 	}
 
-	// Check if entity belongs to user
-	var entity models.Entity
-	if err := database.DB.Where("entity_id = ? AND user_id = ?", req.EntityID, userID).First(&entity).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found or not owned by you"})
+	// Share either a single entity or every entity matching a selector
+	selector := models.EntitySelector{Pattern: req.Pattern, Domains: req.Domains}
+	if selector.IsEmpty() == (req.EntityID == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either entity_id or a pattern/domains selector is required"})
 		return
 	}
 
-	// Check if already shared
 	var existingShare models.SharedEntity
-	result := database.DB.Where("entity_id = ? AND owner_id = ? AND shared_with = ?", req.EntityID, userID, req.SharedWith).First(&existingShare)
-	if result.Error == nil {
+	var lookupErr error
+	if req.EntityID != "" {
+		// Check if entity belongs to user
+		var entity models.Entity
+		if err := database.DB.Where("entity_id = ? AND user_id = ?", req.EntityID, userID).First(&entity).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entity not found or not owned by you"})
+			return
+		}
+
+		// Check if already shared
+		lookupErr = database.DB.Where("entity_id = ? AND owner_id = ? AND shared_with = ? AND group_id = ?", req.EntityID, userID, req.SharedWith, req.GroupID).First(&existingShare).Error
+	} else {
+		// Matches are resolved, and checked against the share entity policy, at access time
+		normalized, err := normalizeEntitySelector(selector)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		selector = normalized
+
+		// Check if the same selector is already shared
+		lookupErr = database.DB.Where("entity_id = ? AND owner_id = ? AND shared_with = ? AND group_id = ? AND selector = ?", "", userID, req.SharedWith, req.GroupID, selector).First(&existingShare).Error
+	}
+	if lookupErr == nil {
 		// Update existing share
 		existingShare.AccessMode = req.AccessMode
+		if req.AttributeFilter != nil {
+			existingShare.AttributeFilter = *req.AttributeFilter
+		}
+		if req.RequiresApproval != nil {
+			existingShare.RequiresApproval = *req.RequiresApproval
+		}
+		if req.Conditions != nil {
+			existingShare.Conditions = conditions
+		}
+		if req.ExpiresAt != nil {
+			existingShare.ExpiresAt = expiresAt
+		}
+		if req.Schedule != nil {
+			existingShare.Schedule = schedule
+		}
+		if req.Message != nil {
+			existingShare.Message = strings.TrimSpace(*req.Message)
+		}
+		// Sharing again invites users who declined or left once more
+		reinvite := existingShare.Status == "declined" || existingShare.Status == "left"
+		if reinvite {
+			existingShare.Status = "pending"
+			existingShare.RespondedAt = nil
+		}
 		if err := database.DB.Save(&existingShare).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update shared entity"})
 			return
 		}
+		if existingShare.GroupID != 0 {
+			inviteGroupToShare(&existingShare, owner)
+		} else if reinvite {
+			inviteToShare(&existingShare, owner, &targetUser)
+		}
 		c.JSON(http.StatusOK, gin.H{"message": "Shared entity updated", "share": existingShare})
 		return
 	}
@@ -847,13 +1490,38 @@ func (h *Handler) ShareEntityWithUser(c *gin.Context) {
 		EntityID:   req.EntityID,
 		OwnerID:    userID,
 		SharedWith: req.SharedWith,
+		GroupID:    req.GroupID,
 		AccessMode: req.AccessMode,
+		Selector:   selector,
+	}
+	if req.AttributeFilter != nil {
+		sharedEntity.AttributeFilter = *req.AttributeFilter
+	}
+	if req.RequiresApproval != nil {
+		sharedEntity.RequiresApproval = *req.RequiresApproval
+	}
+	sharedEntity.Conditions = conditions
+	sharedEntity.ExpiresAt = expiresAt
+	sharedEntity.Schedule = schedule
+	if req.Message != nil {
+		sharedEntity.Message = strings.TrimSpace(*req.Message)
+	}
+
+	// Users accept shares before they show up; members of a group accept shares with the group each
+	sharedEntity.Status = "accepted"
+	if req.SharedWith != 0 {
+		sharedEntity.Status = "pending"
 	}
 
 	if err := database.DB.Create(&sharedEntity).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to share entity"})
 		return
 	}
+	if sharedEntity.GroupID != 0 {
+		inviteGroupToShare(&sharedEntity, owner)
+	} else {
+		inviteToShare(&sharedEntity, owner, &targetUser)
+	}
 
 	c.JSON(http.StatusCreated, sharedEntity)
 }
@@ -862,13 +1530,17 @@ func (h *Handler) ShareEntityWithUser(c *gin.Context) {
 func (h *Handler) GetSharedWithMe(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
 
+	now := time.Now()
 	var sharedEntities []models.SharedEntity
-	if err := database.DB.Preload("Owner").Where("shared_with = ?", userID).Find(&sharedEntities).Error; err != nil {
+	if err := database.DB.Preload("Owner").Preload("Group").Scopes(activeUserShares(now), sharedWithUser(userID)).Order("group_id").Find(&sharedEntities).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shared entities"})
 		return
 	}
+	annotateUserShares(sharedEntities, now)
 
-	c.JSON(http.StatusOK, sharedEntities)
+	// List the entities currently matched by selector shares individually, once per owner even
+	// when shared with the user and with their groups
+	c.JSON(http.StatusOK, mergeUserShares(h.expandSelectorShares(sharedEntities), now))
 }
 
 // GetMyShares returns entities current user has shared with others
@@ -876,10 +1548,11 @@ func (h *Handler) GetMyShares(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
 
 	var sharedEntities []models.SharedEntity
-	if err := database.DB.Preload("SharedUser").Where("owner_id = ?", userID).Find(&sharedEntities).Error; err != nil {
+	if err := database.DB.Preload("SharedUser").Preload("Group").Preload("Members.User").Where("owner_id = ?", userID).Find(&sharedEntities).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch shared entities"})
 		return
 	}
+	annotateUserShares(sharedEntities, time.Now())
 
 	c.JSON(http.StatusOK, sharedEntities)
 }
@@ -906,6 +1579,10 @@ func (h *Handler) UnshareEntity(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unshare entity"})
 		return
 	}
+	database.DB.Where("shared_entity_id = ?", sharedEntity.ID).Delete(&models.SharedEntityMember{})
+
+	// The user's reservations would keep blocking the others
+	h.releaseLostReservations(&sharedEntity, shareRecipients(&sharedEntity))
 
 	c.JSON(http.StatusOK, gin.H{"message": "Entity unshared successfully"})
 }
@@ -915,13 +1592,23 @@ func (h *Handler) GetSharedEntityState(c *gin.Context) {
 	userID := c.MustGet("userID").(uint)
 	entityID := c.Param("entityId")
 
-	// Check if entity is shared with the user
-	var sharedEntity models.SharedEntity
-	if err := database.DB.Preload("Owner").Where("entity_id = ? AND shared_with = ?", entityID, userID).First(&sharedEntity).Error; err != nil {
+	// Check if entity is shared with the user, directly or through a selector
+	sharedEntity, found := h.findUserShare(userID, entityID)
+	if !found {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Entity not shared with you or not found"})
 		return
 	}
 
+	// Check the share's schedule and the owner's Home Assistant conditions
+	if status, denial := checkUserShareSchedule(sharedEntity, time.Now()); denial != nil {
+		c.JSON(status, denial)
+		return
+	}
+	if status, denial := checkShareConditions(&sharedEntity.Owner, sharedEntity.Conditions); denial != nil {
+		c.JSON(status, denial)
+		return
+	}
+
 	// Create HA client with owner's credentials
 	haClient := ha.NewClient(sharedEntity.Owner.HAURL, sharedEntity.Owner.HAToken)
 
@@ -932,6 +1619,9 @@ func (h *Handler) GetSharedEntityState(c *gin.Context) {
 		return
 	}
 
+	// Strip sensitive attributes before they leave the server
+	redaction.Entity(entity, sharedEntity.AttributeFilter)
+
 	c.JSON(http.StatusOK, gin.H{
 		"entity":      entity,
 		"access_mode": sharedEntity.AccessMode,
@@ -941,7 +1631,7 @@ func (h *Handler) GetSharedEntityState(c *gin.Context) {
 
 // TriggerSharedEntity triggers an action on an entity shared with the user
 func (h *Handler) TriggerSharedEntity(c *gin.Context) {
-	userID := c.MustGet("userID").(uint)
+	user := c.MustGet("user").(*models.User)
 	entityID := c.Param("entityId")
 
 	var req struct {
@@ -954,24 +1644,40 @@ func (h *Handler) TriggerSharedEntity(c *gin.Context) {
 		return
 	}
 
-	// Check if entity is shared with the user and is triggerable
-	var sharedEntity models.SharedEntity
-	if err := database.DB.Preload("Owner").Where("entity_id = ? AND shared_with = ?", entityID, userID).First(&sharedEntity).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Entity not shared with you or not found"})
-		return
+	c.JSON(h.triggerSharedEntity(user, entityID, req.Service, req.Data, clientIP(c).String()))
+}
+
+// triggerSharedEntity calls a service on an entity shared with the user after checking the
+// share's access mode, conditions and reservations. It is shared by the API and the MQTT bridge
+func (h *Handler) triggerSharedEntity(user *models.User, entityID, service string, data map[string]interface{}, requestIP string) (int, gin.H) {
+	// Check if entity is shared with the user (directly or through a selector) and is triggerable
+	sharedEntity, found := h.findUserShare(user.ID, entityID)
+	if !found {
+		return http.StatusNotFound, gin.H{"error": "Entity not shared with you or not found"}
 	}
 
 	// Check access mode
 	if sharedEntity.AccessMode != "triggerable" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "This entity is read-only"})
-		return
+		return http.StatusForbidden, gin.H{"error": "This entity is read-only"}
+	}
+
+	// Check the share's schedule and the owner's Home Assistant conditions
+	if status, denial := checkUserShareSchedule(sharedEntity, time.Now()); denial != nil {
+		return status, denial
+	}
+	if status, denial := checkShareConditions(&sharedEntity.Owner, sharedEntity.Conditions); denial != nil {
+		return status, denial
+	}
+
+	// Reserved entities can only be triggered by the user holding the reservation
+	if status, denial := checkReservation(sharedEntity.OwnerID, entityID, user.ID); denial != nil {
+		return status, denial
 	}
 
 	// Parse domain from entity_id (e.g., "light.living_room" -> domain: "light")
 	parts := strings.Split(entityID, ".")
 	if len(parts) < 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity ID format"})
-		return
+		return http.StatusBadRequest, gin.H{"error": "Invalid entity ID format"}
 	}
 	domain := parts[0]
 
@@ -979,18 +1685,39 @@ func (h *Handler) TriggerSharedEntity(c *gin.Context) {
 	haClient := ha.NewClient(sharedEntity.Owner.HAURL, sharedEntity.Owner.HAToken)
 
 	// Add entity_id to service data
-	if req.Data == nil {
-		req.Data = make(map[string]interface{})
+	if data == nil {
+		data = make(map[string]interface{})
 	}
-	req.Data["entity_id"] = entityID
+	data["entity_id"] = entityID
 
-	// Call service
-	if err := haClient.CallService(domain, req.Service, req.Data); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to trigger entity: " + err.Error()})
-		return
+	// Sensitive entities wait for the owner's approval
+	if sharedEntity.RequiresApproval {
+		actionRequest, err := h.createActionRequest(requestIP, &sharedEntity.Owner, models.ActionRequest{
+			SharedEntityID: sharedEntity.ID,
+			RequesterID:    user.ID,
+			RequesterName:  user.Username,
+			EntityID:       entityID,
+			Service:        service,
+		}, data)
+		return actionRequestCreated(actionRequest, err)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Entity triggered successfully"})
+	// Call service
+	if err := haClient.CallService(domain, service, data); err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to trigger entity: " + err.Error()}
+	}
+	events.Publish(events.Event{
+		Type:   events.SharedEntityTriggered,
+		UserID: sharedEntity.OwnerID,
+		Data: map[string]interface{}{
+			"shared_entity_id": sharedEntity.ID,
+			"entity_id":        entityID,
+			"service":          service,
+			"user_id":          user.ID,
+		},
+	})
+
+	return http.StatusOK, gin.H{"message": "Entity triggered successfully"}
 }
 
 // UpdateShareLink updates an existing share link
@@ -999,11 +1726,24 @@ func (h *Handler) UpdateShareLink(c *gin.Context) {
 	shareID := c.Param("id")
 
 	var req struct {
-		EntityIDs  []string `json:"entity_ids"`
-		Type       string   `json:"type"`
-		AccessMode string   `json:"access_mode"`
-		MaxAccess  int      `json:"max_access"`
-		ExpiresAt  string   `json:"expires_at"`
+		EntityIDs       []string                `json:"entity_ids"`
+		Entries         []models.ShareEntry     `json:"entries"`
+		Selectors       *[]models.ShareSelector `json:"selectors"`
+		Type            string                  `json:"type"`
+		AccessMode      string                  `json:"access_mode"`
+		MaxAccess       int                     `json:"max_access"`
+		ExpiresAt       string                  `json:"expires_at"`
+		Title           *string                 `json:"title"`
+		Instructions    *string                 `json:"instructions"`
+		AttributeFilter *models.AttributeFilter `json:"attribute_filter"`
+		IPRestriction   *models.IPRestriction   `json:"ip_restriction"`
+		Geofence        *models.Geofence        `json:"geofence"`
+		Embed           *models.EmbedSettings   `json:"embed"`
+		RequireApproval *bool                   `json:"require_approval"`
+		MaxDevices      *int                    `json:"max_devices"`
+		Conditions      *models.ShareConditions `json:"conditions"` // An empty list removes all conditions
+		Schedule        *models.ShareSchedule   `json:"schedule"`   // No windows removes the schedule
+		Action          *models.ShareAction     `json:"action"`     // Only for action links
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -1019,25 +1759,81 @@ func (h *Handler) UpdateShareLink(c *gin.Context) {
 	}
 
 	// Update fields
-	if len(req.EntityIDs) > 0 {
-		entityIDsJSON, err := json.Marshal(req.EntityIDs)
+	if req.AccessMode != "" {
+		if !isValidAccessMode(req.AccessMode) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid access mode"})
+			return
+		}
+		shareLink.AccessMode = req.AccessMode
+	}
+
+	if req.Action != nil {
+		if !isActionLink(&shareLink) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only action links have an action"})
+			return
+		}
+		action, err := normalizeShareAction(*req.Action)
+		if err != nil || action.EntityID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action: an entity_id and service are required"})
+			return
+		}
+		shareLink.Action = action
+	}
+
+	// Action links share exactly the entity of their action
+	if isActionLink(&shareLink) && (req.Action != nil || req.EntityIDs != nil || req.Entries != nil) {
+		req.Entries = actionLinkEntries(shareLink.Action, append(req.Entries, shareLink.Entries...))
+		req.EntityIDs = nil
+	}
+
+	if req.EntityIDs != nil || req.Entries != nil {
+		entries, err := buildShareEntries(req.EntityIDs, req.Entries, shareLink.AccessMode)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity IDs"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if status, denial := h.checkShareEntries(userID, entries); denial != nil {
+			c.JSON(status, denial)
 			return
 		}
-		shareLink.EntityIDs = models.JSON(entityIDsJSON)
+		shareLink.Entries = entries
+	} else if req.AccessMode != "" {
+		// Legacy clients change the access mode of the whole link
+		for i := range shareLink.Entries {
+			shareLink.Entries[i].AccessMode = req.AccessMode
+		}
+		if req.Selectors == nil {
+			for i := range shareLink.Selectors {
+				shareLink.Selectors[i].AccessMode = req.AccessMode
+			}
+		}
 	}
 
-	if req.Type != "" {
-		shareLink.Type = req.Type
+	if req.Selectors != nil {
+		selectors, err := buildShareSelectors(*req.Selectors, shareLink.AccessMode)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.Selectors = selectors
 	}
 
-	if req.AccessMode != "" {
-		if req.AccessMode != "readonly" && req.AccessMode != "triggerable" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid access mode"})
+	if len(shareLink.Entries) == 0 && len(shareLink.Selectors) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one entity or selector is required"})
+		return
+	}
+
+	if req.Type != "" {
+		if !isValidShareLinkType(req.Type) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type. Must be 'permanent', 'counter', 'time', or 'kiosk'"})
 			return
 		}
-		shareLink.AccessMode = req.AccessMode
+		// Links turned into kiosk links are bound to the next device that opens them
+		if req.Type == "kiosk" && shareLink.Type != "kiosk" {
+			shareLink.KioskBindable = true
+		}
+		shareLink.Type = req.Type
 	}
 
 	if req.Type == "counter" && req.MaxAccess > 0 {
@@ -1053,6 +1849,99 @@ func (h *Handler) UpdateShareLink(c *gin.Context) {
 		shareLink.ExpiresAt = expiresAt
 	}
 
+	if req.Title != nil {
+		title, err := sanitizeLine(*req.Title, "title", maxTitleLength)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.Title = title
+	}
+
+	if req.Instructions != nil {
+		instructions, err := sanitizeInstructions(*req.Instructions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.Instructions = instructions
+	}
+
+	if req.AttributeFilter != nil {
+		if req.AttributeFilter.LocationPrecisionKm < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location_precision_km. Must not be negative"})
+			return
+		}
+		shareLink.AttributeFilter = *req.AttributeFilter
+	}
+
+	if req.IPRestriction != nil {
+		ipRestriction, err := normalizeIPRestriction(*req.IPRestriction)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.IPRestriction = ipRestriction
+	}
+
+	if req.Geofence != nil {
+		geofence, err := normalizeGeofence(*req.Geofence)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.Geofence = geofence
+	}
+
+	if req.Embed != nil {
+		embed, err := normalizeEmbedSettings(*req.Embed)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.Embed = embed
+	}
+
+	if req.RequireApproval != nil {
+		shareLink.RequireApproval = *req.RequireApproval
+	}
+
+	// Lowering the limit keeps already bound devices; revoke them to free their slots
+	if req.MaxDevices != nil {
+		if err := validateMaxDevices(*req.MaxDevices); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.MaxDevices = *req.MaxDevices
+	}
+
+	if req.Conditions != nil {
+		conditions, err := normalizeShareConditions(*req.Conditions)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.Conditions = conditions
+	}
+
+	if req.Schedule != nil {
+		schedule, err := normalizeShareSchedule(*req.Schedule)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		shareLink.Schedule = schedule
+	}
+
+	if err := validateKioskLink(&shareLink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateActionLink(&shareLink); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := database.DB.Save(&shareLink).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update share link"})
 		return
@@ -1061,6 +1950,91 @@ func (h *Handler) UpdateShareLink(c *gin.Context) {
 	c.JSON(http.StatusOK, shareLink)
 }
 
+// buildShareEntries merges structured entries and legacy entity IDs into validated share entries.
+// Entries without an access mode, and all legacy entity IDs, use defaultMode.
+func buildShareEntries(entityIDs []string, entries []models.ShareEntry, defaultMode string) (models.ShareEntries, error) {
+	if defaultMode == "" {
+		defaultMode = "readonly"
+	}
+
+	result := make(models.ShareEntries, 0, len(entries)+len(entityIDs))
+	seen := make(map[string]bool)
+
+	for _, entry := range entries {
+		if !strings.Contains(entry.EntityID, ".") {
+			return nil, fmt.Errorf("invalid entity ID %q", entry.EntityID)
+		}
+		if seen[entry.EntityID] {
+			return nil, fmt.Errorf("entity %s is listed more than once", entry.EntityID)
+		}
+		if entry.AccessMode == "" {
+			entry.AccessMode = defaultMode
+		}
+		if !isValidAccessMode(entry.AccessMode) {
+			return nil, fmt.Errorf("invalid access_mode for %s. Must be 'readonly' or 'triggerable'", entry.EntityID)
+		}
+		if err := validateAutoRevert(entry.AutoRevertMinutes, entry.AccessMode); err != nil {
+			return nil, fmt.Errorf("invalid auto_revert_minutes for %s: %w", entry.EntityID, err)
+		}
+		chain, err := normalizeActionChain(entry.Chain)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chain for %s: %w", entry.EntityID, err)
+		}
+		if chain != nil && entry.AccessMode != "triggerable" {
+			return nil, fmt.Errorf("invalid chain for %s: only triggerable entities can start action chains", entry.EntityID)
+		}
+		entry.Chain = chain
+		display, err := sanitizeShareDisplay(entry.Display)
+		if err != nil {
+			return nil, fmt.Errorf("invalid display options for %s: %w", entry.EntityID, err)
+		}
+		entry.Display = display
+		seen[entry.EntityID] = true
+		result = append(result, entry)
+	}
+
+	for _, entityID := range entityIDs {
+		if seen[entityID] {
+			continue
+		}
+		if !strings.Contains(entityID, ".") {
+			return nil, fmt.Errorf("invalid entity ID %q", entityID)
+		}
+		seen[entityID] = true
+		result = append(result, models.ShareEntry{
+			EntityID:   entityID,
+			AccessMode: defaultMode,
+		})
+	}
+
+	return result, nil
+}
+
+// shareAccessSummary returns "readonly" or "triggerable" if all entries share that mode, "mixed" otherwise
+func shareAccessSummary(entries models.ShareEntries) string {
+	summary := ""
+	for _, entry := range entries {
+		if summary == "" {
+			summary = entry.AccessMode
+		} else if summary != entry.AccessMode {
+			return "mixed"
+		}
+	}
+	if summary == "" {
+		return "readonly"
+	}
+	return summary
+}
+
+// isValidAccessMode reports whether mode is a supported access mode
+func isValidAccessMode(mode string) bool {
+	return mode == "readonly" || mode == "triggerable"
+}
+
+func isValidShareLinkType(linkType string) bool {
+	return linkType == "permanent" || linkType == "counter" || linkType == "time" || linkType == "kiosk"
+}
+
 func generateID() string {
 	bytes := make([]byte, 16)
 	rand.Read(bytes)
@@ -1202,6 +2176,7 @@ func (h *Handler) DisableOTP(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable OTP"})
 		return
 	}
+	publishUserEvent(events.UserOTPDisabled, &user)
 
 	c.JSON(http.StatusOK, gin.H{"message": "OTP disabled successfully"})
 }
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const kioskRefreshSeconds = 30
+
+// errKioskBound is returned when another device bound the kiosk link first
+var errKioskBound = errors.New("kiosk link is bound to another device")
+
+// kioskTile is a shared entity as presented on the kiosk page
+type kioskTile struct {
+	embedEntity
+	Service     string // Service a tap calls, empty for read-only tiles
+	ActionLabel string
+	On          bool
+}
+
+// kioskSection groups kiosk tiles under a heading
+type kioskSection struct {
+	Name  string
+	Tiles []kioskTile
+}
+
+// KioskPage renders the full-screen view of a kiosk share link. The first device to open the
+// link is bound to it; other devices are turned away until the owner allows rebinding (public endpoint).
+func (h *Handler) KioskPage(c *gin.Context) {
+	data := gin.H{"ShareID": c.Param("id")}
+
+	var shareLink models.ShareLink
+	if err := database.DB.Preload("User").First(&shareLink, "id = ?", c.Param("id")).Error; err != nil {
+		data["Error"] = "Share link not found"
+		c.HTML(http.StatusNotFound, "kiosk.html", data)
+		return
+	}
+	data["Title"] = shareLink.Title
+
+	if shareLink.Type != "kiosk" {
+		data["Error"] = "This share link is not a kiosk link"
+		c.HTML(http.StatusBadRequest, "kiosk.html", data)
+		return
+	}
+
+	// Check if link is active
+	if !shareLink.Active {
+		data["Error"] = "Share link is no longer active"
+		c.HTML(http.StatusForbidden, "kiosk.html", data)
+		return
+	}
+
+	// Check network restriction (before binding, so blocked networks cannot claim the link)
+	if !allowsClientIP(shareLink.IPRestriction, clientIP(c)) {
+		data["Error"] = "Access to this share link is not allowed from your network"
+		c.HTML(http.StatusForbidden, "kiosk.html", data)
+		return
+	}
+
+	// Use the device's credential or bind the link to this device on first use
+	device := lookupShareDevice(c, &shareLink)
+	if device == nil || device.RevokedAt != nil {
+		if !shareLink.KioskBindable {
+			data["Error"] = "This kiosk link is bound to another device"
+			if device != nil {
+				h.clearShareDeviceCookie(c, &shareLink)
+				data["Error"] = "Access of this device was revoked by the owner"
+			}
+			c.HTML(http.StatusForbidden, "kiosk.html", data)
+			return
+		}
+
+		bound, err := h.bindKioskDevice(c, &shareLink)
+		if errors.Is(err, errKioskBound) {
+			data["Error"] = "This kiosk link is bound to another device"
+			c.HTML(http.StatusForbidden, "kiosk.html", data)
+			return
+		}
+		if err != nil {
+			data["Error"] = "Failed to bind this device"
+			c.HTML(http.StatusInternalServerError, "kiosk.html", data)
+			return
+		}
+		device = bound
+	}
+
+	if err := h.touchShareDevice(c, &shareLink, device); err != nil {
+		data["Error"] = "Failed to register this device"
+		c.HTML(http.StatusInternalServerError, "kiosk.html", data)
+		return
+	}
+
+	// Keep refreshing while the schedule or the owner's conditions do not allow access, so the kiosk comes back on its own
+	data["RefreshSeconds"] = kioskRefreshSeconds
+	data["HeartbeatSeconds"] = h.kioskHeartbeatInterval()
+	if !scheduleAllows(shareLink.Schedule, time.Now()) {
+		data["Error"] = "Share link is not available at this time"
+		c.HTML(http.StatusForbidden, "kiosk.html", data)
+		return
+	}
+	if status, denial := checkShareConditions(&shareLink.User, shareLink.Conditions); denial != nil {
+		data["Error"] = denial["error"]
+		c.HTML(status, "kiosk.html", data)
+		return
+	}
+
+	entities, err := h.fetchShareEntities(&shareLink)
+	if err != nil {
+		data["Error"] = "Failed to fetch entities"
+		c.HTML(http.StatusInternalServerError, "kiosk.html", data)
+		return
+	}
+
+	data["Sections"] = kioskSections(&shareLink, entities)
+	data["UpdatedAt"] = time.Now().Format("15:04")
+	c.HTML(http.StatusOK, "kiosk.html", data)
+}
+
+// KioskHeartbeat records that a kiosk device is still online (public endpoint, requires the device credential)
+func (h *Handler) KioskHeartbeat(c *gin.Context) {
+	var shareLink models.ShareLink
+	if err := database.DB.First(&shareLink, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	device, ok := shareDevice(c, &shareLink)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "This device is not bound to the kiosk link or was revoked", "revoked": true})
+		return
+	}
+
+	if !shareLink.Active {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Share link is no longer active"})
+		return
+	}
+
+	if err := h.touchShareDevice(c, &shareLink, device); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record heartbeat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":             "ok",
+		"heartbeat_interval": h.kioskHeartbeatInterval(),
+	})
+}
+
+// GetKioskStatus returns the devices bound to one of the user's kiosk share links and whether they are online
+func (h *Handler) GetKioskStatus(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var shareLink models.ShareLink
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&shareLink).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not owned by you"})
+		return
+	}
+
+	if shareLink.Type != "kiosk" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This share link is not a kiosk link"})
+		return
+	}
+
+	devices, err := h.shareDeviceItems(&shareLink)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch kiosk devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"kiosk_bindable":     shareLink.KioskBindable,
+		"heartbeat_interval": h.kioskHeartbeatInterval(),
+		"devices":            devices,
+	})
+}
+
+// RevokeKioskDevice revokes the device a kiosk share link is bound to. With allow_rebind,
+// the next device to open the link is bound to it.
+func (h *Handler) RevokeKioskDevice(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var req struct {
+		AllowRebind bool `json:"allow_rebind"`
+	}
+
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var shareLink models.ShareLink
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&shareLink).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not owned by you"})
+		return
+	}
+
+	if shareLink.Type != "kiosk" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This share link is not a kiosk link"})
+		return
+	}
+
+	now := time.Now()
+	result := database.DB.Model(&models.ShareDevice{}).
+		Where("share_link_id = ? AND revoked_at IS NULL", shareLink.ID).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke kiosk device"})
+		return
+	}
+
+	shareLink.KioskBindable = req.AllowRebind
+	if err := database.DB.Save(&shareLink).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update share link"})
+		return
+	}
+
+	events.Publish(events.Event{
+		Type:   events.ShareDeviceRevoked,
+		UserID: shareLink.UserID,
+		Data: map[string]interface{}{
+			"share_id":     shareLink.ID,
+			"revoked":      result.RowsAffected,
+			"allow_rebind": req.AllowRebind,
+		},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Kiosk device revoked",
+		"revoked":        result.RowsAffected,
+		"kiosk_bindable": shareLink.KioskBindable,
+	})
+}
+
+// validateKioskLink rejects options an unattended kiosk device cannot satisfy
+func validateKioskLink(link *models.ShareLink) error {
+	if link.Type != "kiosk" {
+		return nil
+	}
+	if link.RequireApproval {
+		return errors.New("kiosk links cannot require approval; the kiosk device is bound on first use instead")
+	}
+	if link.Geofence.Enabled {
+		return errors.New("kiosk links cannot use a geofence")
+	}
+	return nil
+}
+
+// bindKioskDevice binds a kiosk link to the requesting device. The link stays locked to it until the owner allows rebinding.
+func (h *Handler) bindKioskDevice(c *gin.Context, link *models.ShareLink) (*models.ShareDevice, error) {
+	// Claim the link first, so only one of several devices opening it at once is bound
+	result := database.DB.Model(&models.ShareLink{}).Where("id = ? AND kiosk_bindable = ?", link.ID, true).
+		Update("kiosk_bindable", false)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected != 1 {
+		return nil, errKioskBound
+	}
+	link.KioskBindable = false
+
+	device, err := h.createShareDevice(c, link, 0)
+	if err != nil {
+		// Give the claim back, so the device can try again
+		database.DB.Model(&models.ShareLink{}).Where("id = ?", link.ID).Update("kiosk_bindable", true)
+		return nil, err
+	}
+	return device, nil
+}
+
+// kioskHeartbeatInterval returns how often kiosk devices report they are online, in seconds
+func (h *Handler) kioskHeartbeatInterval() int {
+	if h.Config != nil && h.Config.KioskHeartbeatInterval > 0 {
+		return h.Config.KioskHeartbeatInterval
+	}
+	return 60
+}
+
+// kioskSections builds the kiosk tiles of a share link, grouped by section in display order
+func kioskSections(link *models.ShareLink, entities []*models.Entity) []kioskSection {
+	entries := make(map[string]models.ShareEntry, len(link.Entries))
+	for _, entry := range link.Entries {
+		entries[entry.EntityID] = entry
+	}
+
+	sections := []kioskSection{}
+	index := make(map[string]int)
+	for _, item := range embedEntities(link, entities) {
+		tile := kioskTile{embedEntity: item}
+		if entry := entries[item.EntityID]; entry.AccessMode == "triggerable" {
+			tile.Service, tile.ActionLabel, tile.On = kioskAction(item.EntityID, item.State)
+			if !entry.AllowsService(tile.Service) {
+				tile.Service, tile.ActionLabel = "", ""
+			}
+		}
+
+		i, ok := index[item.Section]
+		if !ok {
+			i = len(sections)
+			index[item.Section] = i
+			sections = append(sections, kioskSection{Name: item.Section})
+		}
+		sections[i].Tiles = append(sections[i].Tiles, tile)
+	}
+	return sections
+}
+
+// kioskAction returns the service a tap on a tile calls, mirroring the controls of the share page
+func kioskAction(entityID, state string) (service, label string, on bool) {
+	domain, _, _ := strings.Cut(entityID, ".")
+	switch domain {
+	case "light", "switch":
+		if state == "on" {
+			return "turn_off", "Turn off", true
+		}
+		return "turn_on", "Turn on", false
+	case "cover":
+		if state == "open" {
+			return "close_cover", "Close", true
+		}
+		return "open_cover", "Open", false
+	case "scene", "script":
+		return "turn_on", "Activate", false
+	}
+	return "", "", false
+}
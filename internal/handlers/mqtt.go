@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/ThraaxSession/Hash/internal/mqtt"
+	"github.com/gin-gonic/gin"
+)
+
+// maxMQTTCommandSize bounds the payload of a command message
+const maxMQTTCommandSize = 64 << 10
+
+// mqttRedactedEventData are event data keys that are never published to MQTT. They hold IDs that grant
+// access on their own, e.g. a share ID opens /share/:id, and every broker subscriber would see them
+var mqttRedactedEventData = []string{"share_id", "access_request_id", "action_request_id", "device_id", "webhook_id"}
+
+// PublishMQTTEvent forwards an event to the broker: state changes of tracked entities are
+// retained on <prefix>/state/<username>/<entity_id>, and events matching eventTypes (none by
+// default) are published on <prefix>/events/<event type> without their credential-like IDs
+func (h *Handler) PublishMQTTEvent(client *mqtt.Client, eventTypes []string, event events.Event) {
+	if event.Type == events.EntityStateChanged {
+		h.publishMQTTState(client, event)
+	}
+	if len(eventTypes) == 0 || !subscribesTo(eventTypes, event.Type) {
+		return
+	}
+
+	data := make(map[string]interface{}, len(event.Data))
+	for key, value := range event.Data {
+		if !containsString(mqttRedactedEventData, key) {
+			data[key] = value
+		}
+	}
+	event.Data = data
+	if err := client.Publish(client.Topic("events", event.Type), false, event); err != nil {
+		log.Printf("Failed to publish %s event to MQTT: %v", event.Type, err)
+	}
+}
+
+// publishMQTTState retains the latest state of a tracked entity
+func (h *Handler) publishMQTTState(client *mqtt.Client, event events.Event) {
+	entityID, _ := event.Data["entity_id"].(string)
+	if !validMQTTTopicLevel(entityID) {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "username").First(&user, event.UserID).Error; err != nil || !validMQTTTopicLevel(user.Username) {
+		return
+	}
+
+	state := map[string]interface{}{
+		"entity_id":    entityID,
+		"state":        event.Data["state"],
+		"attributes":   event.Data["attributes"],
+		"last_changed": event.Data["last_changed"],
+		"last_updated": event.Data["last_updated"],
+	}
+	if err := client.Publish(client.Topic("state", user.Username, entityID), true, state); err != nil {
+		log.Printf("Failed to publish state of %s to MQTT: %v", entityID, err)
+	}
+}
+
+// mqttMessage is the envelope of command and result messages. Payload is signed with the user's MQTT key
+// like webhooks: Signature is "sha256=" and the hex HMAC-SHA256 of "<timestamp>.<topic>.<payload>"
+type mqttMessage struct {
+	Payload   string `json:"payload"`             // JSON of the command or result
+	Timestamp string `json:"timestamp,omitempty"` // Unix seconds
+	Signature string `json:"signature,omitempty"`
+}
+
+// SubscribeMQTTCommands accepts triggers of shared entities on <prefix>/command/<username>/<entity_id>.
+// Commands must be signed with the MQTT key of the user named in the topic; the key itself is never sent
+func (h *Handler) SubscribeMQTTCommands(client *mqtt.Client) error {
+	return client.Subscribe(client.Topic("command", "+", "+"), func(topic string, payload []byte) {
+		h.handleMQTTCommand(client, topic, payload)
+	})
+}
+
+// handleMQTTCommand runs a command message through the same checks as TriggerSharedEntity and
+// publishes the outcome on the command topic's /result subtopic, signed if the sender was authenticated
+func (h *Handler) handleMQTTCommand(client *mqtt.Client, topic string, payload []byte) {
+	levels := strings.Split(strings.TrimPrefix(topic, client.Prefix+"/"), "/")
+	if len(levels) != 3 {
+		return
+	}
+	username, entityID := levels[1], levels[2]
+
+	var message mqttMessage
+	var req struct {
+		ID      string                 `json:"id"`    // Echoed in the result to correlate it with the command
+		Nonce   string                 `json:"nonce"` // Random value making every command unique
+		Service string                 `json:"service"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	var user *models.User
+	status, result := http.StatusBadRequest, gin.H{"error": "Command must be a signed message whose payload is a JSON object with a nonce and a service"}
+	if len(payload) <= maxMQTTCommandSize && json.Unmarshal(payload, &message) == nil &&
+		json.Unmarshal([]byte(message.Payload), &req) == nil && req.Service != "" && req.Nonce != "" {
+		user, status, result = authenticateMQTTCommand(username, topic, &message, time.Now())
+		if user != nil {
+			// Action requests created through MQTT have no client IP
+			status, result = h.triggerSharedEntity(user, entityID, req.Service, req.Data, "")
+		}
+	}
+
+	response := gin.H{"status": status}
+	for key, value := range result {
+		response[key] = value
+	}
+	if req.ID != "" {
+		response["id"] = req.ID
+	}
+	encoded, _ := json.Marshal(response)
+	reply := mqttMessage{Payload: string(encoded)}
+	if user != nil {
+		reply = signMQTTMessage(user.MQTTKey, topic+"/result", string(encoded), time.Now())
+	}
+	if err := client.Publish(topic+"/result", false, reply); err != nil {
+		log.Printf("Failed to publish MQTT command result for %s: %v", entityID, err)
+	}
+}
+
+// authenticateMQTTCommand returns the user named in the topic if the message carries their valid signature.
+// Anyone can publish to the broker, so the user never comes from the topic alone; replayed messages are refused
+func authenticateMQTTCommand(username, topic string, message *mqttMessage, now time.Time) (*models.User, int, gin.H) {
+	if message.Timestamp == "" || message.Signature == "" {
+		return nil, http.StatusUnauthorized, gin.H{"error": "Command must be signed with the user's MQTT key"}
+	}
+
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil || user.MQTTKey == "" ||
+		verifyWebhookSignature(user.MQTTKey, message.Timestamp, message.Signature, mqttSignedData(topic, message.Payload), now) != nil {
+		return nil, http.StatusForbidden, gin.H{"error": fmt.Sprintf("Invalid signature or timestamp more than %d minutes off", int(webhookTimestampWindow.Minutes()))}
+	}
+	digest := signWebhook(user.MQTTKey, message.Timestamp, mqttSignedData(topic, message.Payload))
+	if !claimWebhookDelivery(fmt.Sprintf("mqtt:%d:%s", user.ID, hex.EncodeToString(digest)), now) {
+		return nil, http.StatusConflict, gin.H{"error": "This command was already received"}
+	}
+	return &user, http.StatusOK, nil
+}
+
+// signMQTTMessage wraps a payload published on topic in a message signed with key
+func signMQTTMessage(key, topic, payload string, now time.Time) mqttMessage {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	return mqttMessage{
+		Payload:   payload,
+		Timestamp: timestamp,
+		Signature: "sha256=" + hex.EncodeToString(signWebhook(key, timestamp, mqttSignedData(topic, payload))),
+	}
+}
+
+// mqttSignedData binds a payload to its topic, so a signed command cannot be replayed for another entity
+func mqttSignedData(topic, payload string) []byte {
+	return []byte(topic + "." + payload)
+}
+
+// CreateMQTTKey generates a new MQTT key for the user, replacing the previous one. The key is only shown once
+func (h *Handler) CreateMQTTKey(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	key := generateWebhookSecret()
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Update("mqtt_key", key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create MQTT key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"key": key})
+}
+
+// DeleteMQTTKey revokes the user's MQTT key, so MQTT commands are refused until a new one is created
+func (h *Handler) DeleteMQTTKey(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Update("mqtt_key", "").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke MQTT key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "MQTT key revoked"})
+}
+
+// validMQTTTopicLevel reports whether s can be used as a single topic level
+func validMQTTTopicLevel(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "/+#\x00")
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/ThraaxSession/Hash/internal/mqtt"
+)
+
+// testBroker is a minimal MQTT 3.1.1 broker for tests: it accepts every client, grants QoS 0
+// subscriptions and forwards published messages to matching subscribers
+type testBroker struct {
+	listener net.Listener
+	mu       sync.Mutex
+	subs     map[net.Conn][]string
+}
+
+func startTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := &testBroker{listener: listener, subs: make(map[net.Conn][]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return broker
+}
+
+func (b *testBroker) URL() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.subs, conn)
+		b.mu.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		header, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		length, multiplier := 0, 1
+		for {
+			digit, err := reader.ReadByte()
+			if err != nil {
+				return
+			}
+			length += int(digit&0x7f) * multiplier
+			multiplier *= 128
+			if digit&0x80 == 0 {
+				break
+			}
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1: // CONNECT
+			b.write(conn, []byte{0x20, 2, 0, 0})
+		case 3: // PUBLISH
+			topicLength := int(binary.BigEndian.Uint16(body))
+			topic := string(body[2 : 2+topicLength])
+			rest := body[2+topicLength:]
+			if qos := (header >> 1) & 3; qos > 0 {
+				b.write(conn, []byte{0x40, 2, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			b.forward(topic, rest)
+		case 8: // SUBSCRIBE
+			var granted []byte
+			for i := 2; i < len(body); {
+				filterLength := int(binary.BigEndian.Uint16(body[i:]))
+				filter := string(body[i+2 : i+2+filterLength])
+				i += 3 + filterLength
+				b.mu.Lock()
+				b.subs[conn] = append(b.subs[conn], filter)
+				b.mu.Unlock()
+				granted = append(granted, 0)
+			}
+			b.write(conn, append([]byte{0x90, byte(2 + len(granted)), body[0], body[1]}, granted...))
+		case 12: // PINGREQ
+			b.write(conn, []byte{0xd0, 0})
+		case 14: // DISCONNECT
+			return
+		}
+	}
+}
+
+func (b *testBroker) forward(topic string, payload []byte) {
+	packet := []byte{byte(len(topic) >> 8), byte(len(topic))}
+	packet = append(append(packet, topic...), payload...)
+	var length []byte
+	for n := len(packet); ; {
+		digit := byte(n % 128)
+		if n /= 128; n > 0 {
+			digit |= 0x80
+		}
+		length = append(length, digit)
+		if n == 0 {
+			break
+		}
+	}
+	message := append(append([]byte{0x30}, length...), packet...)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for conn, filters := range b.subs {
+		for _, filter := range filters {
+			if topicMatches(filter, topic) {
+				conn.Write(message)
+				break
+			}
+		}
+	}
+}
+
+func (b *testBroker) write(conn net.Conn, packet []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conn.Write(packet)
+}
+
+func topicMatches(filter, topic string) bool {
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+func TestMQTTCommands(t *testing.T) {
+	if err := database.Initialize(filepath.Join(t.TempDir(), "hassh.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	// Home Assistant of the owner, recording the services called
+	calls := make(chan string, 10)
+	homeAssistant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls <- r.URL.Path
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(homeAssistant.Close)
+
+	owner := models.User{Username: "alice", HAURL: homeAssistant.URL, HAToken: "token"}
+	bob := models.User{Username: "bob", MQTTKey: "bob-key"}
+	mallory := models.User{Username: "mallory", MQTTKey: "mallory-key"}
+	for _, user := range []*models.User{&owner, &bob, &mallory} {
+		if err := database.DB.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	share := models.SharedEntity{OwnerID: owner.ID, SharedWith: bob.ID, EntityID: "light.porch", AccessMode: "triggerable", Status: "accepted"}
+	if err := database.DB.Create(&share).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	broker := startTestBroker(t)
+	cfg := &models.Config{MQTTBrokerURL: broker.URL(), MQTTClientID: "hassh", MQTTTopicPrefix: "hassh"}
+	handler := NewHandler(nil, cfg)
+	subscribed := make(chan struct{}, 1)
+	bridge, err := mqtt.Connect(cfg, func(client *mqtt.Client) {
+		if err := handler.SubscribeMQTTCommands(client); err != nil {
+			t.Error(err)
+		}
+		subscribed <- struct{}{}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(bridge.Close)
+	<-subscribed
+
+	results := make(chan mqttMessage, 10)
+	tool, err := mqtt.Connect(&models.Config{MQTTBrokerURL: broker.URL(), MQTTClientID: "tool", MQTTTopicPrefix: "hassh"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tool.Close)
+	if err := tool.Subscribe("hassh/command/+/+/result", func(_ string, payload []byte) {
+		var message mqttMessage
+		json.Unmarshal(payload, &message)
+		results <- message
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	topic := "hassh/command/bob/light.porch"
+	// Replays are remembered per process, so every run needs its own nonce
+	command := `{"id": "1", "nonce": "` + generateID() + `", "service": "turn_on"}`
+	signed := signMQTTMessage("bob-key", topic, command, time.Now())
+
+	send := func(topic string, message interface{}) (int, mqttMessage) {
+		t.Helper()
+		if err := tool.Publish(topic, false, message); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case result := <-results:
+			var response struct {
+				Status int `json:"status"`
+			}
+			json.Unmarshal([]byte(result.Payload), &response)
+			return response.Status, result
+		case <-time.After(5 * time.Second):
+			t.Fatal("no result published")
+		}
+		return 0, mqttMessage{}
+	}
+
+	status, result := send(topic, signed)
+	if status != http.StatusOK {
+		t.Fatalf("signed command: status %d, want 200 (%s)", status, result.Payload)
+	}
+	if err := verifyWebhookSignature("bob-key", result.Timestamp, result.Signature, mqttSignedData(topic+"/result", result.Payload), time.Now()); err != nil {
+		t.Fatalf("result is not signed with the user's key: %v", err)
+	}
+	select {
+	case path := <-calls:
+		if path != "/api/services/light/turn_on" {
+			t.Fatalf("called %s", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Home Assistant was not called")
+	}
+
+	refused := []struct {
+		name    string
+		topic   string
+		message interface{}
+		status  int
+	}{
+		{"replayed", topic, signed, http.StatusConflict},
+		{"unsigned", topic, mqttMessage{Payload: `{"nonce": "n2", "service": "turn_on"}`}, http.StatusUnauthorized},
+		{"sent with the key", topic, map[string]string{"payload": `{"nonce": "n3", "service": "turn_on"}`, "key": "bob-key"}, http.StatusUnauthorized},
+		{"signed by another user", topic, signMQTTMessage("mallory-key", topic, `{"nonce": "n4", "service": "turn_on"}`, time.Now()), http.StatusForbidden},
+		{"signed for another topic", "hassh/command/bob/lock.front", signed, http.StatusForbidden},
+		{"expired", topic, signMQTTMessage("bob-key", topic, `{"nonce": "n5", "service": "turn_on"}`, time.Now().Add(-time.Hour)), http.StatusForbidden},
+	}
+	for _, test := range refused {
+		status, result := send(test.topic, test.message)
+		if status != test.status {
+			t.Errorf("%s command: status %d, want %d (%s)", test.name, status, test.status, result.Payload)
+		}
+		if result.Signature != "" {
+			t.Errorf("%s command: refusal is signed", test.name)
+		}
+	}
+	select {
+	case path := <-calls:
+		t.Fatalf("refused command called %s", path)
+	default:
+	}
+}
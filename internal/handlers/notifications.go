@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const notificationListLimit = 50
+
+// GetNotifications returns the latest notifications of the authenticated user
+func (h *Handler) GetNotifications(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	query := database.DB.Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read = ?", false)
+	}
+
+	var notifications []models.Notification
+	if err := query.Order("created_at DESC, id DESC").Limit(notificationListLimit).Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	var unread int64
+	database.DB.Model(&models.Notification{}).Where("user_id = ? AND read = ?", userID, false).Count(&unread)
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+// MarkNotificationRead marks a single notification as read
+func (h *Handler) MarkNotificationRead(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	notificationID := c.Param("id")
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ?", notificationID, userID).
+		Update("read", true)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead marks all notifications of the authenticated user as read
+func (h *Handler) MarkAllNotificationsRead(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	if err := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read = ?", userID, false).
+		Update("read", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked as read"})
+}
+
+// UpdateNotificationSettings sets the Home Assistant notify service used for owner notifications
+func (h *Handler) UpdateNotificationSettings(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var req struct {
+		NotifyService string `json:"notify_service"` // e.g. "notify.mobile_app_phone", empty disables HA notifications
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.NotifyService = strings.TrimSpace(req.NotifyService)
+	if req.NotifyService != "" && (!strings.HasPrefix(req.NotifyService, "notify.") || len(req.NotifyService) == len("notify.")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notify_service. Must be a notify service (e.g. 'notify.mobile_app_phone')"})
+		return
+	}
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).Update("notify_service", req.NotifyService).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification settings updated successfully"})
+}
+
+// notifyUser stores an in-app notification and forwards it to the user's Home Assistant notify service
+func notifyUser(user *models.User, kind, title, message string, data map[string]interface{}) {
+	notification := models.Notification{
+		UserID:  user.ID,
+		Type:    kind,
+		Title:   title,
+		Message: message,
+	}
+	if data != nil {
+		if encoded, err := json.Marshal(data); err == nil {
+			notification.Data = encoded
+		}
+	}
+	if err := database.DB.Create(&notification).Error; err != nil {
+		log.Printf("Failed to store notification for user %d: %v", user.ID, err)
+	}
+
+	if user.NotifyService == "" || user.HAURL == "" || user.HAToken == "" {
+		return
+	}
+
+	// Deliver in the background so slow Home Assistant instances don't block requests
+	haClient := ha.NewClient(user.HAURL, user.HAToken)
+	service := strings.TrimPrefix(user.NotifyService, "notify.")
+	go func() {
+		if err := haClient.CallService("notify", service, map[string]interface{}{
+			"title":   title,
+			"message": message,
+		}); err != nil {
+			log.Printf("Failed to send Home Assistant notification to user %d: %v", user.ID, err)
+		}
+	}()
+}
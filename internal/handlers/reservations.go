@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxReservationHours     = 24
+	maxReservationAheadDays = 90
+	maxReservationNoteSize  = 200
+	calendarDefaultDays     = 7
+	maxCalendarDays         = 92
+)
+
+var errReservationConflict = errors.New("reservation conflict")
+
+// ListReservations returns the reservation calendar: active and completed reservations overlapping
+// ?from= and ?to= (RFC 3339, default the next 7 days). With ?entity_id= it lists every reservation of
+// that entity, otherwise the user's own, those of entities they own and those of entities shared with them.
+func (h *Handler) ListReservations(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	user := c.MustGet("user").(*models.User)
+
+	from, to, err := calendarRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Preload("User").
+		Where("status IN ?", []string{"active", "completed"}).
+		Where("starts_at < ? AND ends_at > ?", to, from)
+
+	if entityID := c.Query("entity_id"); entityID != "" {
+		owner, _, found := h.reservationOwner(user, entityID)
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entity not shared with you or not found"})
+			return
+		}
+		query = query.Where("owner_id = ? AND entity_id = ?", owner.ID, entityID)
+	} else {
+		// Entities shared directly with the user or their groups; selector shares need ?entity_id=
+		var shares []models.SharedEntity
+		database.DB.Scopes(activeUserShares(time.Now()), sharedWithUser(userID)).Where("entity_id != ?", "").Find(&shares)
+
+		scope := database.DB.Where("user_id = ? OR owner_id = ?", userID, userID)
+		for _, share := range shares {
+			scope = scope.Or("owner_id = ? AND entity_id = ?", share.OwnerID, share.EntityID)
+		}
+		query = query.Where(scope)
+	}
+
+	var reservations []models.Reservation
+	if err := query.Order("starts_at").Find(&reservations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reservations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":         from,
+		"to":           to,
+		"reservations": reservations,
+	})
+}
+
+// CreateReservation reserves an entity for a time slot. Users reserve triggerable entities shared with them;
+// owners reserve their own entities and may override conflicting reservations.
+func (h *Handler) CreateReservation(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	user := c.MustGet("user").(*models.User)
+
+	var req struct {
+		EntityID string    `json:"entity_id" binding:"required"`
+		StartsAt time.Time `json:"starts_at"` // Default: now
+		EndsAt   time.Time `json:"ends_at" binding:"required"`
+		Note     string    `json:"note"`
+		Override bool      `json:"override"` // Owner only: cancel conflicting reservations
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owner, share, found := h.reservationOwner(user, req.EntityID)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entity not shared with you or not found"})
+		return
+	}
+	if share != nil && share.AccessMode != "triggerable" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only triggerable entities can be reserved"})
+		return
+	}
+	if req.Override && owner.ID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can override reservations"})
+		return
+	}
+
+	// Validate the slot
+	now := time.Now()
+	if req.StartsAt.IsZero() || req.StartsAt.Before(now) {
+		req.StartsAt = now
+	}
+	if err := validateReservationSlot(req.StartsAt, req.EndsAt, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if len(req.Note) > maxReservationNoteSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Note is too long (max %d characters)", maxReservationNoteSize)})
+		return
+	}
+
+	reservation := models.Reservation{
+		ID:       generateID(),
+		OwnerID:  owner.ID,
+		EntityID: req.EntityID,
+		UserID:   userID,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		Note:     req.Note,
+		Status:   "active",
+	}
+
+	// Check for conflicts and create the reservation atomically
+	var conflicts []models.Reservation
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("User").
+			Where("owner_id = ? AND entity_id = ? AND status = ?", owner.ID, req.EntityID, "active").
+			Where("starts_at < ? AND ends_at > ?", req.EndsAt, req.StartsAt).
+			Find(&conflicts).Error; err != nil {
+			return err
+		}
+		if len(conflicts) > 0 && !req.Override {
+			return errReservationConflict
+		}
+		return tx.Create(&reservation).Error
+	})
+	if errors.Is(err, errReservationConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "The entity is already reserved in this time slot", "conflicts": conflicts})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create reservation"})
+		return
+	}
+
+	// The owner's reservation takes precedence
+	for i := range conflicts {
+		if claimReservation(&conflicts[i], "cancelled") {
+			finishReservation(&conflicts[i], "cancelled", "overridden by the owner", true)
+		}
+	}
+
+	reservation.User = *user
+	publishReservationEvent(events.ReservationCreated, &reservation)
+
+	c.JSON(http.StatusCreated, reservation)
+}
+
+// ReleaseReservation ends one of the user's reservations early. Owners can cancel any reservation of
+// their entities.
+func (h *Handler) ReleaseReservation(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var reservation models.Reservation
+	if err := database.DB.Preload("User").
+		Where("id = ? AND (user_id = ? OR owner_id = ?)", c.Param("id"), userID, userID).
+		First(&reservation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+		return
+	}
+
+	// The owner overriding someone else's reservation cancels it
+	status, reason := "released", "released by its user"
+	byOwner := reservation.UserID != userID
+	if byOwner {
+		status, reason = "cancelled", "cancelled by the owner"
+	}
+
+	if !claimReservation(&reservation, status) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Reservation is no longer active", "reservation": reservation})
+		return
+	}
+	finishReservation(&reservation, status, reason, byOwner)
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+// ReleaseReservations completes reservations whose slot ended and releases those not used within
+// noShow after their start (0 disables the release), so a forgotten booking does not block others.
+func (h *Handler) ReleaseReservations(noShow time.Duration) error {
+	now := time.Now()
+
+	var ended []models.Reservation
+	if err := database.DB.Where("status = ? AND ends_at <= ?", "active", now).Find(&ended).Error; err != nil {
+		return err
+	}
+	for i := range ended {
+		if claimReservation(&ended[i], "completed") {
+			finishReservation(&ended[i], "completed", "", false)
+		}
+	}
+
+	if noShow <= 0 {
+		return nil
+	}
+	var unused []models.Reservation
+	if err := database.DB.Preload("User").
+		Where("status = ? AND used_at IS NULL AND starts_at <= ?", "active", now.Add(-noShow)).
+		Find(&unused).Error; err != nil {
+		return err
+	}
+	for i := range unused {
+		if claimReservation(&unused[i], "released") {
+			finishReservation(&unused[i], "released", fmt.Sprintf("not used within %d min of its start", int(noShow.Minutes())), true)
+		}
+	}
+
+	if len(ended)+len(unused) > 0 {
+		log.Printf("Reservations: completed %d, released %d unused", len(ended), len(unused))
+	}
+	return nil
+}
+
+// checkReservation refuses triggers of an entity while another user holds an active reservation for it.
+// The first trigger of the reservation's own user marks it as used. It returns the status and body of
+// the denial, or nil.
+func checkReservation(ownerID uint, entityID string, userID uint) (int, gin.H) {
+	now := time.Now()
+
+	var reservation models.Reservation
+	err := database.DB.Preload("User").
+		Where("owner_id = ? AND entity_id = ? AND status = ?", ownerID, entityID, "active").
+		Where("starts_at <= ? AND ends_at > ?", now, now).
+		First(&reservation).Error
+	if err != nil {
+		return http.StatusOK, nil
+	}
+
+	if reservation.UserID == userID {
+		if reservation.UsedAt == nil {
+			database.DB.Model(&reservation).Update("used_at", now)
+		}
+		return http.StatusOK, nil
+	}
+
+	return http.StatusConflict, gin.H{
+		"error":    fmt.Sprintf("Reserved by %s until %s", reservation.User.Username, reservation.EndsAt.Format("Jan 2 15:04")),
+		"reserved": true,
+		"reservation": gin.H{
+			"username":  reservation.User.Username,
+			"starts_at": reservation.StartsAt,
+			"ends_at":   reservation.EndsAt,
+		},
+	}
+}
+
+// reservationOwner returns the owner of an entity the user wants to reserve, and the user share granting
+// access to it. Entities not shared with the user must be the user's own.
+func (h *Handler) reservationOwner(user *models.User, entityID string) (*models.User, *models.SharedEntity, bool) {
+	if share, found := h.findUserShare(user.ID, entityID); found {
+		return &share.Owner, share, true
+	}
+
+	// Owners reserve their own entities, e.g. for maintenance
+	if user.HAURL == "" || user.HAToken == "" {
+		return nil, nil, false
+	}
+	haClient := ha.NewClient(user.HAURL, user.HAToken)
+	if _, err := haClient.GetEntity(entityID); err != nil {
+		return nil, nil, false
+	}
+	return user, nil, true
+}
+
+// cancelUserReservations cancels a user's active reservations of an entity, e.g. after it was unshared
+func cancelUserReservations(ownerID, userID uint, entityID, reason string) {
+	var reservations []models.Reservation
+	if err := database.DB.Preload("User").
+		Where("owner_id = ? AND user_id = ? AND entity_id = ? AND status = ?", ownerID, userID, entityID, "active").
+		Find(&reservations).Error; err != nil {
+		log.Printf("Failed to look up reservations of %s: %v", entityID, err)
+		return
+	}
+	for i := range reservations {
+		if claimReservation(&reservations[i], "cancelled") {
+			finishReservation(&reservations[i], "cancelled", reason, true)
+		}
+	}
+}
+
+// validateReservationSlot checks the length of a slot and how far ahead it is
+func validateReservationSlot(startsAt, endsAt, now time.Time) error {
+	if !endsAt.After(startsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if endsAt.Sub(startsAt) > maxReservationHours*time.Hour {
+		return fmt.Errorf("reservations can be at most %d hours long", maxReservationHours)
+	}
+	if startsAt.After(now.AddDate(0, 0, maxReservationAheadDays)) {
+		return fmt.Errorf("reservations can start at most %d days ahead", maxReservationAheadDays)
+	}
+	return nil
+}
+
+// calendarRange parses the range of the reservation calendar
+func calendarRange(fromParam, toParam string) (time.Time, time.Time, error) {
+	from := time.Now()
+	if fromParam != "" {
+		parsed, err := time.Parse(time.RFC3339, fromParam)
+		if err != nil {
+			return from, from, errors.New("from must be an RFC 3339 time")
+		}
+		from = parsed
+	}
+
+	to := from.AddDate(0, 0, calendarDefaultDays)
+	if toParam != "" {
+		parsed, err := time.Parse(time.RFC3339, toParam)
+		if err != nil {
+			return from, to, errors.New("to must be an RFC 3339 time")
+		}
+		to = parsed
+	}
+
+	if !to.After(from) {
+		return from, to, errors.New("to must be after from")
+	}
+	if to.Sub(from) > maxCalendarDays*24*time.Hour {
+		return from, to, fmt.Errorf("the calendar can span at most %d days", maxCalendarDays)
+	}
+	return from, to, nil
+}
+
+// claimReservation moves an active reservation to the given status, unless another request or the
+// sweeper finished it first
+func claimReservation(reservation *models.Reservation, status string) bool {
+	result := database.DB.Model(&models.Reservation{}).
+		Where("id = ? AND status = ?", reservation.ID, "active").
+		Update("status", status)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	reservation.Status = status
+	return true
+}
+
+// finishReservation records why a reservation ended and publishes the event. With notify, the
+// reservation's user (which must be loaded) is told that someone else ended it.
+func finishReservation(reservation *models.Reservation, status, reason string, notify bool) {
+	now := time.Now()
+	reservation.Status = status
+	reservation.Reason = reason
+	reservation.FinishedAt = &now
+	if err := database.DB.Model(reservation).Updates(map[string]interface{}{
+		"reason":      reason,
+		"finished_at": now,
+	}).Error; err != nil {
+		log.Printf("Failed to save reservation %s: %v", reservation.ID, err)
+	}
+
+	eventType := events.ReservationCompleted
+	switch status {
+	case "released":
+		eventType = events.ReservationReleased
+	case "cancelled":
+		eventType = events.ReservationCancelled
+	}
+	publishReservationEvent(eventType, reservation)
+
+	if !notify {
+		return
+	}
+	notifyUser(&reservation.User, "reservation", "Reservation ended",
+		fmt.Sprintf("Your reservation of %s from %s was %s: %s", reservation.EntityID, reservation.StartsAt.Format("Jan 2 15:04"), status, reason),
+		map[string]interface{}{
+			"reservation_id": reservation.ID,
+			"entity_id":      reservation.EntityID,
+		})
+}
+
+// publishReservationEvent publishes a reservation lifecycle event to the entity's owner
+func publishReservationEvent(eventType string, reservation *models.Reservation) {
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: reservation.OwnerID,
+		Data: map[string]interface{}{
+			"reservation_id": reservation.ID,
+			"entity_id":      reservation.EntityID,
+			"user_id":        reservation.UserID,
+			"starts_at":      reservation.StartsAt,
+			"ends_at":        reservation.EndsAt,
+			"status":         reservation.Status,
+			"reason":         reservation.Reason,
+		},
+	})
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxAutoRevertMinutes = 24 * 60
+	revertJobListLimit   = 100
+)
+
+// revertRule describes how a trigger is reverted: the inverse service, and the states the
+// trigger leaves the entity in. Jobs are cancelled when the entity is no longer in one of them.
+type revertRule struct {
+	Inverse string
+	States  []string
+}
+
+// revertRules maps the services guests trigger to their inverse. Services without an entry
+// (e.g. "turn_off" or "toggle") are never reverted.
+var revertRules = map[string]revertRule{
+	"turn_on":    {Inverse: "turn_off", States: []string{"on"}},
+	"open_cover": {Inverse: "close_cover", States: []string{"open", "opening"}},
+	"open_valve": {Inverse: "close_valve", States: []string{"open", "opening"}},
+	"unlock":     {Inverse: "lock", States: []string{"unlocked", "unlocking"}},
+}
+
+// Domains whose "turn_on" has no inverse
+var unrevertableDomains = map[string]bool{
+	"scene":        true,
+	"button":       true,
+	"input_button": true,
+}
+
+// ListRevertJobs lists the user's auto-revert jobs (pending by default, ?status=all for recent jobs)
+func (h *Handler) ListRevertJobs(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	query := database.DB.Where("user_id = ?", userID)
+	switch status := c.DefaultQuery("status", "pending"); status {
+	case "all":
+		query = query.Order("created_at DESC").Limit(revertJobListLimit)
+	case "pending", "executed", "cancelled", "failed":
+		query = query.Where("status = ?", status).Order("due_at").Limit(revertJobListLimit)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status. Must be 'pending', 'executed', 'cancelled', 'failed' or 'all'"})
+		return
+	}
+
+	var jobs []models.RevertJob
+	if err := query.Find(&jobs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch auto-revert jobs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// CancelRevertJob cancels one of the user's pending auto-revert jobs, leaving the entity as it is
+func (h *Handler) CancelRevertJob(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var job models.RevertJob
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Auto-revert job not found"})
+		return
+	}
+
+	if !claimRevertJob(&job, "cancelled") {
+		c.JSON(http.StatusConflict, gin.H{"error": "Auto-revert job is no longer pending", "job": job})
+		return
+	}
+	finishRevertJob(&job, "cancelled", "cancelled by the owner")
+
+	c.JSON(http.StatusOK, job)
+}
+
+// RunRevertJobs executes the auto-revert jobs that are due
+func (h *Handler) RunRevertJobs() error {
+	var due []models.RevertJob
+	if err := database.DB.Where("status = ? AND due_at <= ?", "pending", time.Now()).Order("due_at").Find(&due).Error; err != nil {
+		return err
+	}
+
+	for i := range due {
+		if claimRevertJob(&due[i], "running") {
+			runRevertJob(&due[i])
+		}
+	}
+
+	if len(due) > 0 {
+		log.Printf("Auto-revert: processed %d due jobs", len(due))
+	}
+	return nil
+}
+
+// RecoverRevertJobs requeues jobs that were running when the server stopped. Call it on startup only.
+func (h *Handler) RecoverRevertJobs() error {
+	return database.DB.Model(&models.RevertJob{}).Where("status = ?", "running").Update("status", "pending").Error
+}
+
+// validateAutoRevert checks the auto-revert rule of a share entry or selector
+func validateAutoRevert(minutes int, accessMode string) error {
+	if minutes < 0 || minutes > maxAutoRevertMinutes {
+		return fmt.Errorf("must be between 0 and %d", maxAutoRevertMinutes)
+	}
+	if minutes > 0 && accessMode != "triggerable" {
+		return errors.New("only triggerable entities can be reverted")
+	}
+	return nil
+}
+
+// scheduleRevert is called after a share link trigger was executed. The trigger supersedes pending
+// jobs of the entity; if the entry has an auto-revert rule for the service, a new job is scheduled.
+func scheduleRevert(link *models.ShareLink, entry models.ShareEntry, service string) *models.RevertJob {
+	cancelRevertJobs(link.UserID, entry.EntityID, "superseded by a new trigger")
+
+	rule, ok := revertRules[service]
+	domain, _, _ := strings.Cut(entry.EntityID, ".")
+	if entry.AutoRevertMinutes <= 0 || !ok || unrevertableDomains[domain] {
+		return nil
+	}
+
+	job := models.RevertJob{
+		ID:             generateID(),
+		UserID:         link.UserID,
+		ShareLinkID:    link.ID,
+		EntityID:       entry.EntityID,
+		TriggerService: service,
+		Service:        rule.Inverse,
+		DueAt:          time.Now().Add(time.Duration(entry.AutoRevertMinutes) * time.Minute),
+		Status:         "pending",
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		log.Printf("Failed to schedule auto-revert of %s: %v", entry.EntityID, err)
+		return nil
+	}
+
+	publishRevertJobEvent(events.RevertScheduled, &job)
+	return &job
+}
+
+// cancelRevertJobs cancels the pending jobs of an entity
+func cancelRevertJobs(userID uint, entityID, reason string) {
+	var jobs []models.RevertJob
+	if err := database.DB.Where("user_id = ? AND entity_id = ? AND status = ?", userID, entityID, "pending").Find(&jobs).Error; err != nil {
+		log.Printf("Failed to look up auto-revert jobs of %s: %v", entityID, err)
+		return
+	}
+	for i := range jobs {
+		if claimRevertJob(&jobs[i], "cancelled") {
+			finishRevertJob(&jobs[i], "cancelled", reason)
+		}
+	}
+}
+
+// pendingReverts returns when the entities of a share link are reverted, by entity ID
+func pendingReverts(link *models.ShareLink) map[string]time.Time {
+	var jobs []models.RevertJob
+	database.DB.Where("share_link_id = ? AND status = ?", link.ID, "pending").Find(&jobs)
+
+	reverts := make(map[string]time.Time, len(jobs))
+	for _, job := range jobs {
+		reverts[job.EntityID] = job.DueAt
+	}
+	return reverts
+}
+
+// claimRevertJob moves a pending job to the given status, unless another request or the
+// scheduler claimed it first
+func claimRevertJob(job *models.RevertJob, status string) bool {
+	result := database.DB.Model(&models.RevertJob{}).
+		Where("id = ? AND status = ?", job.ID, "pending").
+		Update("status", status)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	job.Status = status
+	return true
+}
+
+// runRevertJob calls the inverse service with the owner's credentials, unless the entity's
+// state changed since the trigger (e.g. someone already switched it off manually)
+func runRevertJob(job *models.RevertJob) {
+	var owner models.User
+	if err := database.DB.First(&owner, job.UserID).Error; err != nil {
+		finishRevertJob(job, "failed", "owner not found")
+		return
+	}
+
+	haClient := ha.NewClient(owner.HAURL, owner.HAToken)
+	entity, err := haClient.GetEntity(job.EntityID)
+	if err != nil {
+		finishRevertJob(job, "failed", "failed to fetch state: "+err.Error())
+		return
+	}
+
+	if rule, ok := revertRules[job.TriggerService]; ok && !containsString(rule.States, entity.State) {
+		finishRevertJob(job, "cancelled", fmt.Sprintf("state changed to %s", entity.State))
+		return
+	}
+
+	domain, _, _ := strings.Cut(job.EntityID, ".")
+	if err := haClient.CallService(domain, job.Service, map[string]interface{}{"entity_id": job.EntityID}); err != nil {
+		finishRevertJob(job, "failed", err.Error())
+		return
+	}
+	finishRevertJob(job, "executed", "")
+}
+
+// finishRevertJob records the outcome of a job in the job itself, the share link's audit log and the
+// event bus. Failures are reported to the owner, since the entity was left on.
+func finishRevertJob(job *models.RevertJob, status, reason string) {
+	now := time.Now()
+	job.Status = status
+	job.Reason = reason
+	job.FinishedAt = &now
+	if err := database.DB.Save(job).Error; err != nil {
+		log.Printf("Failed to save auto-revert job %s: %v", job.ID, err)
+	}
+
+	recordAudit(models.AuditLog{
+		UserID:      job.UserID,
+		ShareLinkID: job.ShareLinkID,
+		EntityID:    job.EntityID,
+		Action:      "share_link.auto_revert",
+		Result:      status,
+	}, map[string]interface{}{
+		"service": job.Service,
+		"due_at":  job.DueAt,
+		"reason":  reason,
+	})
+
+	eventType := events.RevertExecuted
+	switch status {
+	case "cancelled":
+		eventType = events.RevertCancelled
+	case "failed":
+		eventType = events.RevertFailed
+	}
+	publishRevertJobEvent(eventType, job)
+
+	if status != "failed" {
+		return
+	}
+	var owner models.User
+	if err := database.DB.First(&owner, job.UserID).Error; err != nil {
+		return
+	}
+	notifyUser(&owner, "revert_job", "Auto-off failed",
+		fmt.Sprintf("Calling %s on %s failed: %s", job.Service, job.EntityID, reason),
+		map[string]interface{}{
+			"revert_job_id": job.ID,
+			"share_id":      job.ShareLinkID,
+			"entity_id":     job.EntityID,
+		})
+}
+
+// publishRevertJobEvent publishes an auto-revert job lifecycle event
+func publishRevertJobEvent(eventType string, job *models.RevertJob) {
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: job.UserID,
+		Data: map[string]interface{}{
+			"revert_job_id": job.ID,
+			"share_id":      job.ShareLinkID,
+			"entity_id":     job.EntityID,
+			"service":       job.Service,
+			"due_at":        job.DueAt,
+			"reason":        job.Reason,
+		},
+	})
+}
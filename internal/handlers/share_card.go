@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	minQRSize     = 128
+	maxQRSize     = 1024
+)
+
+// GetShareLinkQR renders the public URL of a share link as a QR code (PNG or SVG)
+func (h *Handler) GetShareLinkQR(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	shareID := c.Param("id")
+
+	var shareLink models.ShareLink
+	if err := database.DB.Where("id = ? AND user_id = ?", shareID, userID).First(&shareLink).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not owned by you"})
+		return
+	}
+
+	size := defaultQRSize
+	if sizeStr := c.Query("size"); sizeStr != "" {
+		parsed, err := strconv.Atoi(sizeStr)
+		if err != nil || parsed < minQRSize || parsed > maxQRSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid size. Must be between %d and %d", minQRSize, maxQRSize)})
+			return
+		}
+		size = parsed
+	}
+
+	url := h.shareLinkURL(c, &shareLink)
+
+	switch c.DefaultQuery("format", "png") {
+	case "png":
+		png, err := qrcode.Encode(url, qrcode.Medium, size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate QR code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", png)
+	case "svg":
+		svg, err := qrCodeSVG(url, size)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate QR code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", svg)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Must be 'png' or 'svg'"})
+	}
+}
+
+// GetShareLinkCard renders a printable guest card (PDF) for a share link
+func (h *Handler) GetShareLinkCard(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	shareID := c.Param("id")
+
+	var shareLink models.ShareLink
+	if err := database.DB.Preload("User").Where("id = ? AND user_id = ?", shareID, userID).First(&shareLink).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not owned by you"})
+		return
+	}
+
+	url := h.shareLinkURL(c, &shareLink)
+	png, err := qrcode.Encode(url, qrcode.Medium, 512)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate QR code"})
+		return
+	}
+
+	// List the entities currently matched by selectors, too
+	if _, err := h.resolveShareLinkEntries(&shareLink); err != nil {
+		log.Printf("Failed to resolve selectors of share link %s: %v", shareLink.ID, err)
+	}
+
+	// Resolve friendly names with the owner's HA credentials; fall back to raw entity IDs
+	haClient := ha.NewClient(shareLink.User.HAURL, shareLink.User.HAToken)
+	devices := shareDeviceNames(haClient, shareLink.Entries)
+
+	pdf := fpdf.New("P", "mm", "A5", "")
+	pdf.SetMargins(12, 12, 12)
+	pdf.SetAutoPageBreak(true, 12)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	contentWidth := pageWidth - 24
+
+	title := shareLink.Title
+	if title == "" {
+		title = "Welcome!"
+	}
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.MultiCell(contentWidth, 10, tr(title), "", "C", false)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(contentWidth, 6, tr("Scan the code to open your smart home controls"), "", 1, "C", false, 0, "")
+	pdf.Ln(2)
+
+	// QR code
+	qrSize := 70.0
+	pdf.RegisterImageOptionsReader("qr", fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(png))
+	pdf.ImageOptions("qr", (pageWidth-qrSize)/2, pdf.GetY(), qrSize, qrSize, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+	pdf.SetY(pdf.GetY() + qrSize + 2)
+	pdf.SetFont("Courier", "", 7)
+	pdf.CellFormat(contentWidth, 4, tr(url), "", 1, "C", false, 0, "")
+	pdf.Ln(3)
+
+	// Validity window
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(contentWidth, 6, tr("Validity"), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.MultiCell(contentWidth, 5, tr(describeShareValidity(&shareLink)), "", "L", false)
+	pdf.Ln(2)
+
+	// Instructions, as plain text of their markdown
+	if instructions := instructionsText(shareLink.Instructions); instructions != "" {
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(contentWidth, 6, tr("Instructions"), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.MultiCell(contentWidth, 5, tr(instructions), "", "L", false)
+		pdf.Ln(2)
+	}
+
+	// Devices
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(contentWidth, 6, tr("Your devices"), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 10)
+	for _, device := range devices {
+		pdf.CellFormat(contentWidth, 5, tr("- "+device), "", 1, "L", false, 0, "")
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate guest card"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="hassh-share-%s.pdf"`, shareLink.ID))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// shareURL returns the public URL of a share link
+func (h *Handler) shareURL(c *gin.Context, shareID string) string {
+	return h.publicBaseURL(c) + "/share/" + shareID
+}
+
+// shareLinkURL returns the URL guests open for a share link: the action page for action links (e.g. written
+// to NFC tags), the kiosk view for kiosk links, the share page otherwise
+func (h *Handler) shareLinkURL(c *gin.Context, link *models.ShareLink) string {
+	if isActionLink(link) {
+		return h.publicBaseURL(c) + "/a/" + link.ID
+	}
+	if link.Type == "kiosk" {
+		return h.publicBaseURL(c) + "/kiosk/" + link.ID
+	}
+	return h.shareURL(c, link.ID)
+}
+
+// publicBaseURL returns the public base URL of Hassh, preferring the configured PUBLIC_URL
+func (h *Handler) publicBaseURL(c *gin.Context) string {
+	if h.Config != nil && h.Config.PublicURL != "" {
+		return h.Config.PublicURL
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// qrCodeSVG encodes content as an SVG QR code with the given pixel size
+func qrCodeSVG(content string, size int) ([]byte, error) {
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+
+	bitmap := qr.Bitmap()
+	modules := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/>`, modules, modules)
+	fmt.Fprintf(&buf, `<path d="%s" fill="#000"/>`, path.String())
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), nil
+}
+
+// describeShareValidity returns a human readable description of a share link's validity window
+func describeShareValidity(link *models.ShareLink) string {
+	switch link.Type {
+	case "counter":
+		remaining := link.MaxAccess - link.AccessCount
+		if remaining < 0 {
+			remaining = 0
+		}
+		return fmt.Sprintf("Valid for %d more visits (of %d)", remaining, link.MaxAccess)
+	case "time":
+		return "Valid until " + link.ExpiresAt.Format("Mon, 02 Jan 2006 15:04 MST")
+	case "kiosk":
+		return "Kiosk link: works only on the first device that opens it"
+	default:
+		return "Valid until revoked by the owner"
+	}
+}
+
+// shareDeviceNames returns display names and access for the shared entities in their original order.
+// Owner-defined labels win over Home Assistant friendly names.
+func shareDeviceNames(haClient *ha.Client, entries models.ShareEntries) []string {
+	names := make(map[string]string, len(entries))
+	if entities, err := haClient.GetEntities(entries.EntityIDs()); err == nil {
+		for _, entity := range entities {
+			attributes, err := entity.Attributes.ToMap()
+			if err != nil {
+				continue
+			}
+			if name, ok := attributes["friendly_name"].(string); ok && name != "" {
+				names[entity.EntityID] = name
+			}
+		}
+	}
+
+	devices := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.EntityID
+		if entry.Display.Label != "" {
+			name = entry.Display.Label
+		} else if friendlyName, ok := names[entry.EntityID]; ok {
+			name = friendlyName
+		}
+
+		access := "view only"
+		if entry.AccessMode == "triggerable" {
+			access = "can control"
+		}
+		devices = append(devices, fmt.Sprintf("%s - %s", name, access))
+	}
+	return devices
+}
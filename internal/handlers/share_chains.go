@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxChainSteps        = 10
+	maxChainDelaySeconds = 300 // Per delay step
+	maxChainDataSize     = 4096
+)
+
+// runningChains holds the run IDs of the running action chains by share link and trigger entity,
+// so a trigger while the entry's chain is still running does not start it a second time
+var (
+	runningChainsMu sync.Mutex
+	runningChains   = make(map[string]string)
+)
+
+// chainStepPreview describes what a step of an action chain would do
+type chainStepPreview struct {
+	Step        int                    `json:"step"`
+	Type        string                 `json:"type"`
+	Description string                 `json:"description"`
+	Domain      string                 `json:"domain,omitempty"`
+	Service     string                 `json:"service,omitempty"`
+	Event       string                 `json:"event,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	Warnings    []string               `json:"warnings,omitempty"`
+}
+
+// PreviewActionChain validates an action chain and shows the calls it would make, without executing anything.
+// The chain is passed directly or taken from an entry of one of the user's share links.
+func (h *Handler) PreviewActionChain(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	user := c.MustGet("user").(*models.User)
+
+	var req struct {
+		Chain    *models.ActionChain `json:"chain"`
+		ShareID  string              `json:"share_id"`
+		EntityID string              `json:"entity_id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chain := req.Chain
+	if chain == nil {
+		var shareLink models.ShareLink
+		if err := database.DB.Where("id = ? AND user_id = ?", req.ShareID, userID).First(&shareLink).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not owned by you"})
+			return
+		}
+		entry, found := shareLink.Entries.Find(req.EntityID)
+		if !found || entry.Chain == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Entity has no action chain in this share link"})
+			return
+		}
+		chain = entry.Chain
+	}
+
+	normalized, err := normalizeActionChain(chain)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if normalized == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Action chain has no steps"})
+		return
+	}
+
+	// Look up the targets, so typos show up before a guest triggers the chain
+	haClient := ha.NewClient(user.HAURL, user.HAToken)
+	found := make(map[string]bool)
+	if entities, err := haClient.GetEntities(chainEntityIDs(normalized)); err == nil {
+		for _, entity := range entities {
+			found[entity.EntityID] = true
+		}
+	}
+
+	steps := make([]chainStepPreview, 0, len(normalized.Steps))
+	totalDelay := 0
+	for i, step := range normalized.Steps {
+		preview := chainStepPreview{Step: i + 1, Type: step.Type, Description: describeChainStep(step), Data: step.Data}
+		switch step.Type {
+		case "service":
+			preview.Domain, preview.Service, _ = strings.Cut(step.Service, ".")
+			if step.EntityID != "" {
+				preview.Data = chainServiceData(step)
+				if !found[step.EntityID] {
+					preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s was not found in your Home Assistant", step.EntityID))
+				}
+				if domain, _, _ := strings.Cut(step.EntityID, "."); domain != preview.Domain && preview.Domain != "homeassistant" {
+					preview.Warnings = append(preview.Warnings, fmt.Sprintf("%s is not a %s entity", step.EntityID, preview.Domain))
+				}
+			}
+		case "event":
+			preview.Event = step.Event
+		case "delay":
+			totalDelay += step.DelaySeconds
+		}
+		steps = append(steps, preview)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"services":            normalized.Services,
+		"steps":               steps,
+		"total_delay_seconds": totalDelay,
+	})
+}
+
+// normalizeActionChain validates an action chain. Chains without steps are removed (nil).
+func normalizeActionChain(chain *models.ActionChain) (*models.ActionChain, error) {
+	if chain == nil || len(chain.Steps) == 0 {
+		return nil, nil
+	}
+	if len(chain.Steps) > maxChainSteps {
+		return nil, fmt.Errorf("too many chain steps (max %d)", maxChainSteps)
+	}
+
+	services := make([]string, 0, len(chain.Services))
+	for _, service := range chain.Services {
+		service = strings.ToLower(strings.TrimSpace(service))
+		if service == "" {
+			continue
+		}
+		if !domainPattern.MatchString(service) {
+			return nil, fmt.Errorf("invalid chain trigger service %q", service)
+		}
+		services = append(services, service)
+	}
+
+	steps := make([]models.ActionStep, 0, len(chain.Steps))
+	for i, step := range chain.Steps {
+		normalized, err := normalizeChainStep(step)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chain step %d: %w", i+1, err)
+		}
+		steps = append(steps, normalized)
+	}
+
+	return &models.ActionChain{Services: services, Steps: steps}, nil
+}
+
+// normalizeChainStep validates a single step and drops the fields its type does not use
+func normalizeChainStep(step models.ActionStep) (models.ActionStep, error) {
+	if step.Data != nil {
+		data, err := json.Marshal(step.Data)
+		if err != nil || len(data) > maxChainDataSize {
+			return step, fmt.Errorf("data must be at most %d bytes of JSON", maxChainDataSize)
+		}
+	}
+
+	result := models.ActionStep{Type: strings.ToLower(strings.TrimSpace(step.Type)), ContinueOnError: step.ContinueOnError}
+	switch result.Type {
+	case "service":
+		result.Service = strings.ToLower(strings.TrimSpace(step.Service))
+		if !entityIDPattern.MatchString(result.Service) {
+			return step, fmt.Errorf("service must look like domain.service (e.g. light.turn_on), got %q", step.Service)
+		}
+		result.EntityID = strings.ToLower(strings.TrimSpace(step.EntityID))
+		if result.EntityID != "" && !entityIDPattern.MatchString(result.EntityID) {
+			return step, fmt.Errorf("invalid entity_id %q", step.EntityID)
+		}
+		result.Data = step.Data
+	case "event":
+		result.Event = strings.TrimSpace(step.Event)
+		if !domainPattern.MatchString(result.Event) {
+			return step, fmt.Errorf("event must consist of lowercase letters, digits and underscores, got %q", step.Event)
+		}
+		result.Data = step.Data
+	case "delay":
+		if step.DelaySeconds < 1 || step.DelaySeconds > maxChainDelaySeconds {
+			return step, fmt.Errorf("delay_seconds must be between 1 and %d", maxChainDelaySeconds)
+		}
+		result.DelaySeconds = step.DelaySeconds
+	default:
+		return step, errors.New("type must be 'service', 'event' or 'delay'")
+	}
+	return result, nil
+}
+
+// startActionChain runs the chain of a share entry in the background after a trigger of it succeeded.
+// It returns the ID of the run, or "" if the entry has no chain for the service. While the entry's
+// chain is still running, the trigger joins that run and its ID is returned instead.
+func (h *Handler) startActionChain(link *models.ShareLink, entry models.ShareEntry, service, clientIP string) string {
+	chain := entry.Chain
+	if chain == nil || len(chain.Steps) == 0 {
+		return ""
+	}
+	if len(chain.Services) > 0 && !containsString(chain.Services, service) {
+		return ""
+	}
+	if h.ctx.Err() != nil {
+		return "" // Shutting down
+	}
+
+	key := link.ID + ":" + entry.EntityID
+	runningChainsMu.Lock()
+	defer runningChainsMu.Unlock()
+	if runID, running := runningChains[key]; running {
+		log.Printf("Action chain %s of %s is still running, not starting it again", runID, entry.EntityID)
+		return runID
+	}
+
+	runID := generateID()
+	runningChains[key] = runID
+	owner := link.User
+	h.jobs.Add(1)
+	go func() {
+		defer h.jobs.Done()
+		defer func() {
+			runningChainsMu.Lock()
+			delete(runningChains, key)
+			runningChainsMu.Unlock()
+		}()
+		runActionChain(h.ctx, runID, owner, link.ID, entry.EntityID, *chain, clientIP)
+	}()
+	return runID
+}
+
+// runActionChain executes the steps of a chain in order and audits each of them. A failing step
+// stops the chain unless it allows errors; the remaining steps are recorded as skipped. Cancelling
+// ctx (on shutdown) stops the chain as well.
+func runActionChain(ctx context.Context, runID string, owner models.User, shareLinkID, triggerEntityID string, chain models.ActionChain, clientIP string) {
+	haClient := ha.NewClient(owner.HAURL, owner.HAToken)
+
+	failed := 0
+	stopped := false
+	for i, step := range chain.Steps {
+		result, stepErr := "executed", error(nil)
+		if !stopped && ctx.Err() != nil {
+			stopped = true
+		}
+		if stopped {
+			result = "skipped"
+		} else {
+			stepErr = executeChainStep(ctx, haClient, step)
+			if stepErr != nil {
+				result = "failed"
+				failed++
+				stopped = !step.ContinueOnError || ctx.Err() != nil
+			}
+		}
+
+		details := map[string]interface{}{
+			"run_id":         runID,
+			"trigger_entity": triggerEntityID,
+			"step":           i + 1,
+			"type":           step.Type,
+			"description":    describeChainStep(step),
+		}
+		if stepErr != nil {
+			details["error"] = stepErr.Error()
+		}
+		recordAudit(models.AuditLog{
+			UserID:      owner.ID,
+			ShareLinkID: shareLinkID,
+			EntityID:    step.EntityID,
+			Action:      "share_link.chain_step",
+			Result:      result,
+			ClientIP:    clientIP,
+		}, details)
+	}
+
+	eventType := events.ChainCompleted
+	if stopped {
+		eventType = events.ChainFailed
+		message := fmt.Sprintf("A step of the action chain of %s failed; the remaining steps were skipped", triggerEntityID)
+		if ctx.Err() != nil {
+			message = fmt.Sprintf("The action chain of %s was interrupted by a shutdown; the remaining steps were skipped", triggerEntityID)
+		}
+		notifyUser(&owner, "action_chain", "Action chain stopped", message,
+			map[string]interface{}{
+				"share_id":  shareLinkID,
+				"entity_id": triggerEntityID,
+				"run_id":    runID,
+			})
+	}
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: owner.ID,
+		Data: map[string]interface{}{
+			"run_id":    runID,
+			"share_id":  shareLinkID,
+			"entity_id": triggerEntityID,
+			"steps":     len(chain.Steps),
+			"failed":    failed,
+		},
+	})
+	log.Printf("Action chain %s of %s finished: %d steps, %d failed", runID, triggerEntityID, len(chain.Steps), failed)
+}
+
+// executeChainStep performs a single step of an action chain. Delays end early when ctx is cancelled
+func executeChainStep(ctx context.Context, haClient *ha.Client, step models.ActionStep) error {
+	switch step.Type {
+	case "service":
+		domain, service, _ := strings.Cut(step.Service, ".")
+		return haClient.CallService(domain, service, chainServiceData(step))
+	case "event":
+		return haClient.FireEvent(step.Event, step.Data)
+	case "delay":
+		select {
+		case <-ctx.Done():
+			return errors.New("interrupted by shutdown")
+		case <-time.After(time.Duration(step.DelaySeconds) * time.Second):
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown step type %q", step.Type)
+}
+
+// chainServiceData returns the service data of a service step, including its target entity
+func chainServiceData(step models.ActionStep) map[string]interface{} {
+	data := make(map[string]interface{}, len(step.Data)+1)
+	for key, value := range step.Data {
+		data[key] = value
+	}
+	if step.EntityID != "" {
+		data["entity_id"] = step.EntityID
+	}
+	return data
+}
+
+// chainEntityIDs returns the entities targeted by the service steps of a chain
+func chainEntityIDs(chain *models.ActionChain) []string {
+	ids := []string{}
+	for _, step := range chain.Steps {
+		if step.Type == "service" && step.EntityID != "" && !containsString(ids, step.EntityID) {
+			ids = append(ids, step.EntityID)
+		}
+	}
+	return ids
+}
+
+// describeChainStep summarizes a step for previews and the audit log
+func describeChainStep(step models.ActionStep) string {
+	switch step.Type {
+	case "service":
+		if step.EntityID != "" {
+			return fmt.Sprintf("Call %s on %s", step.Service, step.EntityID)
+		}
+		return "Call " + step.Service
+	case "event":
+		return "Fire event " + step.Event
+	case "delay":
+		return fmt.Sprintf("Wait %d seconds", step.DelaySeconds)
+	}
+	return step.Type
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxShareConditions      = 10
+	maxConditionValues      = 10
+	maxConditionMessageSize = 200
+)
+
+var entityIDPattern = regexp.MustCompile(`^[a-z0-9_]+\.[a-z0-9_]+$`)
+
+// normalizeShareConditions validates the conditions of a share and drops empty values
+func normalizeShareConditions(conditions models.ShareConditions) (models.ShareConditions, error) {
+	if len(conditions) > maxShareConditions {
+		return nil, fmt.Errorf("too many conditions (max %d)", maxShareConditions)
+	}
+
+	result := make(models.ShareConditions, 0, len(conditions))
+	for _, condition := range conditions {
+		condition.EntityID = strings.ToLower(strings.TrimSpace(condition.EntityID))
+		if !entityIDPattern.MatchString(condition.EntityID) {
+			return nil, fmt.Errorf("invalid condition entity_id %q", condition.EntityID)
+		}
+		condition.Attribute = strings.TrimSpace(condition.Attribute)
+		condition.Message = strings.TrimSpace(condition.Message)
+		if len(condition.Message) > maxConditionMessageSize {
+			return nil, fmt.Errorf("condition message for %s is too long (max %d characters)", condition.EntityID, maxConditionMessageSize)
+		}
+
+		condition.State = conditionValues(condition.State)
+		condition.NotState = conditionValues(condition.NotState)
+		if len(condition.State) > maxConditionValues || len(condition.NotState) > maxConditionValues {
+			return nil, fmt.Errorf("too many states in condition for %s (max %d)", condition.EntityID, maxConditionValues)
+		}
+
+		if len(condition.State) == 0 && len(condition.NotState) == 0 && condition.Above == nil && condition.Below == nil {
+			return nil, fmt.Errorf("condition for %s needs state, not_state, above or below", condition.EntityID)
+		}
+		if condition.Above != nil && condition.Below != nil && *condition.Above >= *condition.Below {
+			return nil, fmt.Errorf("condition for %s can never hold: above must be less than below", condition.EntityID)
+		}
+		result = append(result, condition)
+	}
+	return result, nil
+}
+
+// conditionValues trims state values and drops empty ones
+func conditionValues(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// checkShareConditions evaluates a share's conditions against the owner's Home Assistant.
+// It returns the status and body of the denial, or nil.
+func checkShareConditions(owner *models.User, conditions models.ShareConditions) (int, gin.H) {
+	if len(conditions) == 0 {
+		return http.StatusOK, nil
+	}
+
+	reasons := unmetShareConditions(owner, conditions)
+	if len(reasons) == 0 {
+		return http.StatusOK, nil
+	}
+	return http.StatusForbidden, gin.H{
+		"error":       "Currently unavailable because " + strings.Join(reasons, " and "),
+		"unavailable": true,
+		"reasons":     reasons,
+	}
+}
+
+// unmetShareConditions returns why each condition that does not hold fails. Entities that cannot be
+// fetched fail their conditions, so an unreachable Home Assistant keeps conditional shares closed.
+func unmetShareConditions(owner *models.User, conditions models.ShareConditions) []string {
+	ids := make([]string, 0, len(conditions))
+	seen := make(map[string]bool, len(conditions))
+	for _, condition := range conditions {
+		if !seen[condition.EntityID] {
+			seen[condition.EntityID] = true
+			ids = append(ids, condition.EntityID)
+		}
+	}
+
+	haClient := ha.NewClient(owner.HAURL, owner.HAToken)
+	fetched, _ := haClient.GetEntities(ids)
+	entities := make(map[string]*models.Entity, len(fetched))
+	for _, entity := range fetched {
+		entities[entity.EntityID] = entity
+	}
+
+	reasons := []string{}
+	for _, condition := range conditions {
+		entity := entities[condition.EntityID]
+		if entity != nil && shareConditionHolds(condition, entity) {
+			continue
+		}
+		reasons = append(reasons, describeUnmetCondition(condition, entity))
+	}
+	return reasons
+}
+
+// shareConditionHolds tests a condition against the current state of its entity
+func shareConditionHolds(condition models.ShareCondition, entity *models.Entity) bool {
+	value, ok := conditionValue(condition, entity)
+	if !ok {
+		return false
+	}
+
+	if len(condition.State) > 0 && !containsString(condition.State, value) {
+		return false
+	}
+	if containsString(condition.NotState, value) {
+		return false
+	}
+
+	if condition.Above != nil || condition.Below != nil {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		if condition.Above != nil && number <= *condition.Above {
+			return false
+		}
+		if condition.Below != nil && number >= *condition.Below {
+			return false
+		}
+	}
+	return true
+}
+
+// conditionValue returns the state, or the tested attribute, of an entity as text. Unavailable and
+// unknown entities only satisfy conditions that explicitly list those states.
+func conditionValue(condition models.ShareCondition, entity *models.Entity) (string, bool) {
+	if condition.Attribute == "" {
+		if entity.State == "unavailable" || entity.State == "unknown" {
+			return entity.State, containsString(condition.State, entity.State)
+		}
+		return entity.State, true
+	}
+
+	attributes, err := entity.Attributes.ToMap()
+	if err != nil {
+		return "", false
+	}
+	value, ok := attributes[condition.Attribute]
+	if !ok || value == nil {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// describeUnmetCondition explains to guests why a condition does not hold. It names the requirement,
+// never the entity's actual state, and prefers the owner's message.
+func describeUnmetCondition(condition models.ShareCondition, entity *models.Entity) string {
+	if condition.Message != "" {
+		return condition.Message
+	}
+
+	name := condition.EntityID
+	if entity != nil {
+		if attributes, err := entity.Attributes.ToMap(); err == nil {
+			if friendlyName, ok := attributes["friendly_name"].(string); ok && friendlyName != "" {
+				name = friendlyName
+			}
+		}
+	}
+	if condition.Attribute != "" {
+		name += " " + strings.ReplaceAll(condition.Attribute, "_", " ")
+	}
+	if entity == nil || (condition.Attribute == "" && (entity.State == "unavailable" || entity.State == "unknown")) {
+		return name + " is unavailable"
+	}
+
+	switch {
+	case len(condition.State) > 0:
+		return name + " is not " + strings.Join(condition.State, " or ")
+	case len(condition.NotState) > 0 && condition.Above == nil && condition.Below == nil:
+		// Worded as the requirement, not as the state the entity is in
+		return name + " must not be " + strings.Join(condition.NotState, " or ")
+	case condition.Above != nil && condition.Below != nil:
+		return fmt.Sprintf("%s is not between %s and %s", name, formatConditionNumber(*condition.Above), formatConditionNumber(*condition.Below))
+	case condition.Above != nil:
+		return fmt.Sprintf("%s is not above %s", name, formatConditionNumber(*condition.Above))
+	case condition.Below != nil:
+		return fmt.Sprintf("%s is not below %s", name, formatConditionNumber(*condition.Below))
+	}
+	return name + " is unavailable"
+}
+
+// formatConditionNumber formats a numeric threshold without trailing zeros
+func formatConditionNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
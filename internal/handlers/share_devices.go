@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/auth"
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	shareDeviceCookiePrefix   = "hassh_device_"
+	shareDeviceCredentialDays = 365 // Renewed on every visit and heartbeat
+	maxShareDevices           = 20
+	maxDeviceUserAgentLength  = 256
+	missedDeviceHeartbeats    = 3 // Devices not seen for this many kiosk heartbeat intervals are shown offline
+)
+
+// errShareDevicesFull is returned when every device slot of a share link is taken
+var errShareDevicesFull = errors.New("all devices of the share link are bound")
+
+// ListShareDevices lists the devices bound to one of the user's share links
+func (h *Handler) ListShareDevices(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var shareLink models.ShareLink
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&shareLink).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not owned by you"})
+		return
+	}
+
+	devices, err := h.shareDeviceItems(&shareLink)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"max_devices": shareLink.MaxDevices,
+		"devices":     devices,
+	})
+}
+
+// RevokeShareDevice evicts a device from a share link. Its credential stops working immediately
+// and, for device-bound links, its slot becomes free for the next new device.
+func (h *Handler) RevokeShareDevice(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var shareLink models.ShareLink
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&shareLink).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not owned by you"})
+		return
+	}
+
+	var device models.ShareDevice
+	if err := database.DB.Where("id = ? AND share_link_id = ?", c.Param("deviceId"), shareLink.ID).First(&device).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	if device.RevokedAt == nil {
+		now := time.Now()
+		device.RevokedAt = &now
+		if err := database.DB.Save(&device).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke device"})
+			return
+		}
+		publishShareDeviceEvent(events.ShareDeviceRevoked, &device)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device revoked", "device": device})
+}
+
+// validateMaxDevices checks the device limit of a share link
+func validateMaxDevices(maxDevices int) error {
+	if maxDevices < 0 || maxDevices > maxShareDevices {
+		return fmt.Errorf("invalid max_devices. Must be between 0 and %d", maxShareDevices)
+	}
+	return nil
+}
+
+// requiresShareDevice reports whether a share link only works on the devices bound to it
+func requiresShareDevice(link *models.ShareLink) bool {
+	return link.Type == "kiosk" || link.MaxDevices > 0
+}
+
+// checkShareDevice refuses requests from devices that are not bound to a device-bound or kiosk share link.
+// It returns the status and body of the denial, or nil.
+func checkShareDevice(c *gin.Context, link *models.ShareLink) (int, gin.H) {
+	if !requiresShareDevice(link) || hasShareDevice(c, link) {
+		return http.StatusOK, nil
+	}
+	if link.Type == "kiosk" {
+		return http.StatusForbidden, gin.H{"error": "This share link can only be used on its kiosk device", "kiosk": true}
+	}
+	return http.StatusForbidden, gin.H{"error": "This share link is already bound to other devices", "device_bound": true}
+}
+
+// bindShareDevice binds the requesting device to a device-bound share link on first use, as long as fewer than
+// max_devices are bound, and renews the credential of bound devices. Kiosk devices are bound by the kiosk page.
+func (h *Handler) bindShareDevice(c *gin.Context, link *models.ShareLink) (int, gin.H) {
+	if !requiresShareDevice(link) {
+		return http.StatusOK, nil
+	}
+
+	device := lookupShareDevice(c, link)
+	if device != nil && device.RevokedAt != nil {
+		// Evicted devices must not take the slot they were evicted from
+		return http.StatusForbidden, gin.H{"error": "Access of this device was revoked by the owner", "device_bound": true}
+	}
+	if device == nil {
+		if link.Type == "kiosk" {
+			return checkShareDevice(c, link)
+		}
+
+		var bound int64
+		if err := database.DB.Model(&models.ShareDevice{}).
+			Where("share_link_id = ? AND revoked_at IS NULL", link.ID).
+			Count(&bound).Error; err != nil {
+			return http.StatusInternalServerError, gin.H{"error": "Failed to check bound devices"}
+		}
+		if bound >= int64(link.MaxDevices) {
+			return checkShareDevice(c, link)
+		}
+
+		created, err := h.createShareDevice(c, link, link.MaxDevices)
+		if errors.Is(err, errShareDevicesFull) {
+			return checkShareDevice(c, link)
+		}
+		if err != nil {
+			return http.StatusInternalServerError, gin.H{"error": "Failed to bind this device"}
+		}
+		device = created
+	}
+
+	if err := h.touchShareDevice(c, link, device); err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to register this device"}
+	}
+	return http.StatusOK, nil
+}
+
+// hasShareDevice reports whether the request carries the credential of a device bound to the share link
+func hasShareDevice(c *gin.Context, link *models.ShareLink) bool {
+	_, ok := shareDevice(c, link)
+	return ok
+}
+
+// shareDevice returns the non-revoked device behind the request's device credential, if any
+func shareDevice(c *gin.Context, link *models.ShareLink) (*models.ShareDevice, bool) {
+	device := lookupShareDevice(c, link)
+	if device == nil || device.RevokedAt != nil {
+		return nil, false
+	}
+	return device, true
+}
+
+// lookupShareDevice returns the device behind the request's device credential, including revoked devices
+func lookupShareDevice(c *gin.Context, link *models.ShareLink) *models.ShareDevice {
+	token, err := c.Cookie(shareDeviceCookiePrefix + link.ID)
+	if err != nil || token == "" {
+		return nil
+	}
+
+	claims, err := auth.ValidateDeviceToken(token)
+	if err != nil || claims.ShareLinkID != link.ID {
+		return nil
+	}
+
+	var device models.ShareDevice
+	if err := database.DB.Where("id = ? AND share_link_id = ?", claims.DeviceID, link.ID).First(&device).Error; err != nil {
+		return nil
+	}
+	return &device
+}
+
+// createShareDevice binds the requesting device to a share link and lets the owner know. With a limit,
+// the device is only bound while fewer devices are bound (errShareDevicesFull otherwise)
+func (h *Handler) createShareDevice(c *gin.Context, link *models.ShareLink, limit int) (*models.ShareDevice, error) {
+	device := models.ShareDevice{
+		ID:          generateID(),
+		ShareLinkID: link.ID,
+		UserID:      link.UserID,
+	}
+	// Count after inserting in the same transaction, so devices bound at the same time cannot exceed the limit
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&device).Error; err != nil {
+			return err
+		}
+		if limit <= 0 {
+			return nil
+		}
+		var bound int64
+		if err := tx.Model(&models.ShareDevice{}).Where("share_link_id = ? AND revoked_at IS NULL", link.ID).Count(&bound).Error; err != nil {
+			return err
+		}
+		if bound > int64(limit) {
+			return errShareDevicesFull
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	shareName := link.Title
+	if shareName == "" {
+		shareName = "your share link"
+	}
+	notifyUser(&link.User, "share_device", "New device bound",
+		fmt.Sprintf("A device at %s was bound to %s", clientIP(c), shareName),
+		map[string]interface{}{
+			"share_id":  link.ID,
+			"device_id": device.ID,
+		})
+	publishShareDeviceEvent(events.ShareDeviceBound, &device)
+
+	log.Printf("Share link %s bound to device %s", link.ID, device.ID)
+	return &device, nil
+}
+
+// touchShareDevice records a visit or heartbeat of a bound device and renews its credential
+func (h *Handler) touchShareDevice(c *gin.Context, link *models.ShareLink, device *models.ShareDevice) error {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxDeviceUserAgentLength {
+		userAgent = userAgent[:maxDeviceUserAgentLength]
+	}
+	device.UserAgent = userAgent
+	device.ClientIP = clientIP(c).String()
+	device.LastSeenAt = time.Now()
+	if err := database.DB.Save(device).Error; err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().AddDate(0, 0, shareDeviceCredentialDays)
+	token, err := auth.GenerateDeviceToken(link.ID, device.ID, expiresAt)
+	if err != nil {
+		return err
+	}
+	h.setShareDeviceCookie(c, link, token, int(time.Until(expiresAt).Seconds()))
+	return nil
+}
+
+// setShareDeviceCookie stores the device credential in an HTTP-only cookie, so pages and the
+// share API receive it without scripts being able to read it
+func (h *Handler) setShareDeviceCookie(c *gin.Context, link *models.ShareLink, value string, maxAge int) {
+	secure := strings.HasPrefix(h.publicBaseURL(c), "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(shareDeviceCookiePrefix+link.ID, value, maxAge, "/", "", secure, true)
+}
+
+// clearShareDeviceCookie removes a revoked device credential from the device
+func (h *Handler) clearShareDeviceCookie(c *gin.Context, link *models.ShareLink) {
+	h.setShareDeviceCookie(c, link, "", -1)
+}
+
+// shareDeviceOnline reports whether a device was seen within the last few kiosk heartbeat intervals
+func (h *Handler) shareDeviceOnline(device *models.ShareDevice) bool {
+	window := time.Duration(missedDeviceHeartbeats*h.kioskHeartbeatInterval()) * time.Second
+	return device.RevokedAt == nil && time.Since(device.LastSeenAt) < window
+}
+
+// shareDeviceItems returns the devices of a share link, newest first, as shown to the owner
+func (h *Handler) shareDeviceItems(link *models.ShareLink) ([]gin.H, error) {
+	var devices []models.ShareDevice
+	if err := database.DB.Where("share_link_id = ?", link.ID).Order("created_at DESC").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]gin.H, 0, len(devices))
+	for i := range devices {
+		items = append(items, gin.H{
+			"id":           devices[i].ID,
+			"user_agent":   devices[i].UserAgent,
+			"client_ip":    devices[i].ClientIP,
+			"bound_at":     devices[i].CreatedAt,
+			"last_seen_at": devices[i].LastSeenAt,
+			"revoked_at":   devices[i].RevokedAt,
+			"online":       h.shareDeviceOnline(&devices[i]),
+		})
+	}
+	return items, nil
+}
+
+// publishShareDeviceEvent publishes a share device lifecycle event
+func publishShareDeviceEvent(eventType string, device *models.ShareDevice) {
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: device.UserID,
+		Data: map[string]interface{}{
+			"share_id":  device.ShareLinkID,
+			"device_id": device.ID,
+		},
+	})
+}
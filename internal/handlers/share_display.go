@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	maxLabelLength        = 64
+	maxIconLength         = 8
+	maxSectionLength      = 64
+	maxTitleLength        = 120
+	maxInstructionsLength = 4000
+)
+
+// instructionsMarkdown renders guest instructions. Raw HTML and unsafe link targets
+// (javascript:, data:, ...) are dropped because WithUnsafe is never enabled.
+var instructionsMarkdown = goldmark.New(
+	goldmark.WithExtensions(extension.Linkify, extension.Strikethrough),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// shareSection groups shared entities under a heading on the share page
+type shareSection struct {
+	Name      string   `json:"name"`
+	EntityIDs []string `json:"entity_ids"`
+}
+
+// sanitizeShareDisplay cleans owner-supplied display options of a share entry
+func sanitizeShareDisplay(display models.ShareEntryDisplay) (models.ShareEntryDisplay, error) {
+	var err error
+	if display.Label, err = sanitizeLine(display.Label, "label", maxLabelLength); err != nil {
+		return display, err
+	}
+	if display.Icon, err = sanitizeLine(display.Icon, "icon", maxIconLength); err != nil {
+		return display, err
+	}
+	if display.Section, err = sanitizeLine(display.Section, "section", maxSectionLength); err != nil {
+		return display, err
+	}
+	return display, nil
+}
+
+// sanitizeLine strips control characters and surrounding whitespace from a single-line text field
+func sanitizeLine(value, field string, maxLength int) (string, error) {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, value)
+	value = strings.Join(strings.Fields(value), " ")
+
+	if utf8.RuneCountInString(value) > maxLength {
+		return "", fmt.Errorf("%s must be at most %d characters", field, maxLength)
+	}
+	return value, nil
+}
+
+// sanitizeInstructions normalizes the markdown instructions block
+func sanitizeInstructions(value string) (string, error) {
+	value = strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ReplaceAll(value, "\r\n", "\n"))
+	value = strings.TrimSpace(value)
+
+	if utf8.RuneCountInString(value) > maxInstructionsLength {
+		return "", fmt.Errorf("instructions must be at most %d characters", maxInstructionsLength)
+	}
+	return value, nil
+}
+
+// renderInstructions converts markdown instructions to sanitized HTML
+func renderInstructions(markdown string) string {
+	if markdown == "" {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	if err := instructionsMarkdown.Convert([]byte(markdown), &buf); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// instructionsText converts markdown instructions to plain text for print. Emphasis and raw HTML are
+// dropped, list items get a bullet or number, and link targets follow the link text.
+func instructionsText(markdown string) string {
+	source := []byte(markdown)
+	document := instructionsMarkdown.Parser().Parse(text.NewReader(source))
+
+	var buf bytes.Buffer
+	var linkStarts []int
+	endBlock := func(node ast.Node) {
+		buf.WriteByte('\n')
+		if node.Parent() != nil && node.Parent().Kind() == ast.KindDocument {
+			buf.WriteByte('\n')
+		}
+	}
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		switch n := node.(type) {
+		case *ast.Text:
+			if entering {
+				buf.Write(n.Segment.Value(source))
+				if n.SoftLineBreak() || n.HardLineBreak() {
+					buf.WriteByte('\n')
+				}
+			}
+		case *ast.String:
+			if entering {
+				buf.Write(n.Value)
+			}
+		case *ast.AutoLink:
+			if entering {
+				buf.Write(n.URL(source))
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.Link:
+			if entering {
+				linkStarts = append(linkStarts, buf.Len())
+				break
+			}
+			start := linkStarts[len(linkStarts)-1]
+			linkStarts = linkStarts[:len(linkStarts)-1]
+			if label := buf.Bytes()[start:]; !bytes.Equal(label, n.Destination) {
+				fmt.Fprintf(&buf, " (%s)", n.Destination)
+			}
+		case *ast.RawHTML, *ast.HTMLBlock:
+			return ast.WalkSkipChildren, nil
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			if entering {
+				lines := node.Lines()
+				for i := 0; i < lines.Len(); i++ {
+					segment := lines.At(i)
+					buf.Write(segment.Value(source))
+				}
+				if node.Parent().Kind() == ast.KindDocument {
+					buf.WriteByte('\n')
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.ListItem:
+			if entering {
+				if list, ok := n.Parent().(*ast.List); ok && list.IsOrdered() {
+					number := list.Start
+					for sibling := n.PreviousSibling(); sibling != nil; sibling = sibling.PreviousSibling() {
+						number++
+					}
+					fmt.Fprintf(&buf, "%d. ", number)
+				} else {
+					buf.WriteString("- ")
+				}
+			}
+		case *ast.Paragraph, *ast.Heading, *ast.TextBlock, *ast.ThematicBreak:
+			if !entering {
+				endBlock(node)
+			}
+		case *ast.List:
+			if !entering && n.Parent().Kind() == ast.KindDocument {
+				buf.WriteByte('\n')
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// Nested blocks may end with several blank lines
+	plain := strings.TrimSpace(buf.String())
+	for strings.Contains(plain, "\n\n\n") {
+		plain = strings.ReplaceAll(plain, "\n\n\n", "\n\n")
+	}
+	return plain
+}
+
+// sortedShareEntries returns the entries ordered by their display order (stable for equal orders)
+func sortedShareEntries(entries models.ShareEntries) models.ShareEntries {
+	sorted := make(models.ShareEntries, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Display.Order < sorted[j].Display.Order
+	})
+	return sorted
+}
+
+// shareSections groups ordered entries by section, in order of first appearance
+func shareSections(entries models.ShareEntries) []shareSection {
+	sections := []shareSection{}
+	index := make(map[string]int)
+	for _, entry := range entries {
+		i, ok := index[entry.Display.Section]
+		if !ok {
+			i = len(sections)
+			index[entry.Display.Section] = i
+			sections = append(sections, shareSection{Name: entry.Display.Section})
+		}
+		sections[i].EntityIDs = append(sections[i].EntityIDs, entry.EntityID)
+	}
+	return sections
+}
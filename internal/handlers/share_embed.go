@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/auth"
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxFrameAncestors     = 10
+	defaultEmbedWidth     = 400
+	defaultEmbedHeight    = 300
+	embedRefreshSeconds   = 30
+	embedViewMinutes      = 10 // Refreshes and feed polls within this time continue a counted view
+	oEmbedCacheAgeSeconds = 300
+)
+
+// frameAncestorPattern matches CSP host sources such as https://wiki.example.com, https://*.example.com or http://grafana.local:3000
+var frameAncestorPattern = regexp.MustCompile(`^https?://(\*\.)?[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*(:[0-9]{1,5})?$`)
+
+// embedEntity is a shared entity as presented by the embeddable widget and JSON feed
+type embedEntity struct {
+	EntityID    string    `json:"entity_id"`
+	Label       string    `json:"label"`
+	Icon        string    `json:"icon,omitempty"`
+	Section     string    `json:"section,omitempty"`
+	State       string    `json:"state"`
+	Unit        string    `json:"unit_of_measurement,omitempty"`
+	LastChanged time.Time `json:"last_changed"`
+}
+
+// embedSection groups widget entities under a heading
+type embedSection struct {
+	Name     string
+	Entities []embedEntity
+}
+
+// normalizeEmbedSettings validates embed settings and fills in defaults
+func normalizeEmbedSettings(embed models.EmbedSettings) (models.EmbedSettings, error) {
+	embed.Theme = strings.ToLower(strings.TrimSpace(embed.Theme))
+	if embed.Theme == "" {
+		embed.Theme = "auto"
+	}
+	if !isValidEmbedTheme(embed.Theme) {
+		return embed, fmt.Errorf("invalid embed theme %q. Must be 'light', 'dark' or 'auto'", embed.Theme)
+	}
+
+	ancestors := make([]string, 0, len(embed.FrameAncestors))
+	seen := make(map[string]bool)
+	for _, ancestor := range embed.FrameAncestors {
+		ancestor = strings.TrimRight(strings.ToLower(strings.TrimSpace(ancestor)), "/")
+		if ancestor == "" || seen[ancestor] {
+			continue
+		}
+		if !frameAncestorPattern.MatchString(ancestor) {
+			return embed, fmt.Errorf("invalid frame ancestor %q. Must be an origin such as https://wiki.example.com or https://*.example.com", ancestor)
+		}
+		seen[ancestor] = true
+		ancestors = append(ancestors, ancestor)
+	}
+	if len(ancestors) > maxFrameAncestors {
+		return embed, fmt.Errorf("too many frame ancestors (max %d)", maxFrameAncestors)
+	}
+	embed.FrameAncestors = ancestors
+	return embed, nil
+}
+
+func isValidEmbedTheme(theme string) bool {
+	return theme == "light" || theme == "dark" || theme == "auto"
+}
+
+// SharePage serves the public share page, advertising oEmbed discovery for embeddable links
+func (h *Handler) SharePage(c *gin.Context) {
+	data := gin.H{}
+
+	var shareLink models.ShareLink
+	if err := database.DB.First(&shareLink, "id = ?", c.Param("id")).Error; err == nil && shareLink.Embed.Enabled {
+		data["OEmbedURL"] = h.oEmbedURL(c, shareLink.ID)
+		data["Title"] = shareLink.Title
+	}
+
+	c.HTML(http.StatusOK, "share.html", data)
+}
+
+// EmbedShareLink renders a minimal, read-only widget of a share link for use in iframes (public endpoint)
+func (h *Handler) EmbedShareLink(c *gin.Context) {
+	data := gin.H{"Theme": "auto"}
+
+	var shareLink models.ShareLink
+	if err := database.DB.Preload("User").First(&shareLink, "id = ?", c.Param("id")).Error; err != nil {
+		c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+		data["Error"] = "Share link not found"
+		c.HTML(http.StatusNotFound, "embed.html", data)
+		return
+	}
+
+	// Only the configured sites may frame the widget
+	c.Header("Content-Security-Policy", frameAncestorsPolicy(shareLink.Embed))
+
+	if !shareLink.Embed.Enabled {
+		data["Error"] = "Embedding is not enabled for this share link"
+		c.HTML(http.StatusForbidden, "embed.html", data)
+		return
+	}
+
+	data["Theme"] = embedTheme(c, shareLink.Embed)
+	data["Title"] = shareLink.Title
+	data["ShareURL"] = h.shareURL(c, shareLink.ID)
+	data["OEmbedURL"] = h.oEmbedURL(c, shareLink.ID)
+
+	// Check validity, network restriction and owner approval
+	if status, denial := checkShareAccess(c, &shareLink); denial != nil {
+		data["Error"] = denial["error"]
+		c.HTML(status, "embed.html", data)
+		return
+	}
+
+	// Count the first view only; refreshes pass on the view token
+	viewToken := recordEmbedView(c, &shareLink)
+
+	entities, err := h.fetchShareEntities(&shareLink)
+	if err != nil {
+		data["Error"] = "Failed to fetch entities"
+		c.HTML(http.StatusInternalServerError, "embed.html", data)
+		return
+	}
+
+	data["Sections"] = embedSections(embedEntities(&shareLink, entities))
+	data["RefreshSeconds"] = embedRefreshSeconds
+	if viewToken != "" {
+		query := c.Request.URL.Query()
+		query.Set("view", viewToken)
+		data["RefreshURL"] = "?" + query.Encode()
+	}
+	data["UpdatedAt"] = time.Now().Format("15:04")
+	c.HTML(http.StatusOK, "embed.html", data)
+}
+
+// GetShareFeed returns the entities of an embeddable share link as a compact JSON feed (public endpoint)
+func (h *Handler) GetShareFeed(c *gin.Context) {
+	var shareLink models.ShareLink
+	if err := database.DB.Preload("User").First(&shareLink, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	if !shareLink.Embed.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Embedding is not enabled for this share link"})
+		return
+	}
+
+	// Browsers on the allowed sites may read the feed directly
+	if origin := c.GetHeader("Origin"); origin != "" && allowsEmbedOrigin(shareLink.Embed, origin) {
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Vary", "Origin")
+	}
+
+	// Check validity, network restriction and owner approval
+	if status, denial := checkShareAccess(c, &shareLink); denial != nil {
+		c.JSON(status, denial)
+		return
+	}
+
+	// Count the first poll only; later polls pass on the view token
+	viewToken := recordEmbedView(c, &shareLink)
+
+	entities, err := h.fetchShareEntities(&shareLink)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch entities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         shareLink.ID,
+		"title":      shareLink.Title,
+		"share_url":  h.shareURL(c, shareLink.ID),
+		"updated_at": time.Now().UTC(),
+		"entities":   embedEntities(&shareLink, entities),
+		"view":       viewToken,
+	})
+}
+
+// OEmbed is the oEmbed provider endpoint for share and embed URLs (public endpoint, see https://oembed.com)
+func (h *Handler) OEmbed(c *gin.Context) {
+	if format := c.DefaultQuery("format", "json"); format != "json" {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Only the json format is supported"})
+		return
+	}
+
+	shareID, ok := shareIDFromURL(c.Query("url"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL is not a share link"})
+		return
+	}
+
+	var shareLink models.ShareLink
+	if err := database.DB.Preload("User").First(&shareLink, "id = ?", shareID).Error; err != nil || !shareLink.Embed.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or not embeddable"})
+		return
+	}
+
+	// Check validity, network restriction and owner approval (without counting an access)
+	if status, denial := checkShareAccess(c, &shareLink); denial != nil {
+		c.JSON(status, denial)
+		return
+	}
+
+	width := boundedDimension(c.Query("maxwidth"), defaultEmbedWidth)
+	height := boundedDimension(c.Query("maxheight"), defaultEmbedHeight)
+
+	title := shareLink.Title
+	if title == "" {
+		title = "Shared Home Assistant Entities"
+	}
+
+	embedURL := h.publicBaseURL(c) + "/embed/" + shareLink.ID
+	iframe := fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" style="border:0" title="%s" loading="lazy"></iframe>`,
+		template.HTMLEscapeString(embedURL), width, height, template.HTMLEscapeString(title))
+
+	c.JSON(http.StatusOK, gin.H{
+		"version":       "1.0",
+		"type":          "rich",
+		"provider_name": "Hassh",
+		"provider_url":  h.publicBaseURL(c),
+		"title":         title,
+		"html":          iframe,
+		"width":         width,
+		"height":        height,
+		"cache_age":     oEmbedCacheAgeSeconds,
+	})
+}
+
+// embedEntities pairs entity states with the display options of their share entries, in display order
+func embedEntities(link *models.ShareLink, entities []*models.Entity) []embedEntity {
+	states := make(map[string]*models.Entity, len(entities))
+	for _, entity := range entities {
+		states[entity.EntityID] = entity
+	}
+
+	items := make([]embedEntity, 0, len(link.Entries))
+	for _, entry := range sortedShareEntries(link.Entries) {
+		entity, ok := states[entry.EntityID]
+		if !ok {
+			continue
+		}
+
+		item := embedEntity{
+			EntityID:    entry.EntityID,
+			Label:       entry.Display.Label,
+			Icon:        entry.Display.Icon,
+			Section:     entry.Display.Section,
+			State:       entity.State,
+			LastChanged: entity.LastChanged,
+		}
+		if attributes, err := entity.Attributes.ToMap(); err == nil {
+			if item.Label == "" {
+				item.Label, _ = attributes["friendly_name"].(string)
+			}
+			item.Unit, _ = attributes["unit_of_measurement"].(string)
+		}
+		if item.Label == "" {
+			item.Label = entry.EntityID
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// embedSections groups widget entities by section, in order of first appearance
+func embedSections(items []embedEntity) []embedSection {
+	sections := []embedSection{}
+	index := make(map[string]int)
+	for _, item := range items {
+		i, ok := index[item.Section]
+		if !ok {
+			i = len(sections)
+			index[item.Section] = i
+			sections = append(sections, embedSection{Name: item.Section})
+		}
+		sections[i].Entities = append(sections[i].Entities, item)
+	}
+	return sections
+}
+
+// recordEmbedView counts a view of an embedded share link, unless the request passes the view token of
+// a counted view in its "view" query parameter. It returns the token to pass on with the next refresh or poll.
+func recordEmbedView(c *gin.Context, link *models.ShareLink) string {
+	if claims, err := auth.ValidateEmbedViewToken(c.Query("view")); err != nil || claims.ShareLinkID != link.ID {
+		recordShareAccess(link)
+	}
+
+	token, err := auth.GenerateEmbedViewToken(link.ID, time.Now().Add(embedViewMinutes*time.Minute))
+	if err != nil {
+		return ""
+	}
+	return token
+}
+
+// embedTheme returns the widget theme, letting the embedding site override the link's default
+func embedTheme(c *gin.Context, embed models.EmbedSettings) string {
+	if theme := c.Query("theme"); isValidEmbedTheme(theme) {
+		return theme
+	}
+	if isValidEmbedTheme(embed.Theme) {
+		return embed.Theme
+	}
+	return "auto"
+}
+
+// frameAncestorsPolicy returns the Content-Security-Policy restricting which sites may frame the widget
+func frameAncestorsPolicy(embed models.EmbedSettings) string {
+	if !embed.Enabled {
+		return "frame-ancestors 'none'"
+	}
+	return strings.Join(append([]string{"frame-ancestors 'self'"}, embed.FrameAncestors...), " ")
+}
+
+// allowsEmbedOrigin reports whether a browser origin matches one of the link's frame ancestors
+func allowsEmbedOrigin(embed models.EmbedSettings, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, ancestor := range embed.FrameAncestors {
+		if ancestor == origin {
+			return true
+		}
+
+		// https://*.example.com matches subdomains of example.com on the same scheme (and port)
+		scheme, host, found := strings.Cut(ancestor, "://*.")
+		if !found {
+			continue
+		}
+		originScheme, originHost, found := strings.Cut(origin, "://")
+		if found && originScheme == scheme && strings.HasSuffix(originHost, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// shareIDFromURL extracts the share link ID from a public share (/share/:id) or embed (/embed/:id) URL
+func shareIDFromURL(raw string) (string, bool) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(parts) != 2 || (parts[0] != "share" && parts[0] != "embed") || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// boundedDimension returns the default size, shrunk to the consumer's maximum if one is given
+func boundedDimension(maximum string, size int) int {
+	if limit, err := strconv.Atoi(maximum); err == nil && limit > 0 && limit < size {
+		return limit
+	}
+	return size
+}
+
+// oEmbedURL returns the oEmbed endpoint URL describing a share link
+func (h *Handler) oEmbedURL(c *gin.Context, shareID string) string {
+	return h.publicBaseURL(c) + "/api/oembed?format=json&url=" + url.QueryEscape(h.shareURL(c, shareID))
+}
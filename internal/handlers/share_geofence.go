@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultGeofenceZone        = "zone.home"
+	defaultGeofenceMaxAccuracy = 100.0 // meters
+	earthRadiusMeters          = 6371000.0
+)
+
+// geoPosition is a position reported by the guest's browser (Geolocation API)
+type geoPosition struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Accuracy  float64 `json:"accuracy"` // In meters
+}
+
+// geofenceCheck is the outcome of checking a reported position against a geofence
+type geofenceCheck struct {
+	Allowed  bool
+	Reason   string  // Guest-facing explanation when not allowed
+	Distance float64 // Distance from the center in meters (-1 when not evaluated)
+}
+
+// normalizeGeofence validates a geofence and fills in defaults
+func normalizeGeofence(geofence models.Geofence) (models.Geofence, error) {
+	if !geofence.Enabled {
+		return geofence, nil
+	}
+
+	geofence.Zone = strings.TrimSpace(geofence.Zone)
+	if geofence.Zone == "" && geofence.Latitude == 0 && geofence.Longitude == 0 {
+		geofence.Zone = defaultGeofenceZone
+	}
+
+	if geofence.Zone != "" {
+		if !strings.HasPrefix(geofence.Zone, "zone.") {
+			return geofence, errors.New("geofence zone must be a zone entity (e.g. zone.home)")
+		}
+		geofence.Latitude, geofence.Longitude = 0, 0
+	} else {
+		if geofence.Latitude < -90 || geofence.Latitude > 90 || geofence.Longitude < -180 || geofence.Longitude > 180 {
+			return geofence, errors.New("geofence coordinates are out of range")
+		}
+		if geofence.Radius <= 0 {
+			return geofence, errors.New("geofence radius is required when using coordinates")
+		}
+	}
+
+	if geofence.Radius < 0 {
+		return geofence, errors.New("geofence radius must not be negative")
+	}
+	if geofence.MaxAccuracy < 0 {
+		return geofence, errors.New("geofence max_accuracy must not be negative")
+	}
+	if geofence.MaxAccuracy == 0 {
+		geofence.MaxAccuracy = defaultGeofenceMaxAccuracy
+	}
+	return geofence, nil
+}
+
+// checkGeofence checks a reported position against the geofence.
+// An error is returned when the geofence center cannot be resolved from Home Assistant.
+func checkGeofence(haClient *ha.Client, geofence models.Geofence, position *geoPosition) (geofenceCheck, error) {
+	check := geofenceCheck{Distance: -1}
+
+	if position == nil {
+		check.Reason = "Your location is required to control this device"
+		return check, nil
+	}
+	if position.Latitude < -90 || position.Latitude > 90 || position.Longitude < -180 || position.Longitude > 180 {
+		check.Reason = "Your reported location is invalid"
+		return check, nil
+	}
+	if position.Accuracy <= 0 || position.Accuracy > geofence.MaxAccuracy {
+		check.Reason = fmt.Sprintf("Your location is not accurate enough (must be within %.0f m)", geofence.MaxAccuracy)
+		return check, nil
+	}
+
+	latitude, longitude, radius, err := geofenceCenter(haClient, geofence)
+	if err != nil {
+		return check, err
+	}
+
+	check.Distance = math.Round(haversineMeters(latitude, longitude, position.Latitude, position.Longitude))
+	if check.Distance > radius {
+		check.Reason = "You are too far away to control this device"
+		return check, nil
+	}
+
+	check.Allowed = true
+	return check, nil
+}
+
+// geofenceCenter returns the center and radius of a geofence, resolving zones via Home Assistant
+func geofenceCenter(haClient *ha.Client, geofence models.Geofence) (float64, float64, float64, error) {
+	if geofence.Zone == "" {
+		return geofence.Latitude, geofence.Longitude, geofence.Radius, nil
+	}
+
+	zone, err := haClient.GetEntity(geofence.Zone)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	attributes, err := zone.Attributes.ToMap()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	latitude, hasLatitude := attributes["latitude"].(float64)
+	longitude, hasLongitude := attributes["longitude"].(float64)
+	if !hasLatitude || !hasLongitude {
+		return 0, 0, 0, fmt.Errorf("%s has no coordinates", geofence.Zone)
+	}
+
+	radius := geofence.Radius
+	if radius == 0 {
+		zoneRadius, ok := attributes["radius"].(float64)
+		if !ok || zoneRadius <= 0 {
+			return 0, 0, 0, fmt.Errorf("%s has no radius", geofence.Zone)
+		}
+		radius = zoneRadius
+	}
+	return latitude, longitude, radius, nil
+}
+
+// haversineMeters returns the great-circle distance between two coordinates in meters
+func haversineMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// auditGeofenceCheck records the position a guest reported for a geofenced trigger
+func auditGeofenceCheck(c *gin.Context, link *models.ShareLink, entityID, service string, position *geoPosition, check geofenceCheck) {
+	result := "allowed"
+	if !check.Allowed {
+		result = "denied"
+	}
+
+	details := map[string]interface{}{
+		"service": service,
+	}
+	if position != nil {
+		details["latitude"] = position.Latitude
+		details["longitude"] = position.Longitude
+		details["accuracy"] = position.Accuracy
+	}
+	if check.Distance >= 0 {
+		details["distance"] = check.Distance
+	}
+	if check.Reason != "" {
+		details["reason"] = check.Reason
+	}
+
+	recordAudit(models.AuditLog{
+		UserID:      link.UserID,
+		ShareLinkID: link.ID,
+		EntityID:    entityID,
+		Action:      "share_link.trigger",
+		Result:      result,
+		ClientIP:    clientIP(c).String(),
+	}, details)
+}
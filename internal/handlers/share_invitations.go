@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxShareMessageLength = 500
+
+// ListShareInvitations returns the entities other users want to share with the current user,
+// directly or through one of the user's groups
+func (h *Handler) ListShareInvitations(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var invitations []models.SharedEntity
+	if err := database.DB.Preload("Owner").Preload("Group").
+		Where("(shared_with = ? AND status = ?) OR id IN (?)", userID, "pending", memberShareIDs(userID, "pending")).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share invitations"})
+		return
+	}
+	for i := range invitations {
+		// Group shares are accepted per member
+		invitations[i].Status = "pending"
+	}
+	annotateUserShares(invitations, time.Now())
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// AcceptShareInvitation accepts a share invitation, so the entity shows up in the user's shared entities
+func (h *Handler) AcceptShareInvitation(c *gin.Context) {
+	h.respondToShareInvitation(c, "accepted")
+}
+
+// DeclineShareInvitation declines a share invitation. The owner sees the declined share until they remove it
+func (h *Handler) DeclineShareInvitation(c *gin.Context) {
+	h.respondToShareInvitation(c, "declined")
+}
+
+// respondToShareInvitation accepts or declines a pending invitation of the user
+func (h *Handler) respondToShareInvitation(c *gin.Context, status string) {
+	user := c.MustGet("user").(*models.User)
+
+	var share models.SharedEntity
+	if err := database.DB.Preload("Owner").Where("id = ?", c.Param("id")).
+		Where("(shared_with = ? AND status = ?) OR id IN (?)", user.ID, "pending", memberShareIDs(user.ID, "pending")).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).First(&share).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	// Guard against responding twice at the same time
+	now := time.Now()
+	result := updateShareResponse(&share, user.ID, "pending", status, now)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to respond to invitation"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation was already answered"})
+		return
+	}
+	share.Status = status
+	share.RespondedAt = &now
+
+	eventType := events.SharedEntityAccepted
+	if status == "declined" {
+		eventType = events.SharedEntityDeclined
+	}
+	publishShareResponse(&share, user, eventType, status)
+
+	c.JSON(http.StatusOK, share)
+}
+
+// LeaveSharedEntity ends an accepted share with the user. Leaving a group share keeps the user in the
+// group. Reservations the user loses access to are cancelled
+func (h *Handler) LeaveSharedEntity(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	var share models.SharedEntity
+	if err := database.DB.Preload("Owner").Where("id = ?", c.Param("id")).
+		Where("(shared_with = ? AND status = ?) OR id IN (?)", user.ID, "accepted", memberShareIDs(user.ID, "accepted")).
+		First(&share).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shared entity not found"})
+		return
+	}
+
+	now := time.Now()
+	result := updateShareResponse(&share, user.ID, "accepted", "left", now)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave shared entity"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shared entity not found"})
+		return
+	}
+
+	h.releaseLostReservations(&share, []uint{user.ID})
+	publishShareResponse(&share, user, events.SharedEntityLeft, "left")
+
+	c.JSON(http.StatusOK, gin.H{"message": "You no longer have access to the shared entity"})
+}
+
+// inviteToShare notifies a user that an entity was shared with them and waits for them to accept
+func inviteToShare(share *models.SharedEntity, owner, recipient *models.User) {
+	message := fmt.Sprintf("%s wants to share %s with you", owner.Username, describeSharedTarget(share))
+	if share.Message != "" {
+		message += ": " + share.Message
+	}
+	notifyUser(recipient, "share_invitation", "Share invitation", message, map[string]interface{}{
+		"shared_entity_id": share.ID,
+	})
+
+	events.Publish(events.Event{
+		Type:   events.SharedEntityInvited,
+		UserID: owner.ID,
+		Data: map[string]interface{}{
+			"shared_entity_id": share.ID,
+			"entity_id":        share.EntityID,
+			"pattern":          share.Selector.Pattern,
+			"user_id":          recipient.ID,
+		},
+	})
+}
+
+// inviteGroupToShare asks the members of the group of a share to accept it. Members who declined
+// or left the share are invited again
+func inviteGroupToShare(share *models.SharedEntity, owner *models.User) {
+	for _, memberID := range groupMemberIDs(share.GroupID) {
+		inviteGroupMember(share, owner, memberID)
+	}
+}
+
+// inviteGroupMember asks a group member to accept a share with their group, unless they already
+// accepted it or have yet to respond
+func inviteGroupMember(share *models.SharedEntity, owner *models.User, memberID uint) {
+	if memberID == share.OwnerID {
+		return
+	}
+	var member models.User
+	if err := database.DB.First(&member, memberID).Error; err != nil {
+		return
+	}
+
+	var response models.SharedEntityMember
+	err := database.DB.Where("shared_entity_id = ? AND user_id = ?", share.ID, memberID).First(&response).Error
+	switch {
+	case err != nil:
+		if err := database.DB.Create(&models.SharedEntityMember{SharedEntityID: share.ID, UserID: memberID, Status: "pending"}).Error; err != nil {
+			return
+		}
+	case response.Status == "declined" || response.Status == "left":
+		if err := database.DB.Model(&response).Updates(map[string]interface{}{"status": "pending", "responded_at": nil}).Error; err != nil {
+			return
+		}
+	default:
+		return
+	}
+	inviteToShare(share, owner, &member)
+}
+
+// updateShareResponse changes the user's response to a share if it still has the expected status.
+// Shares with a group keep the response of each member
+func updateShareResponse(share *models.SharedEntity, userID uint, from, to string, at time.Time) *gorm.DB {
+	updates := map[string]interface{}{"status": to, "responded_at": at}
+	if share.GroupID != 0 {
+		return database.DB.Model(&models.SharedEntityMember{}).
+			Where("shared_entity_id = ? AND user_id = ? AND status = ?", share.ID, userID, from).Updates(updates)
+	}
+	return database.DB.Model(&models.SharedEntity{}).Where("id = ? AND status = ?", share.ID, from).Updates(updates)
+}
+
+// memberShareIDs is a subquery of the IDs of the group shares the user responded to with a status
+func memberShareIDs(userID uint, status string) *gorm.DB {
+	return database.DB.Model(&models.SharedEntityMember{}).Select("shared_entity_id").Where("user_id = ? AND status = ?", userID, status)
+}
+
+// publishShareResponse tells the owner of a share how the user responded to it
+func publishShareResponse(share *models.SharedEntity, user *models.User, eventType, status string) {
+	notifyUser(&share.Owner, "share_"+status, "Share "+status,
+		fmt.Sprintf("%s %s %s", user.Username, status, describeSharedTarget(share)),
+		map[string]interface{}{"shared_entity_id": share.ID})
+
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: share.OwnerID,
+		Data: map[string]interface{}{
+			"shared_entity_id": share.ID,
+			"entity_id":        share.EntityID,
+			"pattern":          share.Selector.Pattern,
+			"user_id":          user.ID,
+		},
+	})
+}
+
+// describeSharedTarget names the entity or selector of a user share in notifications
+func describeSharedTarget(share *models.SharedEntity) string {
+	if share.EntityID != "" {
+		return share.EntityID
+	}
+	if share.Selector.Pattern != "" {
+		return share.Selector.Pattern
+	}
+	return "the entities of the domains " + strings.Join(share.Selector.Domains, ", ")
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ThraaxSession/Hash/internal/middleware"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// clientIP returns the client IP resolved by the ClientIPMiddleware, falling back to the peer address
+func clientIP(c *gin.Context) net.IP {
+	if value, ok := c.Get(middleware.ClientIPKey); ok {
+		if ip := net.ParseIP(value.(string)); ip != nil {
+			return ip
+		}
+	}
+	return net.ParseIP(c.RemoteIP())
+}
+
+// normalizeIPRestriction trims and validates the IPs/CIDRs of an IP restriction
+func normalizeIPRestriction(restriction models.IPRestriction) (models.IPRestriction, error) {
+	var err error
+	if restriction.Allow, err = normalizeNetworks(restriction.Allow, "allow"); err != nil {
+		return restriction, err
+	}
+	if restriction.Deny, err = normalizeNetworks(restriction.Deny, "deny"); err != nil {
+		return restriction, err
+	}
+	return restriction, nil
+}
+
+func normalizeNetworks(values []string, list string) ([]string, error) {
+	var normalized []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			normalized = append(normalized, value)
+		}
+	}
+	if _, err := middleware.ParseNetworks(normalized); err != nil {
+		return nil, fmt.Errorf("invalid ip_restriction %s entry: %w", list, err)
+	}
+	return normalized, nil
+}
+
+// allowsClientIP reports whether the restriction permits the given client IP.
+// Deny entries take precedence; a non-empty allow list must contain the IP.
+func allowsClientIP(restriction models.IPRestriction, ip net.IP) bool {
+	if len(restriction.Allow) == 0 && len(restriction.Deny) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+
+	// Entries are validated on save, so parse errors only occur for corrupted rows
+	deny, err := middleware.ParseNetworks(restriction.Deny)
+	if err != nil || middleware.ContainsIP(deny, ip) {
+		return false
+	}
+
+	if len(restriction.Allow) == 0 {
+		return true
+	}
+	allow, err := middleware.ParseNetworks(restriction.Allow)
+	if err != nil {
+		return false
+	}
+	return middleware.ContainsIP(allow, ip)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/ThraaxSession/Hash/internal/policy"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	shareEntityPolicyTracked   = "tracked"   // Entities tracked by the owner, plus the allowlist
+	shareEntityPolicyAllowlist = "allowlist" // Only allowlisted entities
+	shareEntityPolicyOff       = "off"       // Any entity of the owner's Home Assistant
+)
+
+// shareEntityPolicy returns the configured policy for entities exposed through share links
+func (h *Handler) shareEntityPolicy() string {
+	if h.Config != nil && h.Config.ShareEntityPolicy != "" {
+		return h.Config.ShareEntityPolicy
+	}
+	return shareEntityPolicyTracked
+}
+
+// disallowedShareEntities returns the entity IDs the user may not expose through a share link
+func (h *Handler) disallowedShareEntities(userID uint, entityIDs []string) ([]string, error) {
+	entityPolicy := h.shareEntityPolicy()
+	if entityPolicy == shareEntityPolicyOff {
+		return nil, nil
+	}
+
+	var allowlist []string
+	if h.Config != nil {
+		allowlist = h.Config.ShareEntityAllowlist
+	}
+
+	tracked := make(map[string]bool)
+	if entityPolicy == shareEntityPolicyTracked {
+		var owned []string
+		if err := database.DB.Model(&models.Entity{}).
+			Where("user_id = ? AND entity_id IN ?", userID, entityIDs).
+			Pluck("entity_id", &owned).Error; err != nil {
+			return nil, err
+		}
+		for _, entityID := range owned {
+			tracked[entityID] = true
+		}
+	}
+
+	var disallowed []string
+	for _, entityID := range entityIDs {
+		if !tracked[entityID] && !policy.MatchesEntityPattern(allowlist, entityID) {
+			disallowed = append(disallowed, entityID)
+		}
+	}
+	return disallowed, nil
+}
+
+// checkShareEntries applies the share entity policy to the entries of a share link, including the
+// targets of their action chains. Unless the policy is off, service steps must name their target entity
+func (h *Handler) checkShareEntries(userID uint, entries models.ShareEntries) (int, gin.H) {
+	entityIDs := entries.EntityIDs()
+	for _, entry := range entries {
+		if entry.Chain == nil {
+			continue
+		}
+		if h.shareEntityPolicy() != shareEntityPolicyOff {
+			for i, step := range entry.Chain.Steps {
+				if step.Type == "service" && step.EntityID == "" {
+					return http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid chain for %s: step %d must have an entity_id", entry.EntityID, i+1)}
+				}
+			}
+		}
+		for _, entityID := range chainEntityIDs(entry.Chain) {
+			if !containsString(entityIDs, entityID) {
+				entityIDs = append(entityIDs, entityID)
+			}
+		}
+	}
+
+	disallowed, err := h.disallowedShareEntities(userID, entityIDs)
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to validate entities"}
+	}
+	if len(disallowed) > 0 {
+		return http.StatusForbidden, gin.H{"error": h.shareEntityPolicyError(), "entity_ids": disallowed}
+	}
+	return http.StatusOK, nil
+}
+
+// shareEntityPolicyError describes the configured policy to users whose share link violates it
+func (h *Handler) shareEntityPolicyError() string {
+	if h.shareEntityPolicy() == shareEntityPolicyAllowlist {
+		return "Only entities allowlisted by the administrator can be shared"
+	}
+	return "Only entities you track (or that are allowlisted by the administrator) can be shared"
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // Schedules name IANA time zones, which minimal images lack
+
+	"github.com/ThraaxSession/Hash/internal/models"
+)
+
+const maxScheduleWindows = 14
+
+var scheduleDays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"} // Indexed by time.Weekday
+
+// normalizeShareSchedule validates a share link's schedule
+func normalizeShareSchedule(schedule models.ShareSchedule) (models.ShareSchedule, error) {
+	if len(schedule.Windows) == 0 {
+		return models.ShareSchedule{}, nil
+	}
+	if len(schedule.Windows) > maxScheduleWindows {
+		return schedule, fmt.Errorf("too many schedule windows (max %d)", maxScheduleWindows)
+	}
+
+	schedule.Timezone = strings.TrimSpace(schedule.Timezone)
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return schedule, fmt.Errorf("invalid schedule timezone %q", schedule.Timezone)
+	}
+
+	windows := make([]models.ScheduleWindow, 0, len(schedule.Windows))
+	for _, window := range schedule.Windows {
+		start, startErr := parseClock(window.Start)
+		end, endErr := parseClock(window.End)
+		if startErr != nil || endErr != nil {
+			return schedule, fmt.Errorf("invalid schedule window %s-%s: times must be HH:MM", window.Start, window.End)
+		}
+		if start == end {
+			return schedule, fmt.Errorf("invalid schedule window %s-%s: start and end must differ", window.Start, window.End)
+		}
+
+		days := make([]string, 0, len(window.Days))
+		for _, day := range window.Days {
+			day = strings.ToLower(strings.TrimSpace(day))
+			if !containsString(scheduleDays, day) {
+				return schedule, fmt.Errorf("invalid schedule day %q. Must be one of %s", day, strings.Join(scheduleDays, ", "))
+			}
+			if !containsString(days, day) {
+				days = append(days, day)
+			}
+		}
+
+		windows = append(windows, models.ScheduleWindow{
+			Days:  days,
+			Start: formatClock(start),
+			End:   formatClock(end),
+		})
+	}
+	schedule.Windows = windows
+	return schedule, nil
+}
+
+// scheduleAllows reports whether a schedule has a window open at the given time. Windows ending
+// before they start run past midnight into the next day.
+func scheduleAllows(schedule models.ShareSchedule, now time.Time) bool {
+	if len(schedule.Windows) == 0 {
+		return true
+	}
+
+	if schedule.Timezone != "" {
+		if location, err := time.LoadLocation(schedule.Timezone); err == nil {
+			now = now.In(location)
+		}
+	}
+	today := scheduleDays[now.Weekday()]
+	yesterday := scheduleDays[(now.Weekday()+6)%7]
+	minute := now.Hour()*60 + now.Minute()
+
+	for _, window := range schedule.Windows {
+		start, startErr := parseClock(window.Start)
+		end, endErr := parseClock(window.End)
+		if startErr != nil || endErr != nil {
+			continue
+		}
+
+		if start < end {
+			if onScheduleDay(window, today) && minute >= start && minute < end {
+				return true
+			}
+			continue
+		}
+		if (onScheduleDay(window, today) && minute >= start) || (onScheduleDay(window, yesterday) && minute < end) {
+			return true
+		}
+	}
+	return false
+}
+
+// onScheduleDay reports whether a window opens on the given day
+func onScheduleDay(window models.ScheduleWindow, day string) bool {
+	return len(window.Days) == 0 || containsString(window.Days, day)
+}
+
+// parseClock parses "HH:MM" into minutes since midnight. "24:00" is accepted as the end of the day.
+func parseClock(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(strings.TrimSpace(value), "%d:%d", &hours, &minutes); err != nil {
+		return 0, err
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// formatClock formats minutes since midnight as "HH:MM"
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
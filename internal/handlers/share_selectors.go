@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxShareSelectors  = 10
+	maxSelectorMatches = 50 // Hard cap on the entities a share's selectors may resolve to
+)
+
+var domainPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// selectorMatch is an entity matched by one of a share's selectors
+type selectorMatch struct {
+	Entity   *models.Entity
+	Selector int // Index of the first matching selector
+}
+
+// selectorResolution is the outcome of resolving selectors against the owner's Home Assistant
+type selectorResolution struct {
+	Matches   []selectorMatch
+	Excluded  []string // Matching entities the share entity policy does not allow to share
+	Truncated bool     // More than maxSelectorMatches entities matched
+}
+
+// normalizeEntitySelector validates a selector's pattern and domains
+func normalizeEntitySelector(selector models.EntitySelector) (models.EntitySelector, error) {
+	selector.Pattern = strings.TrimSpace(selector.Pattern)
+	if selector.Pattern != "" {
+		if _, err := path.Match(selector.Pattern, ""); err != nil {
+			return selector, fmt.Errorf("invalid pattern %q", selector.Pattern)
+		}
+	}
+
+	domains := make([]string, 0, len(selector.Domains))
+	for _, domain := range selector.Domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" {
+			continue
+		}
+		if !domainPattern.MatchString(domain) {
+			return selector, fmt.Errorf("invalid domain %q", domain)
+		}
+		domains = append(domains, domain)
+	}
+	selector.Domains = domains
+
+	if selector.IsEmpty() {
+		return selector, fmt.Errorf("a selector needs a pattern or domains")
+	}
+	return selector, nil
+}
+
+// buildShareSelectors validates the selectors of a share link. Selectors without an access mode use defaultMode.
+func buildShareSelectors(selectors []models.ShareSelector, defaultMode string) (models.ShareSelectors, error) {
+	if len(selectors) > maxShareSelectors {
+		return nil, fmt.Errorf("too many selectors (max %d)", maxShareSelectors)
+	}
+	if defaultMode == "" {
+		defaultMode = "readonly"
+	}
+
+	result := make(models.ShareSelectors, 0, len(selectors))
+	for _, selector := range selectors {
+		entitySelector, err := normalizeEntitySelector(selector.EntitySelector)
+		if err != nil {
+			return nil, err
+		}
+		selector.EntitySelector = entitySelector
+
+		if selector.AccessMode == "" {
+			selector.AccessMode = defaultMode
+		}
+		if !isValidAccessMode(selector.AccessMode) {
+			return nil, fmt.Errorf("invalid access_mode for selector %s. Must be 'readonly' or 'triggerable'", describeSelector(entitySelector))
+		}
+
+		if err := validateAutoRevert(selector.AutoRevertMinutes, selector.AccessMode); err != nil {
+			return nil, fmt.Errorf("invalid auto_revert_minutes for selector %s: %w", describeSelector(entitySelector), err)
+		}
+
+		// Every match is labelled with its own name
+		display, err := sanitizeShareDisplay(selector.Display)
+		if err != nil {
+			return nil, fmt.Errorf("invalid display options for selector %s: %w", describeSelector(entitySelector), err)
+		}
+		display.Label = ""
+		selector.Display = display
+
+		result = append(result, selector)
+	}
+	return result, nil
+}
+
+// resolveSelectors matches the owner's current Home Assistant states against the selectors.
+// Entities in skip (e.g. explicitly shared ones) are ignored, and entities the share entity
+// policy does not allow are excluded. Matches are sorted by entity ID and capped at maxSelectorMatches.
+func (h *Handler) resolveSelectors(owner *models.User, selectors []models.EntitySelector, skip map[string]bool) (*selectorResolution, error) {
+	resolution := &selectorResolution{}
+	if len(selectors) == 0 {
+		return resolution, nil
+	}
+
+	states, err := ha.NewClient(owner.HAURL, owner.HAToken).GetAllStates()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].EntityID < states[j].EntityID
+	})
+
+	var candidates []selectorMatch
+	for _, entity := range states {
+		if skip[entity.EntityID] {
+			continue
+		}
+		for i, selector := range selectors {
+			if selector.Matches(entity.EntityID) {
+				candidates = append(candidates, selectorMatch{Entity: entity, Selector: i})
+				break
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return resolution, nil
+	}
+
+	candidateIDs := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		candidateIDs[i] = candidate.Entity.EntityID
+	}
+	disallowed, err := h.disallowedShareEntities(owner.ID, candidateIDs)
+	if err != nil {
+		return nil, err
+	}
+	excluded := make(map[string]bool, len(disallowed))
+	for _, entityID := range disallowed {
+		excluded[entityID] = true
+	}
+	resolution.Excluded = disallowed
+
+	for _, candidate := range candidates {
+		if excluded[candidate.Entity.EntityID] {
+			continue
+		}
+		if len(resolution.Matches) == maxSelectorMatches {
+			resolution.Truncated = true
+			break
+		}
+		resolution.Matches = append(resolution.Matches, candidate)
+	}
+	return resolution, nil
+}
+
+// resolveShareLinkEntries adds the entities currently matched by the link's selectors to its entries
+// and returns their states (nil when the link has no selectors)
+func (h *Handler) resolveShareLinkEntries(link *models.ShareLink) ([]*models.Entity, error) {
+	if len(link.Selectors) == 0 {
+		return nil, nil
+	}
+
+	selectors := make([]models.EntitySelector, len(link.Selectors))
+	for i, selector := range link.Selectors {
+		selectors[i] = selector.EntitySelector
+	}
+	explicit := make(map[string]bool, len(link.Entries))
+	for _, entityID := range link.Entries.EntityIDs() {
+		explicit[entityID] = true
+	}
+
+	resolution, err := h.resolveSelectors(&link.User, selectors, explicit)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]*models.Entity, 0, len(resolution.Matches))
+	for _, match := range resolution.Matches {
+		selector := link.Selectors[match.Selector]
+		link.Entries = append(link.Entries, models.ShareEntry{
+			EntityID:          match.Entity.EntityID,
+			AccessMode:        selector.AccessMode,
+			AllowedServices:   selector.AllowedServices,
+			RequiresApproval:  selector.RequiresApproval,
+			AutoRevertMinutes: selector.AutoRevertMinutes,
+			Display:           selector.Display,
+		})
+		entities = append(entities, match.Entity)
+	}
+	return entities, nil
+}
+
+// findUserShare returns the user share granting the user access to an entity. Shares with the user
+// and with the user's groups add up, so the most permissive one is returned, preferring direct shares
+func (h *Handler) findUserShare(userID uint, entityID string) (*models.SharedEntity, bool) {
+	now := time.Now()
+	var shares []models.SharedEntity
+	if err := database.DB.Preload("Owner").Scopes(activeUserShares(now), sharedWithUser(userID)).Where("entity_id = ?", entityID).Order("group_id").Find(&shares).Error; err != nil {
+		return nil, false
+	}
+
+	best := bestUserShare(shares, now)
+	if best != nil && shareRank(best, now) == fullShareRank {
+		return best, true
+	}
+	if selectorShare, found := h.findSelectorShare(userID, entityID); found {
+		if best == nil || shareRank(selectorShare, now) > shareRank(best, now) {
+			return selectorShare, true
+		}
+	}
+	return best, best != nil
+}
+
+// findSelectorShare returns the most permissive user share whose selector currently grants the user access to an entity
+func (h *Handler) findSelectorShare(userID uint, entityID string) (*models.SharedEntity, bool) {
+	now := time.Now()
+	var shares []models.SharedEntity
+	if err := database.DB.Preload("Owner").Scopes(activeUserShares(now), sharedWithUser(userID)).Where("entity_id = ?", "").Order("group_id").Find(&shares).Error; err != nil {
+		return nil, false
+	}
+
+	var matching []models.SharedEntity
+	for i := range shares {
+		if !shares[i].Selector.Matches(entityID) {
+			continue
+		}
+
+		// The entity must be within the share's (capped, policy-filtered) matches
+		resolution, err := h.resolveSelectors(&shares[i].Owner, []models.EntitySelector{shares[i].Selector}, nil)
+		if err != nil {
+			continue
+		}
+		for _, match := range resolution.Matches {
+			if match.Entity.EntityID == entityID {
+				matching = append(matching, shares[i])
+				break
+			}
+		}
+	}
+
+	best := bestUserShare(matching, now)
+	return best, best != nil
+}
+
+// fullShareRank is the rank of a share that is available now, triggerable and needs no approval
+const fullShareRank = 7
+
+// shareRank orders user shares by how much they allow at the given time
+func shareRank(share *models.SharedEntity, now time.Time) int {
+	rank := 0
+	if scheduleAllows(share.Schedule, now) {
+		rank += 4
+	}
+	if share.AccessMode == "triggerable" {
+		rank += 2
+	}
+	if !share.RequiresApproval {
+		rank++
+	}
+	return rank
+}
+
+// bestUserShare returns the highest ranked of the shares, the first one on ties
+func bestUserShare(shares []models.SharedEntity, now time.Time) *models.SharedEntity {
+	var best *models.SharedEntity
+	for i := range shares {
+		if best == nil || shareRank(&shares[i], now) > shareRank(best, now) {
+			best = &shares[i]
+		}
+	}
+	return best
+}
+
+// mergeUserShares keeps the best share per owner and entity, in the order the entities first appear
+func mergeUserShares(shares []models.SharedEntity, now time.Time) []models.SharedEntity {
+	type key struct {
+		ownerID  uint
+		entityID string
+	}
+	index := make(map[key]int, len(shares))
+	merged := make([]models.SharedEntity, 0, len(shares))
+	for _, share := range shares {
+		k := key{share.OwnerID, share.EntityID}
+		if i, ok := index[k]; ok {
+			if shareRank(&share, now) > shareRank(&merged[i], now) {
+				merged[i] = share
+			}
+			continue
+		}
+		index[k] = len(merged)
+		merged = append(merged, share)
+	}
+	return merged
+}
+
+// expandSelectorShares replaces user shares with selectors by one share per currently matching entity
+func (h *Handler) expandSelectorShares(shares []models.SharedEntity) []models.SharedEntity {
+	expanded := make([]models.SharedEntity, 0, len(shares))
+	for _, share := range shares {
+		if share.Selector.IsEmpty() {
+			expanded = append(expanded, share)
+			continue
+		}
+
+		resolution, err := h.resolveSelectors(&share.Owner, []models.EntitySelector{share.Selector}, nil)
+		if err != nil {
+			continue
+		}
+		for _, match := range resolution.Matches {
+			matched := share
+			matched.EntityID = match.Entity.EntityID
+			expanded = append(expanded, matched)
+		}
+	}
+	return expanded
+}
+
+// PreviewSelectors shows which of the user's entities currently match the given selectors
+func (h *Handler) PreviewSelectors(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	if user.HAURL == "" || user.HAToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please configure Home Assistant in Settings first"})
+		return
+	}
+
+	var req struct {
+		Selectors []models.EntitySelector `json:"selectors" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Selectors) == 0 || len(req.Selectors) > maxShareSelectors {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Between 1 and %d selectors are required", maxShareSelectors)})
+		return
+	}
+	for i, selector := range req.Selectors {
+		normalized, err := normalizeEntitySelector(selector)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Selectors[i] = normalized
+	}
+
+	resolution, err := h.resolveSelectors(user, req.Selectors, nil)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch entities from Home Assistant: " + err.Error()})
+		return
+	}
+
+	matches := make([]gin.H, 0, len(resolution.Matches))
+	for _, match := range resolution.Matches {
+		item := gin.H{
+			"entity_id": match.Entity.EntityID,
+			"state":     match.Entity.State,
+			"selector":  match.Selector,
+		}
+		if attributes, err := match.Entity.Attributes.ToMap(); err == nil {
+			if name, ok := attributes["friendly_name"].(string); ok {
+				item["friendly_name"] = name
+			}
+		}
+		matches = append(matches, item)
+	}
+
+	excluded := resolution.Excluded
+	if excluded == nil {
+		excluded = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"matches":     matches,
+		"count":       len(matches),
+		"truncated":   resolution.Truncated,
+		"excluded":    excluded,
+		"max_matches": maxSelectorMatches,
+	})
+}
+
+// describeSelector returns a readable form of a selector for error messages
+func describeSelector(selector models.EntitySelector) string {
+	if len(selector.Domains) == 0 {
+		return selector.Pattern
+	}
+	domains := "domains " + strings.Join(selector.Domains, ",")
+	if selector.Pattern == "" {
+		return domains
+	}
+	return selector.Pattern + " (" + domains + ")"
+}
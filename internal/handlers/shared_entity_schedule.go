@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// parseUserShareExpiry parses the expires_at of a user share. An empty value means no expiry
+func parseUserShareExpiry(value string, now time.Time) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires_at format. Use RFC3339 format")
+	}
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+	return &expiresAt, nil
+}
+
+// activeUserShares limits a query of user shares to accepted ones that have not expired
+func activeUserShares(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ?", "accepted").Where("expires_at IS NULL OR expires_at > ?", now)
+	}
+}
+
+// checkUserShareSchedule denies access to a user share outside of its schedule
+func checkUserShareSchedule(share *models.SharedEntity, now time.Time) (int, gin.H) {
+	if !scheduleAllows(share.Schedule, now) {
+		return http.StatusForbidden, gin.H{"error": "Share is not available at this time", "schedule": true}
+	}
+	return 0, nil
+}
+
+// annotateUserShares fills in whether user shares are available now and how long their access lasts
+func annotateUserShares(shares []models.SharedEntity, now time.Time) {
+	for i := range shares {
+		share := &shares[i]
+		share.Available = share.ExpiresAt == nil || share.ExpiresAt.After(now)
+		share.Available = share.Available && scheduleAllows(share.Schedule, now)
+
+		var ends *time.Time
+		if share.ExpiresAt != nil {
+			ends = share.ExpiresAt
+		}
+		if share.Available {
+			if closes, ok := scheduleClosesAt(share.Schedule, now); ok && (ends == nil || closes.Before(*ends)) {
+				ends = &closes
+			}
+		}
+		if ends != nil {
+			remaining := int64(ends.Sub(now).Seconds())
+			if remaining < 0 {
+				remaining = 0
+			}
+			share.RemainingSeconds = &remaining
+		}
+	}
+}
+
+// scheduleClosesAt returns when the window open at the given time closes, following windows that
+// continue each other. It reports false without windows or when the schedule stays open for a week
+func scheduleClosesAt(schedule models.ShareSchedule, now time.Time) (time.Time, bool) {
+	if len(schedule.Windows) == 0 || !scheduleAllows(schedule, now) {
+		return time.Time{}, false
+	}
+
+	location := now.Location()
+	if schedule.Timezone != "" {
+		if loaded, err := time.LoadLocation(schedule.Timezone); err == nil {
+			location = loaded
+		}
+	}
+
+	// Schedules can only close at the end of a window, so check those of the coming week in order
+	local := now.In(location)
+	var candidates []time.Time
+	for day := 0; day <= 7; day++ {
+		for _, window := range schedule.Windows {
+			end, err := parseClock(window.End)
+			if err != nil {
+				continue
+			}
+			closes := time.Date(local.Year(), local.Month(), local.Day()+day, end/60, end%60, 0, 0, location)
+			if closes.After(now) {
+				candidates = append(candidates, closes)
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+	for _, closes := range candidates {
+		if !scheduleAllows(schedule, closes) {
+			return closes, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// SweepSharedEntities deletes expired user shares and releases the reservations they held
+func (h *Handler) SweepSharedEntities() error {
+	var expired []models.SharedEntity
+	if err := database.DB.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).Find(&expired).Error; err != nil {
+		return err
+	}
+
+	for _, share := range expired {
+		// Another sweep or the owner may have removed the share meanwhile
+		result := database.DB.Delete(&models.SharedEntity{}, share.ID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		database.DB.Where("shared_entity_id = ?", share.ID).Delete(&models.SharedEntityMember{})
+
+		h.releaseLostReservations(&share, shareRecipients(&share))
+		events.Publish(events.Event{
+			Type:   events.SharedEntityExpired,
+			UserID: share.OwnerID,
+			Data: map[string]interface{}{
+				"shared_entity_id": share.ID,
+				"entity_id":        share.EntityID,
+				"pattern":          share.Selector.Pattern,
+				"user_id":          share.SharedWith,
+				"group_id":         share.GroupID,
+			},
+		})
+	}
+	return nil
+}
@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxWebhookEventTypes      = 20
+	webhookDeliveryTimeout    = 10 * time.Second
+	webhookRetryBaseDelay     = 30 * time.Second // Doubled after every failed attempt
+	webhookRetryMaxDelay      = time.Hour
+	webhookDeliveryRetention  = 7 * 24 * time.Hour // Finished deliveries are deleted afterwards
+	maxWebhookResponseLogSize = 200
+)
+
+// webhookHTTPClient delivers the webhooks of admins, who may post to services on the internal network.
+// Redirects are not followed for anyone, so a 3xx response is a failed delivery.
+var webhookHTTPClient = &http.Client{
+	Timeout:       webhookDeliveryTimeout,
+	CheckRedirect: refuseWebhookRedirect,
+}
+
+// publicWebhookHTTPClient delivers the webhooks of other users. It refuses to connect to internal
+// addresses; the check runs on the resolved address, so a hostname cannot be pointed elsewhere later.
+var publicWebhookHTTPClient = &http.Client{
+	Timeout:       webhookDeliveryTimeout,
+	CheckRedirect: refuseWebhookRedirect,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: webhookDeliveryTimeout, Control: refuseInternalDial}).DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: webhookDeliveryTimeout,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// internalNetworks are ranges webhooks of non-admins may not reach besides loopback, private,
+// link-local (including cloud metadata endpoints), unspecified and multicast addresses
+var internalNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT, also used by some metadata services
+}
+
+// webhookQueued wakes the dispatcher when deliveries were queued, so events go out without waiting for the next interval
+var webhookQueued = make(chan struct{}, 1)
+
+// WebhookQueued returns a channel that receives when new webhook deliveries were queued
+func WebhookQueued() <-chan struct{} {
+	return webhookQueued
+}
+
+// webhookPayload is the JSON body of an outbound webhook request
+type webhookPayload struct {
+	ID     string                 `json:"id"` // Delivery ID, the same for every attempt
+	Type   string                 `json:"type"`
+	UserID uint                   `json:"user_id"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+	Time   time.Time              `json:"time"`
+}
+
+// ListWebhookSubscriptions lists the user's outbound webhook subscriptions
+func (h *Handler) ListWebhookSubscriptions(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var subscriptions []models.WebhookSubscription
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&subscriptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook subscriptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// CreateWebhookSubscription subscribes a URL to events. Its signing secret is only returned here and on rotation.
+func (h *Handler) CreateWebhookSubscription(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	user := c.MustGet("user").(*models.User)
+
+	var req struct {
+		Name       string   `json:"name"`
+		URL        string   `json:"url" binding:"required"`
+		EventTypes []string `json:"event_types"` // Empty subscribes to all events
+		AllUsers   bool     `json:"all_users"`   // Admins only
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.AllUsers && !user.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can subscribe to the events of all users"})
+		return
+	}
+
+	subscription := models.WebhookSubscription{
+		ID:         generateID(),
+		UserID:     userID,
+		Name:       req.Name,
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		AllUsers:   req.AllUsers,
+		Secret:     generateWebhookSecret(),
+		Active:     true,
+	}
+	if err := normalizeWebhookSubscription(&subscription, user.IsAdmin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&subscription).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook subscription"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"subscription": subscription,
+		"secret":       subscription.Secret,
+	})
+}
+
+// UpdateWebhookSubscription changes the URL, event filter, name or active state of a subscription
+func (h *Handler) UpdateWebhookSubscription(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	user := c.MustGet("user").(*models.User)
+
+	var subscription models.WebhookSubscription
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&subscription).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook subscription not found"})
+		return
+	}
+
+	var req struct {
+		Name       *string   `json:"name"`
+		URL        *string   `json:"url"`
+		EventTypes *[]string `json:"event_types"` // An empty list subscribes to all events
+		AllUsers   *bool     `json:"all_users"`
+		Active     *bool     `json:"active"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		subscription.Name = *req.Name
+	}
+	if req.URL != nil {
+		subscription.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		subscription.EventTypes = *req.EventTypes
+	}
+	if req.AllUsers != nil {
+		if *req.AllUsers && !user.IsAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can subscribe to the events of all users"})
+			return
+		}
+		subscription.AllUsers = *req.AllUsers
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+	if err := normalizeWebhookSubscription(&subscription, user.IsAdmin); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(&subscription).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook subscription"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// DeleteWebhookSubscription deletes a subscription and its queued and logged deliveries
+func (h *Handler) DeleteWebhookSubscription(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.WebhookSubscription{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook subscription"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook subscription not found"})
+		return
+	}
+	database.DB.Where("subscription_id = ?", c.Param("id")).Delete(&models.WebhookDelivery{})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook subscription deleted successfully"})
+}
+
+// RotateWebhookSubscriptionSecret replaces the signing secret of a subscription. Queued retries are signed with the new secret.
+func (h *Handler) RotateWebhookSubscriptionSecret(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var subscription models.WebhookSubscription
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&subscription).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook subscription not found"})
+		return
+	}
+
+	subscription.Secret = generateWebhookSecret()
+	if err := database.DB.Model(&subscription).Update("secret", subscription.Secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": subscription.Secret})
+}
+
+// ListWebhookDeliveries is the delivery log of a subscription: its most recent deliveries, optionally filtered by status
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var subscription models.WebhookSubscription
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&subscription).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook subscription not found"})
+		return
+	}
+
+	query := database.DB.Where("subscription_id = ?", subscription.ID)
+	if status := c.Query("status"); status != "" && status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at DESC").Limit(auditLogLimit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhook deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RetryWebhookDelivery queues a failed delivery again with a fresh set of attempts
+func (h *Handler) RetryWebhookDelivery(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var delivery models.WebhookDelivery
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&delivery).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook delivery not found"})
+		return
+	}
+
+	result := database.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ?", delivery.ID, "failed").
+		Updates(map[string]interface{}{"status": "pending", "attempts": 0, "next_attempt_at": time.Now()})
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed deliveries can be retried", "delivery": delivery})
+		return
+	}
+	signalWebhookQueue()
+
+	database.DB.First(&delivery, "id = ?", delivery.ID)
+	c.JSON(http.StatusOK, delivery)
+}
+
+// QueueWebhookDeliveries queues an event for every active subscription that receives it. Subscribe it to the events bus.
+func (h *Handler) QueueWebhookDeliveries(event events.Event) {
+	var subscriptions []models.WebhookSubscription
+	if err := database.DB.Preload("User").
+		Where("active = ? AND (user_id = ? OR all_users = ?)", true, event.UserID, true).
+		Find(&subscriptions).Error; err != nil {
+		log.Printf("Failed to load webhook subscriptions for %s: %v", event.Type, err)
+		return
+	}
+
+	queued := 0
+	for _, subscription := range subscriptions {
+		// All-users subscriptions stop receiving other users' events when their owner is no longer an admin
+		if subscription.UserID != event.UserID && !subscription.User.IsAdmin {
+			continue
+		}
+		if !subscribesTo(subscription.EventTypes, event.Type) {
+			continue
+		}
+
+		delivery := models.WebhookDelivery{
+			ID:             generateID(),
+			SubscriptionID: subscription.ID,
+			UserID:         subscription.UserID,
+			EventType:      event.Type,
+			Status:         "pending",
+			NextAttemptAt:  time.Now(),
+		}
+		payload, err := json.Marshal(webhookPayload{ID: delivery.ID, Type: event.Type, UserID: event.UserID, Data: event.Data, Time: event.Time})
+		if err != nil {
+			log.Printf("Failed to encode webhook payload for %s: %v", event.Type, err)
+			return
+		}
+		delivery.Payload = payload
+
+		if err := database.DB.Create(&delivery).Error; err != nil {
+			log.Printf("Failed to queue webhook delivery for %s: %v", event.Type, err)
+			continue
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		signalWebhookQueue()
+	}
+}
+
+// DeliverWebhooks sends the deliveries that are due and deletes finished deliveries past their retention
+func (h *Handler) DeliverWebhooks(maxAttempts int) error {
+	var due []models.WebhookDelivery
+	if err := database.DB.Where("status = ? AND next_attempt_at <= ?", "pending", time.Now()).
+		Order("next_attempt_at").Find(&due).Error; err != nil {
+		return err
+	}
+
+	for i := range due {
+		if claimPendingDelivery(&due[i]) {
+			sendWebhookDelivery(&due[i], maxAttempts)
+		}
+	}
+
+	if len(due) > 0 {
+		log.Printf("Webhooks: processed %d due deliveries", len(due))
+	}
+
+	return database.DB.Where("status IN ? AND updated_at < ?", []string{"delivered", "failed"}, time.Now().Add(-webhookDeliveryRetention)).
+		Delete(&models.WebhookDelivery{}).Error
+}
+
+// RecoverWebhookDeliveries requeues deliveries that were being sent when the server stopped. Call it on startup only.
+func (h *Handler) RecoverWebhookDeliveries() error {
+	return database.DB.Model(&models.WebhookDelivery{}).Where("status = ?", "sending").Update("status", "pending").Error
+}
+
+// claimPendingDelivery marks a pending delivery as being sent, so concurrent runs never send it twice
+func claimPendingDelivery(delivery *models.WebhookDelivery) bool {
+	result := database.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ?", delivery.ID, "pending").
+		Update("status", "sending")
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	delivery.Status = "sending"
+	return true
+}
+
+// sendWebhookDelivery makes one attempt to deliver an event. Failed attempts are retried with exponential
+// backoff until maxAttempts is reached.
+func sendWebhookDelivery(delivery *models.WebhookDelivery, maxAttempts int) {
+	delivery.Attempts++
+
+	var subscription models.WebhookSubscription
+	err := database.DB.Preload("User").First(&subscription, "id = ?", delivery.SubscriptionID).Error
+	if err != nil {
+		err = errors.New("subscription was deleted")
+		delivery.Attempts = maxAttempts
+	} else if !subscription.Active {
+		err = errors.New("subscription is disabled")
+		delivery.Attempts = maxAttempts
+	} else {
+		delivery.ResponseStatus, err = postWebhook(&subscription, delivery)
+	}
+
+	updates := map[string]interface{}{
+		"attempts":        delivery.Attempts,
+		"response_status": delivery.ResponseStatus,
+		"last_error":      "",
+	}
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status, delivery.DeliveredAt = "delivered", &now
+		updates["delivered_at"] = now
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status, delivery.LastError = "failed", err.Error()
+		updates["last_error"] = delivery.LastError
+		log.Printf("Webhook delivery %s of %s failed after %d attempts: %v", delivery.ID, delivery.EventType, delivery.Attempts, err)
+	default:
+		delivery.Status, delivery.LastError = "pending", err.Error()
+		delivery.NextAttemptAt = time.Now().Add(webhookRetryDelay(delivery.Attempts))
+		updates["last_error"] = delivery.LastError
+		updates["next_attempt_at"] = delivery.NextAttemptAt
+	}
+	updates["status"] = delivery.Status
+
+	if err := database.DB.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// postWebhook sends a delivery's payload, signed like inbound webhooks: X-Hassh-Signature is "sha256=" and the
+// hex HMAC-SHA256 of "<X-Hassh-Timestamp>.<body>". Every response other than 2xx is an error.
+func postWebhook(subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Hassh-Webhook")
+	request.Header.Set("X-Hassh-Event", delivery.EventType)
+	request.Header.Set("X-Hassh-Delivery", delivery.ID)
+	request.Header.Set("X-Hassh-Timestamp", timestamp)
+	request.Header.Set("X-Hassh-Signature", "sha256="+hex.EncodeToString(signWebhook(subscription.Secret, timestamp, delivery.Payload)))
+
+	client := publicWebhookHTTPClient
+	if subscription.User.IsAdmin {
+		client = webhookHTTPClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxWebhookResponseLogSize))
+		return response.StatusCode, fmt.Errorf("HTTP %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return response.StatusCode, nil
+}
+
+// webhookRetryDelay returns the backoff before the next attempt after the given number of failed attempts
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBaseDelay
+	for i := 1; i < attempts && delay < webhookRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMaxDelay {
+		return webhookRetryMaxDelay
+	}
+	return delay
+}
+
+// subscribesTo reports whether an event type matches a subscription's filter (empty matches every event)
+func subscribesTo(eventTypes []string, eventType string) bool {
+	if len(eventTypes) == 0 {
+		return true
+	}
+	for _, pattern := range eventTypes {
+		if matched, _ := path.Match(pattern, eventType); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeWebhookSubscription validates the URL and event filter of a subscription. Unless allowInternal
+// is set (for admins), the URL must not point to an internal address.
+func normalizeWebhookSubscription(subscription *models.WebhookSubscription, allowInternal bool) error {
+	subscription.Name = strings.TrimSpace(subscription.Name)
+	if len(subscription.Name) > maxWebhookNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxWebhookNameLength)
+	}
+
+	subscription.URL = strings.TrimSpace(subscription.URL)
+	parsed, err := url.Parse(subscription.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid url %q: must be an http or https URL", subscription.URL)
+	}
+	if !allowInternal {
+		if err := checkPublicHost(parsed.Hostname()); err != nil {
+			return fmt.Errorf("invalid url %q: %w", subscription.URL, err)
+		}
+	}
+
+	if len(subscription.EventTypes) > maxWebhookEventTypes {
+		return fmt.Errorf("too many event types (max %d)", maxWebhookEventTypes)
+	}
+	eventTypes := make(models.StringList, 0, len(subscription.EventTypes))
+	for _, eventType := range subscription.EventTypes {
+		eventType = strings.ToLower(strings.TrimSpace(eventType))
+		if eventType == "" {
+			continue
+		}
+		if _, err := path.Match(eventType, ""); err != nil {
+			return fmt.Errorf("invalid event type %q", eventType)
+		}
+		if !containsString(eventTypes, eventType) {
+			eventTypes = append(eventTypes, eventType)
+		}
+	}
+	subscription.EventTypes = eventTypes
+	return nil
+}
+
+// checkPublicHost resolves a webhook's host and rejects it if any of its addresses is internal
+func checkPublicHost(host string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookDeliveryTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if isInternalAddress(addr) {
+			return errors.New("webhooks cannot be sent to internal addresses")
+		}
+	}
+	return nil
+}
+
+// refuseInternalDial stops the connections of public webhook deliveries to internal addresses
+func refuseInternalDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || isInternalAddress(addr) {
+		return fmt.Errorf("%s is an internal address", host)
+	}
+	return nil
+}
+
+// isInternalAddress reports whether an address belongs to the local host or network
+func isInternalAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// refuseWebhookRedirect makes the client return redirects instead of following them
+func refuseWebhookRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// signalWebhookQueue wakes the dispatcher without blocking
+func signalWebhookQueue() {
+	select {
+	case webhookQueued <- struct{}{}:
+	default:
+	}
+}
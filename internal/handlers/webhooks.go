@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThraaxSession/Hash/internal/database"
+	"github.com/ThraaxSession/Hash/internal/events"
+	"github.com/ThraaxSession/Hash/internal/ha"
+	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxWebhookBodySize     = 64 << 10
+	maxWebhookDataSize     = 4096
+	maxWebhookNameLength   = 120
+	webhookTimestampWindow = 5 * time.Minute // Maximum age (and clock skew) of a signed request
+)
+
+// webhookPlaceholder matches "{{ path.to.value }}" placeholders in webhook data templates
+var webhookPlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_-]+(?:\.[A-Za-z0-9_-]+)*)\s*\}\}`)
+
+// webhookDeliveries remembers the signatures received within the timestamp window, so a captured
+// request cannot be replayed while its timestamp is still accepted
+var webhookDeliveries = struct {
+	sync.Mutex
+	seen map[string]time.Time
+}{seen: make(map[string]time.Time)}
+
+// ListWebhooks lists the user's inbound webhooks
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var webhooks []models.Webhook
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// CreateWebhook creates an inbound webhook. Its signing secret is only returned here and on rotation.
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var req struct {
+		Name     string                 `json:"name"`
+		EntityID string                 `json:"entity_id" binding:"required"`
+		Service  string                 `json:"service" binding:"required"`
+		Data     models.WebhookTemplate `json:"data"` // "{{ path }}" placeholders are filled from the payload
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhook := models.Webhook{
+		ID:       generateID(),
+		UserID:   userID,
+		Name:     req.Name,
+		EntityID: req.EntityID,
+		Service:  req.Service,
+		Data:     req.Data,
+		Secret:   generateWebhookSecret(),
+		Active:   true,
+	}
+	if err := normalizeWebhook(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Webhooks expose entities to external systems like share links do
+	if status, denial := h.checkWebhookEntity(userID, webhook.EntityID); denial != nil {
+		c.JSON(status, denial)
+		return
+	}
+
+	if err := database.DB.Create(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": webhook,
+		"secret":  webhook.Secret,
+		"url":     h.webhookURL(c, webhook.ID),
+	})
+}
+
+// UpdateWebhook changes the target, data template, name or active state of a webhook
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var webhook models.Webhook
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	var req struct {
+		Name     *string                 `json:"name"`
+		EntityID *string                 `json:"entity_id"`
+		Service  *string                 `json:"service"`
+		Data     *models.WebhookTemplate `json:"data"` // An empty object removes the data
+		Active   *bool                   `json:"active"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Name != nil {
+		webhook.Name = *req.Name
+	}
+	if req.EntityID != nil {
+		webhook.EntityID = *req.EntityID
+	}
+	if req.Service != nil {
+		webhook.Service = *req.Service
+	}
+	if req.Data != nil {
+		webhook.Data = *req.Data
+	}
+	if req.Active != nil {
+		webhook.Active = *req.Active
+	}
+	if err := normalizeWebhook(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.EntityID != nil {
+		if status, denial := h.checkWebhookEntity(userID, webhook.EntityID); denial != nil {
+			c.JSON(status, denial)
+			return
+		}
+	}
+
+	if err := database.DB.Save(&webhook).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook deletes a webhook; requests to its URL are refused from then on
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.Webhook{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// RotateWebhookSecret replaces the signing secret of a webhook. Requests signed with the old secret are refused.
+func (h *Handler) RotateWebhookSecret(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var webhook models.Webhook
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	webhook.Secret = generateWebhookSecret()
+	if err := database.DB.Model(&webhook).Update("secret", webhook.Secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": webhook.Secret})
+}
+
+// GetWebhookAudit lists the most recent deliveries of a webhook, including refused ones (owner only)
+func (h *Handler) GetWebhookAudit(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	var webhook models.Webhook
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&webhook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	var logs []models.AuditLog
+	if err := database.DB.Where("webhook_id = ? AND user_id = ?", webhook.ID, userID).
+		Order("created_at DESC, id DESC").Limit(auditLogLimit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
+
+// ReceiveWebhook triggers the entity of a webhook. The request must be signed with the webhook's secret:
+// X-Hassh-Signature is "sha256=" and the hex HMAC-SHA256 of "<X-Hassh-Timestamp>.<body>" (public endpoint).
+func (h *Handler) ReceiveWebhook(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Request body must be at most %d bytes", maxWebhookBodySize)})
+		return
+	}
+
+	var webhook models.Webhook
+	if err := database.DB.Preload("User").First(&webhook, "id = ?", c.Param("id")).Error; err != nil || !webhook.Active {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	// Verify the signature and refuse stale or replayed requests
+	now := time.Now()
+	timestamp := c.GetHeader("X-Hassh-Timestamp")
+	if err := verifyWebhookSignature(webhook.Secret, timestamp, c.GetHeader("X-Hassh-Signature"), body, now); err != nil {
+		auditWebhook(c, &webhook, "denied", map[string]interface{}{"reason": err.Error()})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	// Key on the digest itself, not the header: its hex may be sent in any case
+	if !claimWebhookDelivery(webhook.ID+":"+hex.EncodeToString(signWebhook(webhook.Secret, timestamp, body)), now) {
+		auditWebhook(c, &webhook, "denied", map[string]interface{}{"reason": "replayed request"})
+		c.JSON(http.StatusConflict, gin.H{"error": "This request was already received"})
+		return
+	}
+
+	// Fill the data template from the payload
+	var payload interface{}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil && webhookUsesPayload(webhook.Data) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Request body must be JSON"})
+			return
+		}
+	}
+	data, err := renderWebhookData(webhook.Data, payload)
+	if err != nil {
+		auditWebhook(c, &webhook, "failed", map[string]interface{}{"service": webhook.Service, "error": err.Error()})
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	haClient := ha.NewClient(webhook.User.HAURL, webhook.User.HAToken)
+	err = callEntityService(haClient, webhook.EntityID, webhook.Service, data)
+
+	database.DB.Model(&webhook).Update("last_used_at", now)
+	result, details := "executed", map[string]interface{}{"service": webhook.Service}
+	eventType := events.WebhookTriggered
+	if err != nil {
+		result, eventType = "failed", events.WebhookFailed
+		details["error"] = err.Error()
+	}
+	auditWebhook(c, &webhook, result, details)
+	events.Publish(events.Event{
+		Type:   eventType,
+		UserID: webhook.UserID,
+		Data: map[string]interface{}{
+			"webhook_id": webhook.ID,
+			"name":       webhook.Name,
+			"entity_id":  webhook.EntityID,
+			"service":    webhook.Service,
+		},
+	})
+
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to trigger entity: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Entity triggered successfully"})
+}
+
+// verifyWebhookSignature checks the HMAC-SHA256 signature of a webhook request and that its timestamp
+// (Unix seconds) is within webhookTimestampWindow of now
+func verifyWebhookSignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	if timestamp == "" || signature == "" {
+		return errors.New("missing X-Hassh-Timestamp or X-Hassh-Signature header")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("X-Hassh-Timestamp must be a Unix timestamp in seconds")
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > webhookTimestampWindow || age < -webhookTimestampWindow {
+		return fmt.Errorf("timestamp is more than %d minutes off", int(webhookTimestampWindow.Minutes()))
+	}
+
+	received, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return errors.New("X-Hassh-Signature must be sha256=<hex digest>")
+	}
+	if !hmac.Equal(received, signWebhook(secret, timestamp, body)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// signWebhook returns the HMAC-SHA256 of "<timestamp>.<body>"
+func signWebhook(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// claimWebhookDelivery records a delivery and reports whether it was new. Entries are kept for twice
+// the timestamp window, which covers every timestamp that can still be accepted.
+func claimWebhookDelivery(key string, now time.Time) bool {
+	webhookDeliveries.Lock()
+	defer webhookDeliveries.Unlock()
+
+	for seen, expiresAt := range webhookDeliveries.seen {
+		if now.After(expiresAt) {
+			delete(webhookDeliveries.seen, seen)
+		}
+	}
+	if _, seen := webhookDeliveries.seen[key]; seen {
+		return false
+	}
+	webhookDeliveries.seen[key] = now.Add(2 * webhookTimestampWindow)
+	return true
+}
+
+// renderWebhookData fills the placeholders of a data template from the payload. A string that is a single
+// placeholder takes the payload value with its JSON type; placeholders within text are replaced with its text.
+func renderWebhookData(template models.WebhookTemplate, payload interface{}) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(template)+1)
+	for key, value := range template {
+		rendered, err := renderWebhookValue(value, payload)
+		if err != nil {
+			return nil, err
+		}
+		data[key] = rendered
+	}
+	return data, nil
+}
+
+// renderWebhookValue fills the placeholders of a single template value, recursing into objects and lists
+func renderWebhookValue(value interface{}, payload interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if match := webhookPlaceholder.FindStringSubmatch(v); match != nil && match[0] == strings.TrimSpace(v) {
+			return lookupWebhookPayload(payload, match[1])
+		}
+		var lookupErr error
+		rendered := webhookPlaceholder.ReplaceAllStringFunc(v, func(placeholder string) string {
+			found, err := lookupWebhookPayload(payload, webhookPlaceholder.FindStringSubmatch(placeholder)[1])
+			if err != nil {
+				lookupErr = err
+				return ""
+			}
+			if text, ok := found.(string); ok {
+				return text
+			}
+			encoded, _ := json.Marshal(found)
+			return string(encoded)
+		})
+		return rendered, lookupErr
+	case map[string]interface{}:
+		return renderWebhookData(v, payload)
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			rendered, err := renderWebhookValue(item, payload)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, rendered)
+		}
+		return items, nil
+	}
+	return value, nil
+}
+
+// lookupWebhookPayload returns the payload value at a dotted path; numeric parts index lists (e.g. "items.0.name")
+func lookupWebhookPayload(payload interface{}, path string) (interface{}, error) {
+	current := payload
+	for _, part := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]interface{}:
+			value, ok := v[part]
+			if !ok {
+				return nil, fmt.Errorf("payload has no value at %q", path)
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("payload has no value at %q", path)
+			}
+			current = v[index]
+		default:
+			return nil, fmt.Errorf("payload has no value at %q", path)
+		}
+	}
+	return current, nil
+}
+
+// webhookUsesPayload reports whether a data template has placeholders
+func webhookUsesPayload(template models.WebhookTemplate) bool {
+	encoded, _ := json.Marshal(template)
+	return webhookPlaceholder.Match(encoded)
+}
+
+// normalizeWebhook validates the target and data template of a webhook
+func normalizeWebhook(webhook *models.Webhook) error {
+	webhook.Name = strings.TrimSpace(webhook.Name)
+	if len(webhook.Name) > maxWebhookNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxWebhookNameLength)
+	}
+	webhook.EntityID = strings.ToLower(strings.TrimSpace(webhook.EntityID))
+	if !entityIDPattern.MatchString(webhook.EntityID) {
+		return fmt.Errorf("invalid entity_id %q", webhook.EntityID)
+	}
+	webhook.Service = strings.ToLower(strings.TrimSpace(webhook.Service))
+	if !domainPattern.MatchString(webhook.Service) {
+		return fmt.Errorf("invalid service %q", webhook.Service)
+	}
+	if webhook.Data != nil {
+		data, err := json.Marshal(webhook.Data)
+		if err != nil || len(data) > maxWebhookDataSize {
+			return fmt.Errorf("data must be at most %d bytes of JSON", maxWebhookDataSize)
+		}
+	}
+	return nil
+}
+
+// checkWebhookEntity applies SHARE_ENTITY_POLICY to the entity of a webhook
+func (h *Handler) checkWebhookEntity(userID uint, entityID string) (int, gin.H) {
+	disallowed, err := h.disallowedShareEntities(userID, []string{entityID})
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"error": "Failed to validate entities"}
+	}
+	if len(disallowed) > 0 {
+		return http.StatusForbidden, gin.H{"error": h.shareEntityPolicyError(), "entity_ids": disallowed}
+	}
+	return http.StatusOK, nil
+}
+
+// auditWebhook records a delivery of a webhook in its owner's audit log
+func auditWebhook(c *gin.Context, webhook *models.Webhook, result string, details map[string]interface{}) {
+	recordAudit(models.AuditLog{
+		UserID:    webhook.UserID,
+		WebhookID: webhook.ID,
+		EntityID:  webhook.EntityID,
+		Action:    "webhook.trigger",
+		Result:    result,
+		ClientIP:  clientIP(c).String(),
+	}, details)
+}
+
+// webhookURL returns the URL external systems post to
+func (h *Handler) webhookURL(c *gin.Context, webhookID string) string {
+	return h.publicBaseURL(c) + "/api/hooks/" + webhookID
+}
+
+// generateWebhookSecret returns a random signing secret
+func generateWebhookSecret() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIPKey is the context key holding the resolved client IP
+const ClientIPKey = "clientIP"
+
+// Forwarding headers a trusted proxy may set (see ClientIPMiddleware)
+const (
+	HeaderXForwardedFor = "x-forwarded-for"
+	HeaderForwarded     = "forwarded"
+)
+
+// ClientIPMiddleware resolves the real client IP and stores it in the context.
+// The forwarding header the proxies set (X-Forwarded-For by default, or Forwarded) is only
+// honored when the request comes from one of the trusted proxies. The other header is ignored,
+// since proxies pass it on as the client sent it; gin's own header handling is not used.
+func ClientIPMiddleware(trustedProxies []string, header string) (gin.HandlerFunc, error) {
+	trusted, err := ParseNetworks(trustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+	}
+
+	parse := xForwardedFor
+	switch strings.ToLower(header) {
+	case "", HeaderXForwardedFor:
+		header = "X-Forwarded-For"
+	case HeaderForwarded:
+		header, parse = "Forwarded", forwardedFor
+	default:
+		return nil, fmt.Errorf("invalid trusted proxy header %q: must be %q or %q", header, HeaderXForwardedFor, HeaderForwarded)
+	}
+
+	return func(c *gin.Context) {
+		c.Set(ClientIPKey, resolveClientIP(c, trusted, parse(c.GetHeader(header))).String())
+		c.Next()
+	}, nil
+}
+
+// ParseNetworks parses a list of IPs and CIDRs into networks (single IPs become /32 or /128)
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if strings.Contains(value, "/") {
+			_, network, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a valid CIDR", value)
+			}
+			networks = append(networks, network)
+			continue
+		}
+
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not a valid IP address", value)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+	return networks, nil
+}
+
+// ContainsIP reports whether ip is in any of the networks
+func ContainsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveClientIP walks the forwarding chain from the closest hop outwards and returns
+// the first address that is not a trusted proxy
+func resolveClientIP(c *gin.Context, trusted []*net.IPNet, chain []net.IP) net.IP {
+	remoteIP := net.ParseIP(c.RemoteIP())
+	if remoteIP == nil {
+		remoteIP = net.IPv4zero
+	}
+	if !ContainsIP(trusted, remoteIP) {
+		return remoteIP
+	}
+
+	client := remoteIP
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := chain[i]
+		if ip == nil {
+			// Unparseable hop (e.g. obfuscated identifier); stop at the last known address
+			break
+		}
+		client = ip
+		if !ContainsIP(trusted, ip) {
+			break
+		}
+	}
+	return client
+}
+
+// xForwardedFor parses an X-Forwarded-For header into a list of hops
+func xForwardedFor(header string) []net.IP {
+	if header == "" {
+		return nil
+	}
+
+	var chain []net.IP
+	for _, part := range strings.Split(header, ",") {
+		chain = append(chain, parseHop(part))
+	}
+	return chain
+}
+
+// forwardedFor parses the for= parameters of an RFC 7239 Forwarded header into a list of hops
+func forwardedFor(header string) []net.IP {
+	if header == "" {
+		return nil
+	}
+
+	var chain []net.IP
+	for _, element := range strings.Split(header, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || !strings.EqualFold(key, "for") {
+				continue
+			}
+			chain = append(chain, parseHop(value))
+		}
+	}
+	return chain
+}
+
+// parseHop parses a single forwarding hop, accepting quoted values, ports and bracketed IPv6
+func parseHop(value string) net.IP {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+
+	if strings.HasPrefix(value, "[") {
+		// [2001:db8::1]:4711
+		if end := strings.Index(value, "]"); end > 0 {
+			value = value[1:end]
+		}
+	} else if host, _, err := net.SplitHostPort(value); err == nil {
+		// 192.0.2.60:4711
+		value = host
+	}
+
+	return net.ParseIP(value)
+}
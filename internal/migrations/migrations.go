@@ -1,10 +1,12 @@
 package migrations
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 
 	"github.com/ThraaxSession/Hash/internal/models"
+	"github.com/ThraaxSession/Hash/internal/policy"
 	"gorm.io/gorm"
 )
 
@@ -32,6 +34,39 @@ var migrations = []Migration{
 		Up:          migrateV1Up,
 		Down:        migrateV1Down,
 	},
+	{
+		Version:     2,
+		Description: "Convert share link entity_ids to per-entity entries",
+		Up:          migrateV2Up,
+		Down:        migrateV2Down,
+	},
+	{
+		Version:     3,
+		Description: "Audit share link entities against the share entity policy",
+		Up:          migrateV3Up,
+		Down:        migrateV3Down,
+	},
+	{
+		Version:     4,
+		Description: "Record group members as having accepted existing group shares",
+		Up:          migrateV4Up,
+		Down:        migrateV4Down,
+	},
+}
+
+// Share entity policy the V3 audit checks existing share links against (see SetShareEntityPolicy)
+var (
+	shareEntityPolicy    = "tracked"
+	shareEntityAllowlist []string
+)
+
+// SetShareEntityPolicy sets the share entity policy ("tracked", "allowlist" or "off") and allowlist
+// used by migrations. It must be called before Run.
+func SetShareEntityPolicy(policy string, allowlist []string) {
+	if policy != "" {
+		shareEntityPolicy = policy
+	}
+	shareEntityAllowlist = allowlist
 }
 
 // migrateV1Up adds OTP-related fields to the users table
@@ -79,6 +114,201 @@ func migrateV1Down(db *gorm.DB) error {
 	return nil
 }
 
+// migrateV2Up converts the legacy entity_ids JSON array of share links into
+// structured entries that inherit the link's access mode
+func migrateV2Up(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.ShareLink{}, "entity_ids") {
+		log.Println("Migration V2: entity_ids column does not exist, skipping")
+		return nil
+	}
+
+	if !db.Migrator().HasColumn(&models.ShareLink{}, "entries") {
+		if err := db.Exec("ALTER TABLE share_links ADD COLUMN entries TEXT").Error; err != nil {
+			return fmt.Errorf("failed to add entries column: %w", err)
+		}
+		log.Println("Migration V2: Added entries column")
+	}
+
+	type legacyShareLink struct {
+		ID         string
+		EntityIDs  models.JSON
+		AccessMode string
+	}
+
+	var links []legacyShareLink
+	if err := db.Table("share_links").
+		Select("id, entity_ids, access_mode").
+		Where("entries IS NULL OR entries = ''").
+		Scan(&links).Error; err != nil {
+		return fmt.Errorf("failed to load share links: %w", err)
+	}
+
+	converted := 0
+	for _, link := range links {
+		var entityIDs []string
+		if len(link.EntityIDs) > 0 {
+			if err := json.Unmarshal(link.EntityIDs, &entityIDs); err != nil {
+				return fmt.Errorf("failed to parse entity_ids of share link %s: %w", link.ID, err)
+			}
+		}
+
+		accessMode := link.AccessMode
+		if accessMode == "" {
+			accessMode = "readonly"
+		}
+
+		entries := make(models.ShareEntries, 0, len(entityIDs))
+		for _, entityID := range entityIDs {
+			entries = append(entries, models.ShareEntry{
+				EntityID:   entityID,
+				AccessMode: accessMode,
+			})
+		}
+
+		if err := db.Model(&models.ShareLink{}).Where("id = ?", link.ID).UpdateColumn("entries", entries).Error; err != nil {
+			return fmt.Errorf("failed to convert share link %s: %w", link.ID, err)
+		}
+		converted++
+	}
+
+	log.Printf("Migration V2: Converted %d share links to entries", converted)
+	return nil
+}
+
+// migrateV2Down leaves the converted entries in place
+func migrateV2Down(db *gorm.DB) error {
+	// The legacy entity_ids column is never modified by V2, so older versions keep working with it
+	log.Println("Migration V2 Down: entity_ids column was left untouched, nothing to roll back.")
+	log.Println("Per-entity access modes and allowed services stored in entries will be ignored by older versions.")
+	return nil
+}
+
+// migrateV3Up reports share links exposing entities their owner neither tracks nor may share
+// through the allowlist, and deactivates them unless the share entity policy is "off".
+// Every violating link gets a "share_link.entity_policy" audit log entry.
+func migrateV3Up(db *gorm.DB) error {
+	type auditedShareLink struct {
+		ID      string
+		UserID  uint
+		Active  bool
+		Entries models.ShareEntries
+	}
+
+	var links []auditedShareLink
+	if err := db.Model(&models.ShareLink{}).Select("id, user_id, active, entries").Scan(&links).Error; err != nil {
+		return fmt.Errorf("failed to load share links: %w", err)
+	}
+
+	violating, deactivated := 0, 0
+	for _, link := range links {
+		tracked := make(map[string]bool)
+		if shareEntityPolicy != "allowlist" {
+			var owned []string
+			if err := db.Model(&models.Entity{}).Where("user_id = ?", link.UserID).Pluck("entity_id", &owned).Error; err != nil {
+				return fmt.Errorf("failed to load entities of user %d: %w", link.UserID, err)
+			}
+			for _, entityID := range owned {
+				tracked[entityID] = true
+			}
+		}
+
+		var disallowed []string
+		for _, entityID := range link.Entries.EntityIDs() {
+			if !tracked[entityID] && !policy.MatchesEntityPattern(shareEntityAllowlist, entityID) {
+				disallowed = append(disallowed, entityID)
+			}
+		}
+		if len(disallowed) == 0 {
+			continue
+		}
+		violating++
+
+		result := "violation"
+		if link.Active && shareEntityPolicy != "off" {
+			if err := db.Model(&models.ShareLink{}).Where("id = ?", link.ID).UpdateColumn("active", false).Error; err != nil {
+				return fmt.Errorf("failed to deactivate share link %s: %w", link.ID, err)
+			}
+			result = "deactivated"
+			deactivated++
+		}
+
+		details, err := json.Marshal(map[string]interface{}{
+			"entity_ids": disallowed,
+			"policy":     shareEntityPolicy,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details of share link %s: %w", link.ID, err)
+		}
+		if err := db.Create(&models.AuditLog{
+			UserID:      link.UserID,
+			ShareLinkID: link.ID,
+			Action:      "share_link.entity_policy",
+			Result:      result,
+			Details:     details,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to record audit log of share link %s: %w", link.ID, err)
+		}
+
+		log.Printf("Migration V3: Share link %s of user %d exposes disallowed entities %v (%s)", link.ID, link.UserID, disallowed, result)
+	}
+
+	log.Printf("Migration V3: Audited %d share links, %d violate the share entity policy, %d deactivated", len(links), violating, deactivated)
+	return nil
+}
+
+// migrateV3Down reactivates the share links deactivated by V3
+func migrateV3Down(db *gorm.DB) error {
+	var linkIDs []string
+	if err := db.Model(&models.AuditLog{}).
+		Where("action = ? AND result = ?", "share_link.entity_policy", "deactivated").
+		Pluck("share_link_id", &linkIDs).Error; err != nil {
+		return fmt.Errorf("failed to load deactivated share links: %w", err)
+	}
+
+	if len(linkIDs) > 0 {
+		if err := db.Model(&models.ShareLink{}).Where("id IN ?", linkIDs).UpdateColumn("active", true).Error; err != nil {
+			return fmt.Errorf("failed to reactivate share links: %w", err)
+		}
+	}
+
+	log.Printf("Migration V3 Down: Reactivated %d share links. Their audit log entries are kept.", len(linkIDs))
+	return nil
+}
+
+// migrateV4Up keeps the access group members had to the entities shared with their groups before
+// group shares needed each member to accept them
+func migrateV4Up(db *gorm.DB) error {
+	var shares []models.SharedEntity
+	if err := db.Where("group_id != ?", 0).Find(&shares).Error; err != nil {
+		return fmt.Errorf("failed to load group shares: %w", err)
+	}
+
+	accepted := 0
+	for _, share := range shares {
+		var memberIDs []uint
+		if err := db.Model(&models.GroupMember{}).Where("group_id = ? AND user_id != ?", share.GroupID, share.OwnerID).
+			Pluck("user_id", &memberIDs).Error; err != nil {
+			return fmt.Errorf("failed to load members of group %d: %w", share.GroupID, err)
+		}
+		for _, memberID := range memberIDs {
+			response := models.SharedEntityMember{SharedEntityID: share.ID, UserID: memberID, Status: "accepted", RespondedAt: &share.CreatedAt}
+			if err := db.Where("shared_entity_id = ? AND user_id = ?", share.ID, memberID).FirstOrCreate(&response).Error; err != nil {
+				return fmt.Errorf("failed to record member %d of share %d: %w", memberID, share.ID, err)
+			}
+			accepted++
+		}
+	}
+
+	log.Printf("Migration V4: Recorded %d members of %d group shares as accepted", accepted, len(shares))
+	return nil
+}
+
+// migrateV4Down keeps the member responses; older versions ignore them and share with every member
+func migrateV4Down(db *gorm.DB) error {
+	log.Println("Migration V4 Down: Group shares will be shared with every group member again by older versions.")
+	return nil
+}
+
 // Run executes all pending migrations
 func Run(db *gorm.DB) error {
 	// Create migration history table if it doesn't exist
@@ -3,6 +3,8 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"path"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -20,21 +22,70 @@ type User struct {
 	OTPSecret             string    `json:"-"`                                       // OTP secret (not exposed in JSON)
 	OTPEnabled            bool      `gorm:"default:false" json:"otp_enabled"`        // Whether OTP is enabled
 	OTPBackupCodes        string    `json:"-"`                                       // JSON array of hashed backup codes
+	NotifyService         string    `json:"-"`                                       // HA notify service for owner notifications (e.g. "notify.mobile_app_phone")
+	MQTTKey               string    `json:"-"`                                       // Secret signing the user's MQTT commands and their results (empty = none)
 	CreatedAt             time.Time `json:"created_at"`
 	UpdatedAt             time.Time `json:"updated_at"`
 }
 
 // SharedEntity represents an entity shared with another user
 type SharedEntity struct {
-	ID         uint      `gorm:"primarykey" json:"id"`
-	EntityID   string    `gorm:"not null" json:"EntityID"`
-	OwnerID    uint      `gorm:"not null" json:"OwnerID"`
-	Owner      User      `gorm:"foreignKey:OwnerID" json:"Owner"`
-	SharedWith uint      `gorm:"not null" json:"SharedWith"`
-	SharedUser User      `gorm:"foreignKey:SharedWith" json:"SharedUser"`
-	AccessMode string    `gorm:"default:readonly" json:"AccessMode"` // "readonly", "triggerable"
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID               uint                 `gorm:"primarykey" json:"id"`
+	EntityID         string               `gorm:"not null" json:"EntityID"`
+	OwnerID          uint                 `gorm:"not null" json:"OwnerID"`
+	Owner            User                 `gorm:"foreignKey:OwnerID" json:"Owner"`
+	SharedWith       uint                 `gorm:"not null" json:"SharedWith"` // 0 for shares with a group
+	SharedUser       User                 `gorm:"foreignKey:SharedWith" json:"SharedUser"`
+	GroupID          uint                 `gorm:"index;default:0" json:"GroupID"` // Shares with every member of the group instead of SharedWith
+	Group            *Group               `gorm:"foreignKey:GroupID" json:"Group,omitempty"`
+	Members          []SharedEntityMember `gorm:"foreignKey:SharedEntityID" json:"Members,omitempty"` // Group shares: how each member responded
+	AccessMode       string               `gorm:"default:readonly" json:"AccessMode"`                 // "readonly", "triggerable"
+	AttributeFilter  AttributeFilter      `json:"AttributeFilter"`
+	RequiresApproval bool                 `gorm:"default:false" json:"RequiresApproval"` // Triggers create action requests the owner must approve
+	Selector         EntitySelector       `json:"Selector"`                              // Shares every matching entity instead of EntityID (EntityID is empty)
+	Conditions       ShareConditions      `json:"Conditions"`                            // Home Assistant states the share is only active in
+	ExpiresAt        *time.Time           `gorm:"index" json:"ExpiresAt"`                // Access ends at this time (nil = until unshared)
+	Schedule         ShareSchedule        `json:"Schedule"`                              // Weekly time windows the share works in
+	Status           string               `gorm:"index;default:accepted" json:"Status"`  // "pending", "accepted", "declined", "left"; only accepted shares grant access (group shares: see Members)
+	Message          string               `json:"Message"`                               // Optional note from the owner shown with the invitation
+	RespondedAt      *time.Time           `json:"RespondedAt"`                           // When the user accepted, declined or left the share
+	Available        bool                 `gorm:"-" json:"Available"`                    // Listings: whether the schedule is open now
+	RemainingSeconds *int64               `gorm:"-" json:"RemainingSeconds"`             // Listings: seconds until access ends or the open window closes (nil = unlimited)
+	CreatedAt        time.Time            `json:"created_at"`
+	UpdatedAt        time.Time            `json:"updated_at"`
+}
+
+// Group is a named set of users that entities can be shared with
+type Group struct {
+	ID           uint          `gorm:"primarykey" json:"id"`
+	Name         string        `gorm:"not null" json:"name"`
+	OwnerID      uint          `gorm:"index;not null" json:"owner_id"`
+	Owner        User          `gorm:"foreignKey:OwnerID" json:"-"`
+	AdminManaged bool          `gorm:"default:false" json:"admin_managed"` // Managed by every admin and available to every user as a sharing target
+	Members      []GroupMember `json:"members,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// GroupMember is a user's membership in a group
+type GroupMember struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	GroupID   uint      `gorm:"uniqueIndex:idx_group_member;not null" json:"group_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_group_member;index;not null" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedEntityMember is a group member's response to a share with the group. Group shares only
+// grant access to members who accepted them
+type SharedEntityMember struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	SharedEntityID uint       `gorm:"uniqueIndex:idx_shared_entity_member;not null" json:"shared_entity_id"`
+	UserID         uint       `gorm:"uniqueIndex:idx_shared_entity_member;index;not null" json:"user_id"`
+	User           User       `gorm:"foreignKey:UserID" json:"user"`
+	Status         string     `gorm:"index;default:pending" json:"status"` // "pending", "accepted", "declined", "left"
+	RespondedAt    *time.Time `json:"responded_at"`
+	CreatedAt      time.Time  `json:"created_at"`
 }
 
 // Entity represents a Home Assistant entity
@@ -63,29 +114,633 @@ func (e *Entity) BeforeCreate(tx *gorm.DB) error {
 
 // ShareLink represents a shareable link
 type ShareLink struct {
-	ID          string    `gorm:"primarykey" json:"id"`
-	EntityIDs   JSON      `json:"entity_ids"` // JSON array of entity IDs
-	Type        string    `json:"type"`       // "permanent", "counter", "time"
-	AccessMode  string    `json:"access_mode"` // "readonly", "triggerable"
-	MaxAccess   int       `json:"max_access,omitempty"`
-	AccessCount int       `json:"access_count"`
-	ExpiresAt   time.Time `json:"expires_at,omitempty"`
-	Active      bool      `json:"active"`
-	UserID      uint      `gorm:"not null" json:"user_id"`
-	User        User      `gorm:"foreignKey:UserID" json:"-"`
+	ID              string          `gorm:"primarykey" json:"id"`
+	Entries         ShareEntries    `json:"entries"`     // Shared entities with per-entity access rules
+	Selectors       ShareSelectors  `json:"selectors"`   // Dynamically shared entities, resolved at access time
+	Type            string          `json:"type"`        // "permanent", "counter", "time", "kiosk"
+	AccessMode      string          `json:"access_mode"` // Default access mode for entries: "readonly", "triggerable"
+	MaxAccess       int             `json:"max_access,omitempty"`
+	AccessCount     int             `json:"access_count"`
+	ExpiresAt       time.Time       `json:"expires_at,omitempty"`
+	Active          bool            `json:"active"`
+	Title           string          `json:"title,omitempty"`        // Heading shown on the share page
+	Instructions    string          `json:"instructions,omitempty"` // Markdown welcome/instructions block for guests
+	AttributeFilter AttributeFilter `json:"attribute_filter"`
+	IPRestriction   IPRestriction   `json:"ip_restriction"`
+	Geofence        Geofence        `json:"geofence"`
+	Embed           EmbedSettings   `json:"embed"`
+	Conditions      ShareConditions `json:"conditions"`                            // Home Assistant states the link is only active in
+	RequireApproval bool            `gorm:"default:false" json:"require_approval"` // Visitors must request access and be approved by the owner
+	MaxDevices      int             `gorm:"default:0" json:"max_devices"`          // Bind the link to the first N devices that open it (0 = any device)
+	KioskBindable   bool            `gorm:"default:false" json:"kiosk_bindable"`   // Kiosk link waits for the first device to bind to it
+	Schedule        ShareSchedule   `json:"schedule"`                              // Weekly time windows the link works in (none = always)
+	Action          ShareAction     `json:"action"`                                // Turns the link into an action link performing a single service call
+	UserID          uint            `gorm:"not null" json:"user_id"`
+	User            User            `gorm:"foreignKey:UserID" json:"-"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// ShareEntry represents a single entity within a share link and its access rules
+type ShareEntry struct {
+	EntityID          string            `json:"entity_id"`
+	AccessMode        string            `json:"access_mode"`                   // "readonly", "triggerable"
+	AllowedServices   []string          `json:"allowed_services,omitempty"`    // Services guests may call (empty allows any)
+	RequiresApproval  bool              `json:"requires_approval,omitempty"`   // Triggers create action requests the owner must approve
+	AutoRevertMinutes int               `json:"auto_revert_minutes,omitempty"` // Call the inverse service this many minutes after a trigger (0 = never)
+	Chain             *ActionChain      `json:"chain,omitempty"`               // Side effects executed after a successful trigger
+	Display           ShareEntryDisplay `json:"display"`
+}
+
+// ActionChain is a list of steps executed server-side, with the owner's credentials, after a trigger of a share entry succeeded
+type ActionChain struct {
+	Services []string     `json:"services,omitempty"` // Trigger services that start the chain (empty = any)
+	Steps    []ActionStep `json:"steps"`
+}
+
+// ActionStep is a single step of an action chain
+type ActionStep struct {
+	Type            string                 `json:"type"`                        // "service", "event" or "delay"
+	Service         string                 `json:"service,omitempty"`           // "domain.service" of service steps (e.g. "light.turn_on")
+	EntityID        string                 `json:"entity_id,omitempty"`         // Target of service steps (optional, e.g. for notify services)
+	Event           string                 `json:"event,omitempty"`             // Event type fired by event steps
+	Data            map[string]interface{} `json:"data,omitempty"`              // Service or event data
+	DelaySeconds    int                    `json:"delay_seconds,omitempty"`     // Pause of delay steps
+	ContinueOnError bool                   `json:"continue_on_error,omitempty"` // Keep going when the step fails (default: stop the chain)
+}
+
+// ShareSelector shares every entity matching a selector with the same access rules
+type ShareSelector struct {
+	EntitySelector
+	AccessMode        string            `json:"access_mode"` // "readonly", "triggerable"
+	AllowedServices   []string          `json:"allowed_services,omitempty"`
+	RequiresApproval  bool              `json:"requires_approval,omitempty"`
+	AutoRevertMinutes int               `json:"auto_revert_minutes,omitempty"`
+	Display           ShareEntryDisplay `json:"display"` // Icon, section and order applied to every match
+}
+
+// ShareSelectors is a list of share selectors stored as JSON
+type ShareSelectors []ShareSelector
+
+// Scan implements the sql.Scanner interface
+func (s *ShareSelectors) Scan(value interface{}) error {
+	*s = nil
+	return scanJSON(value, s)
+}
+
+// Value implements the driver.Valuer interface
+func (s ShareSelectors) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// GormDataType stores share selectors as text
+func (ShareSelectors) GormDataType() string {
+	return "text"
+}
+
+// ShareCondition requires an entity of the owner's Home Assistant to be in a given state for a share to be active.
+// It mirrors Home Assistant's state and numeric_state conditions.
+type ShareCondition struct {
+	EntityID  string   `json:"entity_id"`
+	Attribute string   `json:"attribute,omitempty"` // Test this attribute instead of the state
+	State     []string `json:"state,omitempty"`     // Active while the state is one of these
+	NotState  []string `json:"not_state,omitempty"` // Active while the state is none of these
+	Above     *float64 `json:"above,omitempty"`     // Active while the numeric state is above this
+	Below     *float64 `json:"below,omitempty"`     // Active while the numeric state is below this
+	Message   string   `json:"message,omitempty"`   // Shown to guests instead of the generated reason
+}
+
+// ShareConditions is a list of share conditions stored as JSON. All conditions must hold.
+type ShareConditions []ShareCondition
+
+// Scan implements the sql.Scanner interface
+func (s *ShareConditions) Scan(value interface{}) error {
+	*s = nil
+	return scanJSON(value, s)
+}
+
+// Value implements the driver.Valuer interface
+func (s ShareConditions) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// GormDataType stores share conditions as text
+func (ShareConditions) GormDataType() string {
+	return "text"
+}
+
+// EntitySelector matches entities by a glob pattern on the entity ID and/or their domain
+type EntitySelector struct {
+	Pattern string   `json:"pattern,omitempty"` // e.g. "light.garden_*"
+	Domains []string `json:"domains,omitempty"` // e.g. ["light", "switch"]
+}
+
+// IsEmpty reports whether the selector has neither a pattern nor domains
+func (s EntitySelector) IsEmpty() bool {
+	return s.Pattern == "" && len(s.Domains) == 0
+}
+
+// Matches reports whether an entity ID matches the pattern and one of the domains (when set)
+func (s EntitySelector) Matches(entityID string) bool {
+	if s.IsEmpty() {
+		return false
+	}
+	if s.Pattern != "" {
+		if matched, err := path.Match(s.Pattern, entityID); err != nil || !matched {
+			return false
+		}
+	}
+	if len(s.Domains) > 0 {
+		domain, _, _ := strings.Cut(entityID, ".")
+		for _, allowed := range s.Domains {
+			if allowed == domain {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Scan implements the sql.Scanner interface
+func (s *EntitySelector) Scan(value interface{}) error {
+	*s = EntitySelector{}
+	return scanJSON(value, s)
+}
+
+// Value implements the driver.Valuer interface
+func (s EntitySelector) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// GormDataType stores entity selectors as text
+func (EntitySelector) GormDataType() string {
+	return "text"
+}
+
+// ShareEntryDisplay holds presentation options for a shared entity
+type ShareEntryDisplay struct {
+	Label          string `json:"label,omitempty"`           // Shown instead of the entity ID
+	Icon           string `json:"icon,omitempty"`            // Emoji shown next to the label
+	Order          int    `json:"order,omitempty"`           // Position on the share page (ascending)
+	Section        string `json:"section,omitempty"`         // Section heading the entity is grouped under
+	HideAttributes bool   `json:"hide_attributes,omitempty"` // Hide the attribute list on the share page
+}
+
+// ShareEntries is a list of share entries stored as JSON
+type ShareEntries []ShareEntry
+
+// EntityIDs returns the entity IDs of all entries
+func (e ShareEntries) EntityIDs() []string {
+	ids := make([]string, len(e))
+	for i, entry := range e {
+		ids[i] = entry.EntityID
+	}
+	return ids
+}
+
+// Find returns the entry for an entity ID
+func (e ShareEntries) Find(entityID string) (*ShareEntry, bool) {
+	for i := range e {
+		if e[i].EntityID == entityID {
+			return &e[i], true
+		}
+	}
+	return nil, false
+}
+
+// AllowsService reports whether a guest may call the given service on this entry
+func (e *ShareEntry) AllowsService(service string) bool {
+	if len(e.AllowedServices) == 0 {
+		return true
+	}
+	for _, allowed := range e.AllowedServices {
+		if allowed == service {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan implements the sql.Scanner interface
+func (e *ShareEntries) Scan(value interface{}) error {
+	*e = nil
+	return scanJSON(value, e)
+}
+
+// Value implements the driver.Valuer interface
+func (e ShareEntries) Value() (driver.Value, error) {
+	if e == nil {
+		return nil, nil
+	}
+	return json.Marshal(e)
+}
+
+// GormDataType stores share entries as text
+func (ShareEntries) GormDataType() string {
+	return "text"
+}
+
+// AttributeFilter controls which entity attributes are exposed through a share
+type AttributeFilter struct {
+	Allow               []string `json:"allow,omitempty"`                 // Only these attributes are exposed (empty exposes all); listed attributes bypass default redactions
+	Deny                []string `json:"deny,omitempty"`                  // These attributes are always removed
+	LocationPrecisionKm float64  `json:"location_precision_km,omitempty"` // Round coordinates to this grid instead of removing them (0 removes them)
+}
+
+// Scan implements the sql.Scanner interface
+func (f *AttributeFilter) Scan(value interface{}) error {
+	*f = AttributeFilter{}
+	return scanJSON(value, f)
+}
+
+// Value implements the driver.Valuer interface
+func (f AttributeFilter) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+// GormDataType stores attribute filters as text
+func (AttributeFilter) GormDataType() string {
+	return "text"
+}
+
+// IPRestriction limits from which client networks a share can be used
+type IPRestriction struct {
+	Allow []string `json:"allow,omitempty"` // IPs/CIDRs allowed to use the share (empty allows all)
+	Deny  []string `json:"deny,omitempty"`  // IPs/CIDRs never allowed (takes precedence over Allow)
+}
+
+// Scan implements the sql.Scanner interface
+func (r *IPRestriction) Scan(value interface{}) error {
+	*r = IPRestriction{}
+	return scanJSON(value, r)
+}
+
+// Value implements the driver.Valuer interface
+func (r IPRestriction) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// GormDataType stores IP restrictions as text
+func (IPRestriction) GormDataType() string {
+	return "text"
+}
+
+// Geofence restricts triggering a share link's entities to guests near a location
+type Geofence struct {
+	Enabled     bool    `json:"enabled"`
+	Zone        string  `json:"zone,omitempty"`         // HA zone entity used as the center (e.g. "zone.home")
+	Latitude    float64 `json:"latitude,omitempty"`     // Explicit center, used when no zone is set
+	Longitude   float64 `json:"longitude,omitempty"`    // Explicit center, used when no zone is set
+	Radius      float64 `json:"radius,omitempty"`       // In meters (0 uses the zone's radius)
+	MaxAccuracy float64 `json:"max_accuracy,omitempty"` // Maximum accepted accuracy of the reported position in meters
+}
+
+// Scan implements the sql.Scanner interface
+func (g *Geofence) Scan(value interface{}) error {
+	*g = Geofence{}
+	return scanJSON(value, g)
+}
+
+// Value implements the driver.Valuer interface
+func (g Geofence) Value() (driver.Value, error) {
+	return json.Marshal(g)
+}
+
+// GormDataType stores geofences as text
+func (Geofence) GormDataType() string {
+	return "text"
+}
+
+// EmbedSettings controls embedding a share link in other sites (iframe widget, JSON feed, oEmbed)
+type EmbedSettings struct {
+	Enabled        bool     `json:"enabled"`
+	Theme          string   `json:"theme,omitempty"`           // "light", "dark" or "auto" (follows the visitor's system)
+	FrameAncestors []string `json:"frame_ancestors,omitempty"` // Origins allowed to frame the widget (e.g. "https://wiki.example.com")
+}
+
+// Scan implements the sql.Scanner interface
+func (e *EmbedSettings) Scan(value interface{}) error {
+	*e = EmbedSettings{}
+	return scanJSON(value, e)
+}
+
+// Value implements the driver.Valuer interface
+func (e EmbedSettings) Value() (driver.Value, error) {
+	return json.Marshal(e)
+}
+
+// GormDataType stores embed settings as text
+func (EmbedSettings) GormDataType() string {
+	return "text"
+}
+
+// ShareSchedule limits a share link to weekly time windows
+type ShareSchedule struct {
+	Windows  []ScheduleWindow `json:"windows,omitempty"`  // The link works while any window is open (none = always)
+	Timezone string           `json:"timezone,omitempty"` // IANA time zone of the windows (e.g. "Europe/Berlin"), default: the server's
+}
+
+// ScheduleWindow is a daily time window on some days of the week
+type ScheduleWindow struct {
+	Days  []string `json:"days,omitempty"` // "mon" ... "sun" (empty = every day)
+	Start string   `json:"start"`          // "HH:MM"
+	End   string   `json:"end"`            // "HH:MM", before start for windows past midnight
+}
+
+// Scan implements the sql.Scanner interface
+func (s *ShareSchedule) Scan(value interface{}) error {
+	*s = ShareSchedule{}
+	return scanJSON(value, s)
+}
+
+// Value implements the driver.Valuer interface
+func (s ShareSchedule) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// GormDataType stores schedules as text
+func (ShareSchedule) GormDataType() string {
+	return "text"
+}
+
+// ShareAction is the single service call of an action link (e.g. for NFC tags and home-screen shortcuts).
+// Action links never expose entity states.
+type ShareAction struct {
+	EntityID string                 `json:"entity_id,omitempty"` // Empty for regular share links
+	Service  string                 `json:"service,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Confirm  bool                   `json:"confirm,omitempty"` // Opening the link asks before running the action
+}
+
+// Scan implements the sql.Scanner interface
+func (a *ShareAction) Scan(value interface{}) error {
+	*a = ShareAction{}
+	return scanJSON(value, a)
+}
+
+// Value implements the driver.Valuer interface
+func (a ShareAction) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// GormDataType stores actions as text
+func (ShareAction) GormDataType() string {
+	return "text"
+}
+
+// scanJSON decodes a JSON database value into dest, leaving dest untouched for NULL or empty values
+func scanJSON(value interface{}, dest interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return gorm.ErrInvalidData
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// AuditLog records a security-relevant action performed through a share
+type AuditLog struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	UserID      uint      `gorm:"index;not null" json:"user_id"` // Owner of the share
+	ShareLinkID string    `gorm:"index" json:"share_link_id,omitempty"`
+	WebhookID   string    `gorm:"index" json:"webhook_id,omitempty"`
+	EntityID    string    `json:"entity_id,omitempty"`
+	Action      string    `json:"action"` // e.g. "share_link.trigger"
+	Result      string    `json:"result"` // "allowed", "denied"
+	ClientIP    string    `json:"client_ip,omitempty"`
+	Details     JSON      `json:"details,omitempty"` // Action specific data (e.g. the reported position)
 	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AccessRequest is a visitor's request to use a share link that requires approval
+type AccessRequest struct {
+	ID          string     `gorm:"primarykey" json:"id"` // Random ID, also the visitor's secret for polling the outcome
+	ShareLinkID string     `gorm:"index;not null" json:"share_link_id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"` // Owner of the share link
+	Name        string     `json:"name"`
+	Message     string     `json:"message,omitempty"`
+	Status      string     `gorm:"index" json:"status"` // "pending", "approved", "denied", "expired", "revoked"
+	ClientIP    string     `json:"client_ip,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"` // Pending requests expire at this time
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ActionRequest is a trigger of a sensitive entity that waits for the owner's approval
+type ActionRequest struct {
+	ID             string     `gorm:"primarykey" json:"id"`                 // Random ID, also the guest's secret for polling the outcome
+	UserID         uint       `gorm:"index;not null" json:"user_id"`        // Owner of the entity
+	ShareLinkID    string     `gorm:"index" json:"share_link_id,omitempty"` // Set for triggers via share links
+	SharedEntityID uint       `json:"shared_entity_id,omitempty"`           // Set for triggers via user shares
+	RequesterID    uint       `gorm:"index" json:"requester_id,omitempty"`  // Requesting user (0 for share link guests)
+	RequesterName  string     `json:"requester_name"`
+	EntityID       string     `json:"entity_id"`
+	Service        string     `json:"service"`
+	Data           JSON       `json:"data,omitempty"`      // Service data passed to Home Assistant on approval
+	Status         string     `gorm:"index" json:"status"` // "pending", "executed", "failed", "rejected", "expired"
+	Error          string     `json:"error,omitempty"`     // Home Assistant error when execution failed
+	ClientIP       string     `json:"client_ip,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"` // Pending requests expire at this time
+	DecidedAt      *time.Time `json:"decided_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ShareDevice is a device (browser) a device-bound or kiosk share link is bound to
+type ShareDevice struct {
+	ID          string     `gorm:"primarykey" json:"id"`
+	ShareLinkID string     `gorm:"index;not null" json:"share_link_id"`
+	UserID      uint       `gorm:"index;not null" json:"user_id"` // Owner of the share link
+	UserAgent   string     `json:"user_agent"`
+	ClientIP    string     `json:"client_ip"`    // Address of the last visit or heartbeat
+	LastSeenAt  time.Time  `json:"last_seen_at"` // Last visit or heartbeat
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"` // When the device was bound
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// RevertJob is a scheduled call of the inverse service (e.g. "turn_off") after a guest triggered a share entry
+// with an auto-revert rule. Jobs are persisted so they survive server restarts.
+type RevertJob struct {
+	ID             string     `gorm:"primarykey" json:"id"`
+	UserID         uint       `gorm:"index;not null" json:"user_id"` // Owner of the entity, whose credentials run the job
+	ShareLinkID    string     `gorm:"index" json:"share_link_id"`
+	EntityID       string     `gorm:"index" json:"entity_id"`
+	TriggerService string     `json:"trigger_service"` // Service the guest called (e.g. "turn_on")
+	Service        string     `json:"service"`         // Inverse service called when due (e.g. "turn_off")
+	DueAt          time.Time  `gorm:"index" json:"due_at"`
+	Status         string     `gorm:"index" json:"status"` // "pending", "running", "executed", "cancelled", "failed"
+	Reason         string     `json:"reason,omitempty"`    // Why the job was cancelled or failed
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Reservation checks out an entity shared with several users for a time slot. While it is active,
+// only its user can trigger the entity through a user share.
+type Reservation struct {
+	ID         string     `gorm:"primarykey" json:"id"`
+	OwnerID    uint       `gorm:"index;not null" json:"owner_id"` // Owner of the entity
+	EntityID   string     `gorm:"index;not null" json:"entity_id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"` // User holding the reservation
+	User       User       `gorm:"foreignKey:UserID" json:"user"`
+	StartsAt   time.Time  `gorm:"index" json:"starts_at"`
+	EndsAt     time.Time  `gorm:"index" json:"ends_at"`
+	Note       string     `json:"note,omitempty"`
+	Status     string     `gorm:"index" json:"status"` // "active", "completed", "released", "cancelled"
+	Reason     string     `json:"reason,omitempty"`    // Why the reservation was released or cancelled
+	UsedAt     *time.Time `json:"used_at,omitempty"`   // First trigger during the slot
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Webhook lets an external system (e.g. a CI job or a doorbell) trigger an entity of its owner with an
+// HMAC-signed request instead of a user session.
+type Webhook struct {
+	ID         string          `gorm:"primarykey" json:"id"` // Random ID, part of the webhook URL
+	UserID     uint            `gorm:"index;not null" json:"user_id"`
+	User       User            `gorm:"foreignKey:UserID" json:"-"`
+	Name       string          `json:"name"`
+	EntityID   string          `gorm:"not null" json:"entity_id"`
+	Service    string          `gorm:"not null" json:"service"`
+	Data       WebhookTemplate `json:"data"`              // Service data, with placeholders filled from the request payload
+	Secret     string          `gorm:"not null" json:"-"` // Key of the HMAC-SHA256 signatures, only shown on creation and rotation
+	Active     bool            `gorm:"default:true" json:"active"`
+	LastUsedAt *time.Time      `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// WebhookTemplate is the service data of a webhook. String values may contain "{{ path }}" placeholders
+// (e.g. "{{ event.visitor }}") that are replaced with values of the request's JSON payload.
+type WebhookTemplate map[string]interface{}
+
+// Scan implements the sql.Scanner interface
+func (t *WebhookTemplate) Scan(value interface{}) error {
+	*t = nil
+	return scanJSON(value, t)
+}
+
+// Value implements the driver.Valuer interface
+func (t WebhookTemplate) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+// GormDataType stores templates as text
+func (WebhookTemplate) GormDataType() string {
+	return "text"
+}
+
+// WebhookSubscription delivers Hassh events to an external URL as signed JSON requests
+type WebhookSubscription struct {
+	ID         string     `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+	Name       string     `json:"name"`
+	URL        string     `gorm:"not null" json:"url"`
+	EventTypes StringList `json:"event_types"`       // Event types or patterns (e.g. "share_link.*"); empty subscribes to all events
+	AllUsers   bool       `json:"all_users"`         // Admins only: receive the events of every user
+	Secret     string     `gorm:"not null" json:"-"` // Key of the HMAC-SHA256 signatures, only shown on creation and rotation
+	Active     bool       `gorm:"default:true" json:"active"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// WebhookDelivery is a queued delivery of an event to a webhook subscription. Failed attempts are
+// retried with exponential backoff; deliveries are persisted so they survive server restarts.
+type WebhookDelivery struct {
+	ID             string     `gorm:"primarykey" json:"id"`
+	SubscriptionID string     `gorm:"index;not null" json:"subscription_id"`
+	UserID         uint       `gorm:"index;not null" json:"user_id"` // Owner of the subscription
+	EventType      string     `json:"event_type"`
+	Payload        JSON       `json:"payload"`
+	Status         string     `gorm:"index" json:"status"` // "pending", "sending", "delivered", "failed"
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"index" json:"next_attempt_at"`
+	ResponseStatus int        `json:"response_status,omitempty"` // HTTP status of the last attempt
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// StringList is a list of strings stored as JSON
+type StringList []string
+
+// Scan implements the sql.Scanner interface
+func (l *StringList) Scan(value interface{}) error {
+	*l = nil
+	return scanJSON(value, l)
+}
+
+// Value implements the driver.Valuer interface
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return json.Marshal([]string{})
+	}
+	return json.Marshal([]string(l))
+}
+
+// GormDataType stores lists as text
+func (StringList) GormDataType() string {
+	return "text"
+}
+
+// Notification is an in-app notification for a user
+type Notification struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Type      string    `json:"type"` // e.g. "access_request"
+	Title     string    `json:"title"`
+	Message   string    `json:"message"`
+	Data      JSON      `json:"data,omitempty"` // Related resources (e.g. share link and request IDs)
+	Read      bool      `gorm:"default:false" json:"read"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // Config represents application configuration
 type Config struct {
-	HomeAssistantURL string `json:"home_assistant_url"`
-	Token            string `json:"token"`
-	Host             string `json:"host"`
-	Port             string `json:"port"`
-	RefreshInterval  int    `json:"refresh_interval"` // in seconds
-	DBPath           string `json:"db_path"`
-	JWTSecret        string `json:"jwt_secret"`
+	HomeAssistantURL        string   `json:"home_assistant_url"`
+	Token                   string   `json:"token"`
+	Host                    string   `json:"host"`
+	Port                    string   `json:"port"`
+	RefreshInterval         int      `json:"refresh_interval"` // in seconds
+	DBPath                  string   `json:"db_path"`
+	JWTSecret               string   `json:"jwt_secret"`
+	PublicURL               string   `json:"public_url"`                // Externally reachable base URL used in share QR codes
+	ShareSweepInterval      int      `json:"share_sweep_interval"`      // in seconds
+	SharePurgeDays          int      `json:"share_purge_days"`          // 0 disables purging of inactive share links
+	TrustedProxies          []string `json:"trusted_proxies"`           // Proxy IPs/CIDRs whose forwarding headers are trusted
+	TrustedProxyHeader      string   `json:"trusted_proxy_header"`      // "x-forwarded-for" or "forwarded": the header the trusted proxies set
+	AccessRequestTTL        int      `json:"access_request_ttl"`        // in minutes, pending access requests expire afterwards
+	ViewerSessionHours      int      `json:"viewer_session_hours"`      // Lifetime of sessions granted by approved access requests
+	ActionRequestTTL        int      `json:"action_request_ttl"`        // in minutes, pending action requests expire afterwards
+	ShareEntityPolicy       string   `json:"share_entity_policy"`       // "tracked", "allowlist" or "off": which entities share links may expose
+	ShareEntityAllowlist    []string `json:"share_entity_allowlist"`    // Entity IDs or patterns (e.g. "sensor.outdoor_*") anyone may share
+	KioskHeartbeatInterval  int      `json:"kiosk_heartbeat_interval"`  // in seconds, kiosk devices missing 3 heartbeats are shown offline
+	AutoRevertInterval      int      `json:"auto_revert_interval"`      // in seconds, how often due auto-revert jobs are executed
+	ReservationNoShow       int      `json:"reservation_no_show"`       // in minutes, unused reservations are released this long after they start (0 = never)
+	WebhookDeliveryInterval int      `json:"webhook_delivery_interval"` // in seconds, how often due outbound webhook deliveries are retried
+	WebhookMaxAttempts      int      `json:"webhook_max_attempts"`      // Attempts before an outbound webhook delivery is given up
+	MQTTBrokerURL           string   `json:"mqtt_broker_url"`           // e.g. tcp://localhost:1883, empty disables the MQTT bridge
+	MQTTUsername            string   `json:"mqtt_username"`             // Broker credentials, optional
+	MQTTPassword            string   `json:"mqtt_password"`             // Broker credentials, optional
+	MQTTClientID            string   `json:"mqtt_client_id"`            // Client ID of the bridge's broker connection
+	MQTTTopicPrefix         string   `json:"mqtt_topic_prefix"`         // Root of all topics the bridge publishes and subscribes to
+	MQTTEventTypes          []string `json:"mqtt_event_types"`          // Event types or patterns published to MQTT, empty for none
+	MQTTCommands            bool     `json:"mqtt_commands"`             // Accept triggers of shared entities on the command topic
 }
 
 // JSON is a custom type for storing JSON data in SQLite
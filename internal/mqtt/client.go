@@ -0,0 +1,96 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/ThraaxSession/Hash/internal/models"
+)
+
+// publishTimeout bounds how long a publish or subscribe waits for the broker
+const publishTimeout = 10 * time.Second
+
+// Client represents a connection to an MQTT broker below a topic prefix
+type Client struct {
+	Prefix string
+	conn   paho.Client
+}
+
+// MessageHandler handles a message received on a subscribed topic
+type MessageHandler func(topic string, payload []byte)
+
+// Connect connects to the broker configured in cfg. onConnect is called after every
+// (re)connect, which is where subscriptions have to be (re)established
+func Connect(cfg *models.Config, onConnect func(*Client)) (*Client, error) {
+	client := &Client{Prefix: cfg.MQTTTopicPrefix}
+	statusTopic := client.Topic("status")
+
+	options := paho.NewClientOptions().
+		AddBroker(cfg.MQTTBrokerURL).
+		SetClientID(cfg.MQTTClientID).
+		SetUsername(cfg.MQTTUsername).
+		SetPassword(cfg.MQTTPassword).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(statusTopic, "offline", 1, true).
+		SetOnConnectHandler(func(paho.Client) {
+			client.publish(statusTopic, true, []byte("online"))
+			if onConnect != nil {
+				onConnect(client)
+			}
+		})
+
+	client.conn = paho.NewClient(options)
+	token := client.conn.Connect()
+	if !token.WaitTimeout(publishTimeout) {
+		// Keep retrying in the background; messages are queued until connected
+		return client, nil
+	}
+	if err := token.Error(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// Topic joins parts below the client's prefix
+func (c *Client) Topic(parts ...string) string {
+	return c.Prefix + "/" + strings.Join(parts, "/")
+}
+
+// Publish sends payload as JSON to topic
+func (c *Client) Publish(topic string, retained bool, payload interface{}) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return c.publish(topic, retained, encoded)
+}
+
+func (c *Client) publish(topic string, retained bool, payload []byte) error {
+	token := c.conn.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timed out publishing to %s", topic)
+	}
+	return token.Error()
+}
+
+// Subscribe calls handler for every message on topic, which may contain wildcards
+func (c *Client) Subscribe(topic string, handler MessageHandler) error {
+	token := c.conn.Subscribe(topic, 1, func(_ paho.Client, message paho.Message) {
+		handler(message.Topic(), message.Payload())
+	})
+	if !token.WaitTimeout(publishTimeout) {
+		return fmt.Errorf("timed out subscribing to %s", topic)
+	}
+	return token.Error()
+}
+
+// Close announces the bridge as offline and disconnects from the broker
+func (c *Client) Close() {
+	c.publish(c.Topic("status"), true, []byte("offline"))
+	c.conn.Disconnect(250)
+}
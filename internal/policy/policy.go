@@ -0,0 +1,14 @@
+package policy
+
+import "path"
+
+// MatchesEntityPattern reports whether the entity ID matches one of the patterns (e.g. "light.*") of the
+// share entity allowlist. Invalid patterns never match.
+func MatchesEntityPattern(patterns []string, entityID string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, entityID); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package redaction
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/ThraaxSession/Hash/internal/models"
+)
+
+// locationAttributes are coordinates that can be coarsened instead of removed
+var locationAttributes = map[string]bool{
+	"latitude":  true,
+	"longitude": true,
+}
+
+// globalRedactions are removed from entities of every domain
+var globalRedactions = []string{
+	"access_token",
+	"token",
+}
+
+// domainRedactions are removed by default from entities of the given domain
+var domainRedactions = map[string][]string{
+	"person": {
+		"latitude", "longitude", "gps_accuracy", "altitude", "course", "speed", "vertical_accuracy",
+		"source", "user_id", "id", "device_trackers",
+	},
+	"device_tracker": {
+		"latitude", "longitude", "gps_accuracy", "altitude", "course", "speed", "vertical_accuracy",
+		"ip", "mac", "host_name",
+	},
+	"zone": {
+		"latitude", "longitude", "radius", "persons",
+	},
+	"camera": {
+		"entity_picture", "access_token", "stream_source",
+	},
+	"media_player": {
+		"entity_picture", "entity_picture_local",
+	},
+	"image": {
+		"entity_picture", "access_token",
+	},
+	"update": {
+		"entity_picture",
+	},
+}
+
+// Entity applies the filter to the attributes of an entity in place
+func Entity(entity *models.Entity, filter models.AttributeFilter) {
+	if entity == nil || len(entity.Attributes) == 0 {
+		return
+	}
+
+	attributes, err := entity.Attributes.ToMap()
+	if err != nil {
+		// Never pass through attributes we cannot inspect
+		entity.Attributes = nil
+		return
+	}
+
+	filtered := Attributes(entity.EntityID, attributes, filter)
+	data, err := json.Marshal(filtered)
+	if err != nil {
+		entity.Attributes = nil
+		return
+	}
+	entity.Attributes = data
+}
+
+// Entities applies the filter to the attributes of every entity in place
+func Entities(entities []*models.Entity, filter models.AttributeFilter) {
+	for _, entity := range entities {
+		Entity(entity, filter)
+	}
+}
+
+// Attributes returns a filtered copy of attributes for the given entity ID.
+//
+// Attributes not in a non-empty allow list are dropped, denied attributes are removed,
+// and the built-in redactions for the entity's domain are applied to anything not explicitly
+// allowed. Coordinates are rounded to LocationPrecisionKm when set instead of being removed.
+func Attributes(entityID string, attributes map[string]interface{}, filter models.AttributeFilter) map[string]interface{} {
+	allowed := toSet(filter.Allow)
+	denied := toSet(filter.Deny)
+
+	redacted := toSet(globalRedactions)
+	domain := strings.SplitN(entityID, ".", 2)[0]
+	for _, key := range domainRedactions[domain] {
+		redacted[key] = true
+	}
+
+	result := make(map[string]interface{}, len(attributes))
+	for key, value := range attributes {
+		if len(allowed) > 0 && !allowed[key] {
+			continue
+		}
+		if denied[key] {
+			continue
+		}
+		if redacted[key] && !allowed[key] {
+			// Location can be exposed coarsely instead of being dropped
+			if !(locationAttributes[key] && filter.LocationPrecisionKm > 0) {
+				continue
+			}
+		}
+		result[key] = value
+	}
+
+	if filter.LocationPrecisionKm > 0 {
+		coarsenLocation(result, filter.LocationPrecisionKm)
+	}
+
+	return result
+}
+
+// coarsenLocation rounds latitude/longitude to a grid of roughly precisionKm
+func coarsenLocation(attributes map[string]interface{}, precisionKm float64) {
+	lat, hasLat := toFloat(attributes["latitude"])
+	lon, hasLon := toFloat(attributes["longitude"])
+
+	if hasLat {
+		// One degree of latitude is ~110.574 km
+		lat = roundTo(lat, precisionKm/110.574)
+		attributes["latitude"] = lat
+	}
+	if hasLon {
+		// One degree of longitude shrinks with the cosine of the latitude
+		kmPerDegree := 111.320 * math.Cos(lat*math.Pi/180)
+		if kmPerDegree < 1 {
+			kmPerDegree = 1
+		}
+		attributes["longitude"] = roundTo(lon, precisionKm/kmPerDegree)
+	}
+	if hasLat || hasLon {
+		// Exact accuracy would reveal more than the coarsened position
+		delete(attributes, "gps_accuracy")
+		delete(attributes, "vertical_accuracy")
+	}
+}
+
+func roundTo(value, step float64) float64 {
+	if step <= 0 {
+		return value
+	}
+	// Trim float noise from the grid snap to ~0.1 m
+	return math.Round(math.Round(value/step)*step*1e6) / 1e6
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
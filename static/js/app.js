@@ -5,9 +5,16 @@ const API_BASE = '/api';
 let trackedEntities = [];
 let allHAEntities = [];
 let shareLinks = [];
+let accessRequests = [];
+let actionRequests = [];
+let revertJobs = [];
+let reservations = [];
+let webhooks = [];
+let webhookSubscriptions = [];
 let authToken = '';
 let isAdmin = false;
 let allUsers = [];
+let groups = [];
 let sharedWithMe = [];
 let mySharedEntities = [];
 let settingsListenersSet = false; // Track if settings listeners are set
@@ -36,9 +43,14 @@ function showSection(sectionId) {
     
     // Load section-specific data
     if (sectionId === 'shared-with-me') {
-        loadSharedWithMe();
+        loadShareInvitations();
+        loadSharedWithMe().then(loadReservations);
     } else if (sectionId === 'my-shared-entities') {
         loadMySharedEntities();
+        loadGroups();
+    } else if (sectionId === 'webhooks') {
+        loadWebhooks();
+        loadWebhookSubscriptions();
     } else if (sectionId === 'admin') {
         loadAdminPanel();
     } else if (sectionId === 'settings') {
@@ -52,9 +64,13 @@ document.addEventListener('DOMContentLoaded', function() {
     setupEventListeners();
     loadEntities();
     loadShareLinks();
+    loadAccessRequests();
+    loadActionRequests();
+    loadRevertJobs();
     startAutoRefresh();
     checkAdminStatus();
     loadAllUsers();
+    loadGroups();
 });
 
 // Check if user is authenticated
@@ -112,7 +128,11 @@ function setupEventListeners() {
     document.getElementById('addEntityBtn').addEventListener('click', addEntity);
     document.getElementById('browseEntitiesBtn').addEventListener('click', showBrowseModal);
     document.getElementById('createShareBtn').addEventListener('click', createShareLink);
+    document.getElementById('previewSelectorsBtn').addEventListener('click', previewSelectors);
     document.getElementById('shareType').addEventListener('change', handleShareTypeChange);
+    document.getElementById('shareIsAction').addEventListener('change', function() {
+        document.getElementById('actionFields').style.display = this.checked ? 'block' : 'none';
+    });
     
     // Modal
     const modal = document.getElementById('browseModal');
@@ -402,34 +422,61 @@ async function loadShareLinks() {
 async function createShareLink() {
     const entityCheckboxes = document.querySelectorAll('#shareEntitySelect input[type="checkbox"]:checked');
     const entityIds = Array.from(entityCheckboxes).map(cb => cb.value);
+    const patterns = parsePatterns(document.getElementById('sharePatterns').value);
     
-    if (entityIds.length === 0) {
-        showError('Please select at least one entity to share');
+    if (entityIds.length === 0 && patterns.length === 0) {
+        showError('Please select at least one entity or enter a pattern to share');
         return;
     }
     
     const type = document.getElementById('shareType').value;
     const accessMode = document.getElementById('accessMode').value;
     
+    let conditions;
+    try {
+        conditions = parseConditions(document.getElementById('shareConditions').value);
+    } catch (error) {
+        showError(error.message);
+        return;
+    }
+    
     // Handle user-to-user sharing differently
     if (type === 'user') {
-        const targetUserId = document.getElementById('targetUser').value;
-        if (!targetUserId) {
-            showError('Please select a user to share with');
+        const targetValue = document.getElementById('targetUser').value;
+        if (!targetValue) {
+            showError('Please select a user or group to share with');
+            return;
+        }
+        // Group options are prefixed to tell them apart from users
+        const shareTarget = targetValue.startsWith('group:')
+            ? { group_id: parseInt(targetValue.slice('group:'.length)) }
+            : { shared_with_id: parseInt(targetValue) };
+        
+        let schedule;
+        try {
+            schedule = parseSchedule(document.getElementById('shareSchedule').value);
+        } catch (error) {
+            showError(error.message);
             return;
         }
+        const expiresAt = document.getElementById('shareUserExpiresAt').value;
         
         try {
-            // Share each entity with the selected user
-            for (const entityId of entityIds) {
+            // Share each entity and each pattern with the selected user or group
+            const targets = entityIds.map(entityId => ({ entity_id: entityId }))
+                .concat(patterns.map(pattern => ({ pattern: pattern })));
+            for (const target of targets) {
                 const response = await fetch(`${API_BASE}/share-entity`, {
                     method: 'POST',
                     headers: getAuthHeaders(),
-                    body: JSON.stringify({
-                        entity_id: entityId,
-                        shared_with_id: parseInt(targetUserId),
-                        access_mode: accessMode
-                    })
+                    body: JSON.stringify(Object.assign({}, target, shareTarget, {
+                        access_mode: accessMode,
+                        requires_approval: document.getElementById('shareRequiresApproval').checked,
+                        conditions: conditions,
+                        expires_at: expiresAt ? new Date(expiresAt).toISOString() : '',
+                        schedule: schedule,
+                        message: document.getElementById('shareUserMessage').value.trim()
+                    }))
                 });
                 
                 if (response.status === 401) {
@@ -443,8 +490,12 @@ async function createShareLink() {
                 }
             }
             
-            showSuccess(`Successfully shared ${entityIds.length} entities with user`);
+            showSuccess(shareTarget.group_id
+                ? `Successfully shared ${targets.length} entities and patterns with group`
+                : `Invited user to ${targets.length} entities and patterns; they show up once accepted`);
+            document.getElementById('shareUserMessage').value = '';
             entityCheckboxes.forEach(cb => cb.checked = false);
+            clearSelectorInput();
             return;
         } catch (error) {
             console.error('Error sharing entities:', error);
@@ -454,12 +505,39 @@ async function createShareLink() {
     }
     
     // Handle link-based sharing
+    let schedule;
+    try {
+        schedule = parseSchedule(document.getElementById('shareSchedule').value);
+    } catch (error) {
+        showError(error.message);
+        return;
+    }
+    
     const data = {
         entity_ids: entityIds,
+        selectors: patterns.map(pattern => ({ pattern: pattern, access_mode: accessMode })),
         type: type,
-        access_mode: accessMode
+        access_mode: accessMode,
+        instructions: document.getElementById('shareInstructions').value.trim(),
+        conditions: conditions,
+        schedule: schedule
     };
     
+    // Action links run a single service on a single entity
+    if (document.getElementById('shareIsAction').checked) {
+        if (entityIds.length !== 1 || patterns.length > 0) {
+            showError('Please select exactly one entity for an action link');
+            return;
+        }
+        try {
+            data.action = readActionFields(entityIds[0], 'action');
+        } catch (error) {
+            showError(error.message);
+            return;
+        }
+        data.selectors = [];
+    }
+    
     if (type === 'counter') {
         data.max_access = parseInt(document.getElementById('maxAccess').value);
     } else if (type === 'time') {
@@ -493,12 +571,327 @@ async function createShareLink() {
         
         // Clear selections
         entityCheckboxes.forEach(cb => cb.checked = false);
+        clearSelectorInput();
+        document.getElementById('shareIsAction').checked = false;
+        document.getElementById('actionFields').style.display = 'none';
     } catch (error) {
         console.error('Error creating share link:', error);
         showError('Failed to create share link: ' + error.message);
     }
 }
 
+// Split a comma-separated list of entity patterns (e.g. "light.garden_*, switch.*")
+function parsePatterns(value) {
+    return value.split(',').map(p => p.trim()).filter(p => p);
+}
+
+// Parse share conditions, one per line: "entity_id = on, home", "entity_id != off", "entity_id > 20" or
+// "entity_id[attribute] < 30". Conditions left unchanged keep their message.
+function parseConditions(value, existing = []) {
+    const known = {};
+    existing.forEach(condition => known[formatCondition(condition)] = condition);
+    
+    const conditions = {};
+    const order = [];
+    value.split('\n').map(line => line.trim()).filter(line => line).forEach(line => {
+        const match = line.match(/^([a-z0-9_]+\.[a-z0-9_]+)(?:\[([^\]]+)\])?\s*(!=|=|>|<)\s*(.+)$/i);
+        if (!match) {
+            throw new Error(`Invalid condition "${line}". Use e.g. "input_boolean.guest_mode = on"`);
+        }
+        const entityId = match[1].toLowerCase();
+        const attribute = (match[2] || '').trim();
+        const operator = match[3];
+        const operand = match[4].trim();
+        
+        // Combine "> 20" and "< 30" on the same entity into one range
+        const numeric = operator === '>' || operator === '<';
+        const key = numeric ? `${entityId}[${attribute}] range` : line;
+        if (!conditions[key]) {
+            conditions[key] = { entity_id: entityId };
+            if (attribute) conditions[key].attribute = attribute;
+            order.push(key);
+        }
+        const condition = conditions[key];
+        
+        if (numeric) {
+            const number = parseFloat(operand);
+            if (isNaN(number)) {
+                throw new Error(`Invalid number in condition "${line}"`);
+            }
+            condition[operator === '>' ? 'above' : 'below'] = number;
+        } else {
+            condition[operator === '=' ? 'state' : 'not_state'] = operand.split(',').map(s => s.trim()).filter(s => s);
+        }
+    });
+    return order.map(key => known[formatCondition(conditions[key])] || conditions[key]);
+}
+
+// Format share conditions as lines of the conditions input
+function formatCondition(condition) {
+    const target = condition.entity_id + (condition.attribute ? `[${condition.attribute}]` : '');
+    const parts = [];
+    if (condition.state && condition.state.length) parts.push(`${target} = ${condition.state.join(', ')}`);
+    if (condition.not_state && condition.not_state.length) parts.push(`${target} != ${condition.not_state.join(', ')}`);
+    if (condition.above !== undefined && condition.above !== null) parts.push(`${target} > ${condition.above}`);
+    if (condition.below !== undefined && condition.below !== null) parts.push(`${target} < ${condition.below}`);
+    return parts.join('\n');
+}
+
+// Parse the schedule input of a share link, one window per line: "mon-fri 08:00-18:00", "sat,sun 10:00-14:00"
+// or "22:00-06:00" for every day. Times are in the browser's time zone.
+function parseSchedule(value) {
+    const days = ['sun', 'mon', 'tue', 'wed', 'thu', 'fri', 'sat'];
+    const windows = value.split('\n').map(line => line.trim()).filter(line => line).map(line => {
+        const match = line.match(/^(?:([a-z,\-\s]+?)\s+)?(\d{1,2}:\d{2})\s*-\s*(\d{1,2}:\d{2})$/i);
+        if (!match) {
+            throw new Error(`Invalid schedule window "${line}". Use e.g. "mon-fri 08:00-18:00"`);
+        }
+        const window = { start: match[2], end: match[3] };
+        if (match[1]) {
+            window.days = [];
+            match[1].toLowerCase().split(',').map(part => part.trim()).filter(part => part).forEach(part => {
+                const [from, to] = part.split('-').map(day => day.trim().slice(0, 3));
+                const start = days.indexOf(from);
+                const end = to === undefined ? start : days.indexOf(to);
+                if (start < 0 || end < 0) {
+                    throw new Error(`Invalid days "${part}" in schedule window "${line}"`);
+                }
+                // Ranges like "fri-mon" wrap around the weekend
+                for (let i = start; ; i = (i + 1) % 7) {
+                    window.days.push(days[i]);
+                    if (i === end) break;
+                }
+            });
+        }
+        return window;
+    });
+    return { windows: windows, timezone: windows.length ? Intl.DateTimeFormat().resolvedOptions().timeZone : '' };
+}
+
+// Format a share link's schedule as lines of the schedule input
+function formatSchedule(schedule) {
+    if (!schedule || !schedule.windows) return '';
+    return schedule.windows.map(window => {
+        const days = window.days && window.days.length ? window.days.join(',') + ' ' : '';
+        return `${days}${window.start}-${window.end}`;
+    }).join('\n');
+}
+
+// Format a number of seconds as e.g. "2d 3h", "45m" or "30s"
+function formatRemaining(seconds) {
+    if (seconds >= 86400) return `${Math.floor(seconds / 86400)}d ${Math.floor(seconds % 86400 / 3600)}h`;
+    if (seconds >= 3600) return `${Math.floor(seconds / 3600)}h ${Math.floor(seconds % 3600 / 60)}m`;
+    if (seconds >= 60) return `${Math.floor(seconds / 60)}m`;
+    return `${seconds}s`;
+}
+
+// Describe when a user share grants access: its schedule, expiry and remaining time
+function describeShareAccess(item) {
+    const parts = [];
+    if (item.Schedule && (item.Schedule.windows || []).length > 0) {
+        parts.push(`Available: ${formatSchedule(item.Schedule).replace(/\n/g, ', ')}`);
+        if (!item.Available) parts.push('not available now');
+    }
+    if (item.ExpiresAt) {
+        parts.push(`Until ${new Date(item.ExpiresAt).toLocaleString()}`);
+    }
+    if (item.Available && item.RemainingSeconds !== null && item.RemainingSeconds !== undefined) {
+        parts.push(`${formatRemaining(item.RemainingSeconds)} left`);
+    }
+    return parts.length > 0 ? `<div class="entity-state">⏱️ ${escapeHtml(parts.join(' · '))}</div>` : '';
+}
+
+// Read the service, data and confirmation inputs of an action link, e.g. with the prefix "editAction"
+function readActionFields(entityId, prefix) {
+    const service = document.getElementById(`${prefix}Service`).value.trim();
+    if (!service) {
+        throw new Error('Please enter the service of the action link');
+    }
+    const action = { entity_id: entityId, service: service, confirm: document.getElementById(`${prefix}Confirm`).checked };
+    const data = document.getElementById(`${prefix}Data`).value.trim();
+    if (data) {
+        try {
+            action.data = JSON.parse(data);
+        } catch (error) {
+            throw new Error('The service data of the action link must be a JSON object');
+        }
+    }
+    return action;
+}
+
+// Parse the action chain input of a share entry. Lines are steps:
+// "light.turn_on light.hallway {json}", "event name {json}" or "delay 30", with an optional
+// "try " prefix to continue when the step fails. "when unlock, turn_on" limits the trigger services.
+function parseChain(value, entityId = '') {
+    const chain = { steps: [] };
+    value.split('\n').map(line => line.trim()).filter(line => line).forEach(line => {
+        const when = line.match(/^when\s+(.+)$/i);
+        if (when) {
+            chain.services = when[1].split(',').map(s => s.trim()).filter(s => s);
+            return;
+        }
+        
+        const step = {};
+        let rest = line;
+        if (/^try\s+/i.test(rest)) {
+            step.continue_on_error = true;
+            rest = rest.replace(/^try\s+/i, '');
+        }
+        
+        // Trailing JSON object is the step's data
+        const brace = rest.indexOf('{');
+        if (brace >= 0) {
+            try {
+                step.data = JSON.parse(rest.slice(brace));
+            } catch (error) {
+                throw new Error(`Invalid data in chain step "${line}" of ${entityId}`);
+            }
+            rest = rest.slice(0, brace).trim();
+        }
+        
+        const parts = rest.split(/\s+/);
+        if (parts[0] === 'delay' && parts.length === 2) {
+            step.type = 'delay';
+            step.delay_seconds = parseInt(parts[1]) || 0;
+        } else if (parts[0] === 'event' && parts.length === 2) {
+            step.type = 'event';
+            step.event = parts[1];
+        } else if (parts[0].includes('.') && parts.length <= 2) {
+            step.type = 'service';
+            step.service = parts[0];
+            if (parts[1]) step.entity_id = parts[1];
+        } else {
+            throw new Error(`Invalid chain step "${line}" of ${entityId}. Use e.g. "light.turn_on light.hallway", "event guest_arrived" or "delay 30"`);
+        }
+        chain.steps.push(step);
+    });
+    return chain.steps.length ? chain : null;
+}
+
+// Format an action chain as lines of the chain input
+function formatChain(chain) {
+    if (!chain || !chain.steps) return '';
+    const lines = [];
+    if (chain.services && chain.services.length) lines.push(`when ${chain.services.join(', ')}`);
+    chain.steps.forEach(step => {
+        let line = step.continue_on_error ? 'try ' : '';
+        if (step.type === 'delay') {
+            line += `delay ${step.delay_seconds}`;
+        } else if (step.type === 'event') {
+            line += `event ${step.event}`;
+        } else {
+            line += step.service + (step.entity_id ? ` ${step.entity_id}` : '');
+        }
+        if (step.data && Object.keys(step.data).length) line += ' ' + JSON.stringify(step.data);
+        lines.push(line);
+    });
+    return lines.join('\n');
+}
+
+// Show the calls an entry's action chain would make, without running it
+async function previewChain(button) {
+    const item = button.closest('.checkbox-item');
+    const container = item.querySelector('.entry-chain-preview');
+    
+    let chain;
+    try {
+        chain = parseChain(item.querySelector('.entry-chain').value, item.getAttribute('data-entity-id'));
+    } catch (error) {
+        showError(error.message);
+        return;
+    }
+    if (!chain) {
+        container.innerHTML = '';
+        return;
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE}/chains/preview`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ chain: chain })
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        const result = await response.json();
+        if (!response.ok) {
+            throw new Error(result.error || 'Failed to preview chain');
+        }
+        
+        let html = result.steps.map(step => `
+            <div>${step.step}. ${escapeHtml(step.description)}${step.data ? ` <code>${escapeHtml(JSON.stringify(step.data))}</code>` : ''}${(step.warnings || []).map(w => ` <span class="badge badge-warning">${escapeHtml(w)}</span>`).join('')}</div>
+        `).join('');
+        if (result.services && result.services.length) {
+            html = `<div>Runs after: ${result.services.map(escapeHtml).join(', ')}</div>` + html;
+        }
+        if (result.total_delay_seconds > 0) {
+            html += `<div>Takes at least ${result.total_delay_seconds} seconds</div>`;
+        }
+        container.innerHTML = html;
+    } catch (error) {
+        console.error('Error previewing chain:', error);
+        showError('Failed to preview chain: ' + error.message);
+    }
+}
+
+function clearSelectorInput() {
+    document.getElementById('sharePatterns').value = '';
+    document.getElementById('shareConditions').value = '';
+    document.getElementById('selectorPreview').innerHTML = '';
+}
+
+// Show which entities the entered patterns currently match
+async function previewSelectors() {
+    const patterns = parsePatterns(document.getElementById('sharePatterns').value);
+    const container = document.getElementById('selectorPreview');
+    
+    if (patterns.length === 0) {
+        showError('Please enter at least one pattern');
+        return;
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE}/selectors/preview`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ selectors: patterns.map(pattern => ({ pattern: pattern })) })
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        const result = await response.json();
+        if (!response.ok) {
+            throw new Error(result.error || 'Failed to preview patterns');
+        }
+        
+        let html = `<div style="margin-top: 8px;">Matches ${result.count} entities${result.truncated ? ` (limited to ${result.max_matches})` : ''}:</div>`;
+        html += result.matches.map(match => `
+            <div class="checkbox-item">${escapeHtml(match.entity_id)}${match.friendly_name ? ` - ${escapeHtml(match.friendly_name)}` : ''} <span class="badge badge-info">${escapeHtml(match.state)}</span></div>
+        `).join('');
+        if (result.excluded.length > 0) {
+            html += `<div style="margin-top: 8px; font-size: 0.9em;">Not shareable under the share entity policy: ${result.excluded.map(escapeHtml).join(', ')}</div>`;
+        }
+        container.innerHTML = html;
+    } catch (error) {
+        console.error('Error previewing patterns:', error);
+        showError('Failed to preview patterns: ' + error.message);
+    }
+}
+
+// Readable form of an entity selector, e.g. "light.* (light)"
+function describeSelector(selector) {
+    const domains = (selector.domains || []).join(', ');
+    if (!selector.pattern) return domains;
+    return domains ? `${selector.pattern} (${domains})` : selector.pattern;
+}
+
 async function deleteShareLink(shareId) {
     const confirmed = await Dialog.confirm('Are you sure you want to delete this share link?', 'Delete Share Link');
     if (!confirmed) return;
@@ -533,7 +926,8 @@ function renderShareLinks() {
     }
     
     container.innerHTML = shareLinks.map(link => {
-        const shareUrl = `${window.location.origin}/share/${link.id}`;
+        const action = link.action || {};
+        const shareUrl = `${window.location.origin}/${action.entity_id ? 'a' : link.type === 'kiosk' ? 'kiosk' : 'share'}/${link.id}`;
         const typeBadge = `badge-${link.type}`;
         const statusBadge = link.active ? 'badge-active' : 'badge-inactive';
         
@@ -543,170 +937,106 @@ function renderShareLinks() {
         } else if (link.type === 'time') {
             const expiresAt = new Date(link.expires_at).toLocaleString();
             details = `Expires: ${expiresAt}`;
+        } else if (link.type === 'kiosk') {
+            details = `<span id="kiosk-status-${link.id}">Loading kiosk status...</span>`;
         } else {
             details = 'Permanent link';
         }
         
-        const accessModeBadge = link.access_mode === 'triggerable' ? 'badge-permanent' : 'badge-counter';
-        const accessModeText = link.access_mode === 'triggerable' ? 'Triggerable' : 'Read-Only';
+        const entries = link.entries || [];
+        const triggerableCount = entries.filter(entry => entry.access_mode === 'triggerable').length;
+        const accessModeBadge = triggerableCount > 0 ? 'badge-permanent' : 'badge-counter';
+        let accessModeText = 'Read-Only';
+        if (triggerableCount > 0) {
+            accessModeText = triggerableCount === entries.length ? 'Triggerable' : 'Mixed';
+        }
         
         return `
             <div class="share-item">
                 <div class="share-header">
                     <div>
                         <span class="badge ${typeBadge}">${link.type}</span>
-                        <span class="badge ${accessModeBadge}">${accessModeText}</span>
+                        ${action.entity_id ? '<span class="badge badge-permanent">Action</span>' : `<span class="badge ${accessModeBadge}">${accessModeText}</span>`}
                         <span class="badge ${statusBadge}">${link.active ? 'Active' : 'Inactive'}</span>
                     </div>
                     <div>
+                        <button class="btn btn-secondary" onclick="openShareAsset('${link.id}', 'qr')" style="margin-right: 5px;">QR Code</button>
+                        <button class="btn btn-secondary" onclick="openShareAsset('${link.id}', 'card')" style="margin-right: 5px;">Guest Card</button>
                         <button class="btn btn-secondary" onclick="editShareLink('${link.id}')" style="margin-right: 5px;">Edit</button>
                         <button class="btn btn-danger" onclick="deleteShareLink('${link.id}')">Delete</button>
                     </div>
                 </div>
                 <div class="share-details">
-                    <div>Entities: ${link.entity_ids.length}</div>
+                    ${action.entity_id ? `<div>Action: ${escapeHtml(action.service)} on ${escapeHtml(action.entity_id)}</div>` : `<div>Entities: ${entries.length}</div>`}
+                    ${(link.selectors || []).length > 0 ? `<div>Patterns: ${escapeHtml(link.selectors.map(describeSelector).join(', '))}</div>` : ''}
+                    ${(link.conditions || []).length > 0 ? `<div>Only while: ${escapeHtml(link.conditions.map(formatCondition).join(', ').replace(/\n/g, ', '))}</div>` : ''}
+                    ${link.schedule && (link.schedule.windows || []).length > 0 ? `<div>Available: ${escapeHtml(formatSchedule(link.schedule).replace(/\n/g, ', '))}</div>` : ''}
                     <div>${details}</div>
                     <div>Created: ${new Date(link.created_at).toLocaleString()}</div>
                 </div>
                 <div class="share-link">${shareUrl}</div>
                 <button class="btn btn-copy" onclick="copyToClipboard('${shareUrl}')">Copy Link</button>
+                ${link.type === 'kiosk' ? `
+                    <button class="btn btn-secondary" onclick="revokeKioskDevice('${link.id}', false)">Revoke Device</button>
+                    <button class="btn btn-secondary" onclick="revokeKioskDevice('${link.id}', true)">Bind New Device</button>
+                ` : ''}
             </div>
         `;
     }).join('');
-}
-
-function editShareLink(shareId) {
-    const share = shareLinks.find(s => s.id === shareId);
-    if (!share) return;
-    
-    // Show edit modal (we'll create this)
-    const modal = document.getElementById('editShareModal');
-    if (!modal) {
-        // Create edit modal dynamically
-        const modalHTML = `
-            <div id="editShareModal" class="modal">
-                <div class="modal-content">
-                    <span class="close" onclick="document.getElementById('editShareModal').style.display='none'">&times;</span>
-                    <h2 style="color: var(--text-primary);">Edit Share Link</h2>
-                    <div id="editShareContent"></div>
-                </div>
-            </div>
-        `;
-        document.body.insertAdjacentHTML('beforeend', modalHTML);
-    }
-    
-    const content = document.getElementById('editShareContent');
-    content.innerHTML = `
-        <div class="form-group">
-            <label>Select Entities to Share:</label>
-            <div id="editShareEntitySelect" class="checkbox-group"></div>
-        </div>
-        
-        <div class="form-group">
-            <label>Link Type:</label>
-            <select id="editShareType">
-                <option value="permanent" ${share.type === 'permanent' ? 'selected' : ''}>Permanent</option>
-                <option value="counter" ${share.type === 'counter' ? 'selected' : ''}>Counter-Limited</option>
-                <option value="time" ${share.type === 'time' ? 'selected' : ''}>Time-Limited</option>
-            </select>
-        </div>
-        
-        <div class="form-group">
-            <label>Access Mode:</label>
-            <select id="editAccessMode">
-                <option value="readonly" ${share.access_mode === 'readonly' ? 'selected' : ''}>Read-Only</option>
-                <option value="triggerable" ${share.access_mode === 'triggerable' ? 'selected' : ''}>Triggerable</option>
-            </select>
-        </div>
-        
-        <div id="editShareOptions"></div>
-        
-        <button class="btn btn-primary" onclick="saveShareLink('${shareId}')">Save Changes</button>
-        <button class="btn btn-secondary" onclick="document.getElementById('editShareModal').style.display='none'">Cancel</button>
-    `;
-    
-    // Populate entities
-    const entityContainer = document.getElementById('editShareEntitySelect');
-    entityContainer.innerHTML = trackedEntities.map(entity => `
-        <div class="checkbox-item">
-            <label>
-                <input type="checkbox" value="${entity.entity_id}" 
-                       ${share.entity_ids.includes(entity.entity_id) ? 'checked' : ''}>
-                ${escapeHtml(entity.entity_id)}
-            </label>
-        </div>
-    `).join('');
-    
-    // Setup type change handler
-    document.getElementById('editShareType').addEventListener('change', updateEditShareOptions);
-    updateEditShareOptions();
     
-    document.getElementById('editShareModal').style.display = 'block';
+    refreshKioskStatuses();
 }
 
-function updateEditShareOptions() {
-    const type = document.getElementById('editShareType').value;
-    const container = document.getElementById('editShareOptions');
-    
-    if (type === 'counter') {
-        container.innerHTML = `
-            <div class="form-group">
-                <label>Max Access Count:</label>
-                <input type="number" id="editMaxAccess" min="1" value="10" />
-            </div>
-        `;
-    } else if (type === 'time') {
-        container.innerHTML = `
-            <div class="form-group">
-                <label>Expires At:</label>
-                <input type="datetime-local" id="editExpiresAt" />
-            </div>
-        `;
-    } else {
-        container.innerHTML = '';
-    }
+// Show whether the devices of kiosk links are online
+function refreshKioskStatuses() {
+    shareLinks.filter(link => link.type === 'kiosk').forEach(link => loadKioskStatus(link.id));
 }
 
-async function saveShareLink(shareId) {
-    const type = document.getElementById('editShareType').value;
-    const accessMode = document.getElementById('editAccessMode').value;
-    
-    // Get selected entities
-    const checkboxes = document.querySelectorAll('#editShareEntitySelect input[type="checkbox"]:checked');
-    const entityIds = Array.from(checkboxes).map(cb => cb.value);
-    
-    if (entityIds.length === 0) {
-        showError('Please select at least one entity');
-        return;
-    }
-    
-    const data = {
-        entity_ids: entityIds,
-        type: type,
-        access_mode: accessMode
-    };
+async function loadKioskStatus(shareId) {
+    const container = document.getElementById(`kiosk-status-${shareId}`);
+    if (!container) return;
     
-    if (type === 'counter') {
-        const maxAccess = parseInt(document.getElementById('editMaxAccess').value);
-        if (maxAccess < 1) {
-            showError('Max access must be at least 1');
+    try {
+        const response = await fetch(`${API_BASE}/shares/${shareId}/kiosk`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
             return;
         }
-        data.max_access = maxAccess;
-    } else if (type === 'time') {
-        const expiresAt = document.getElementById('editExpiresAt').value;
-        if (!expiresAt) {
-            showError('Please select an expiration date');
-            return;
+        
+        if (!response.ok) throw new Error('Failed to load kiosk status');
+        
+        const status = await response.json();
+        const device = status.devices.find(d => !d.revoked_at);
+        if (device) {
+            const lastSeen = new Date(device.last_seen_at).toLocaleString();
+            container.textContent = device.online ? `🟢 Kiosk online (last seen ${lastSeen})` : `🔴 Kiosk offline since ${lastSeen}`;
+            container.title = `${device.user_agent} - ${device.client_ip}`;
+        } else if (status.kiosk_bindable) {
+            container.textContent = '⏳ Waiting for a device to open the link';
+        } else {
+            container.textContent = '🚫 Device revoked';
         }
-        data.expires_at = new Date(expiresAt).toISOString();
+    } catch (error) {
+        console.error('Error loading kiosk status:', error);
+        container.textContent = 'Kiosk status unavailable';
     }
+}
+
+async function revokeKioskDevice(shareId, allowRebind) {
+    const message = allowRebind
+        ? 'Revoke the current device? The next device that opens the kiosk link will be bound to it.'
+        : 'Revoke the kiosk device? The link stays locked until you bind a new device.';
+    const confirmed = await Dialog.confirm(message, 'Revoke Kiosk Device');
+    if (!confirmed) return;
     
     try {
-        const response = await fetch(`${API_BASE}/shares/${shareId}`, {
-            method: 'PUT',
+        const response = await fetch(`${API_BASE}/shares/${shareId}/kiosk/revoke`, {
+            method: 'POST',
             headers: getAuthHeaders(),
-            body: JSON.stringify(data)
+            body: JSON.stringify({ allow_rebind: allowRebind })
         });
         
         if (response.status === 401) {
@@ -716,165 +1046,1638 @@ async function saveShareLink(shareId) {
         
         if (!response.ok) {
             const error = await response.json();
-            throw new Error(error.error || 'Failed to update share link');
+            throw new Error(error.error || 'Failed to revoke kiosk device');
         }
         
-        showSuccess('Share link updated successfully');
-        document.getElementById('editShareModal').style.display = 'none';
-        await loadShareLinks();
+        showSuccess(allowRebind ? 'Kiosk link is ready to be bound to a new device' : 'Kiosk device revoked');
+        await loadKioskStatus(shareId);
     } catch (error) {
-        console.error('Error updating share link:', error);
-        showError('Failed to update share link: ' + error.message);
+        console.error('Error revoking kiosk device:', error);
+        showError('Failed to revoke kiosk device: ' + error.message);
     }
 }
 
-function updateShareEntitySelect() {
-    const container = document.getElementById('shareEntitySelect');
+// Load pending access requests to the user's share links
+async function loadAccessRequests() {
+    try {
+        const response = await fetch(`${API_BASE}/access-requests?status=pending`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load access requests');
+        
+        accessRequests = await response.json();
+        renderAccessRequests();
+    } catch (error) {
+        console.error('Error loading access requests:', error);
+    }
+}
+
+function renderAccessRequests() {
+    const section = document.getElementById('accessRequestsSection');
+    const container = document.getElementById('accessRequestsList');
     
-    if (!trackedEntities || trackedEntities.length === 0) {
-        container.innerHTML = '<div class="empty-state">No entities available. Add entities first.</div>';
+    if (!accessRequests || accessRequests.length === 0) {
+        section.style.display = 'none';
+        container.innerHTML = '';
         return;
     }
     
-    // Sort entities: first alphabetically by entity_id, then by state
-    const sortedEntities = sortEntitiesByIdAndState(trackedEntities);
+    section.style.display = 'block';
+    container.innerHTML = accessRequests.map(request => {
+        const link = shareLinks.find(l => l.id === request.share_link_id);
+        const linkName = link && link.title ? link.title : request.share_link_id.substring(0, 8);
+        return `
+            <div class="share-item">
+                <div class="share-header">
+                    <div>
+                        <strong>${escapeHtml(request.name)}</strong> wants to access <em>${escapeHtml(linkName)}</em>
+                    </div>
+                    <div>
+                        <button class="btn btn-primary" onclick="decideAccessRequest('${request.id}', 'approve')" style="margin-right: 5px;">Approve</button>
+                        <button class="btn btn-danger" onclick="decideAccessRequest('${request.id}', 'deny')">Deny</button>
+                    </div>
+                </div>
+                <div class="share-details">
+                    ${request.message ? `<div>"${escapeHtml(request.message)}"</div>` : ''}
+                    <div>Requested: ${new Date(request.created_at).toLocaleString()} from ${escapeHtml(request.client_ip || 'unknown')}</div>
+                    <div>Expires: ${new Date(request.expires_at).toLocaleString()}</div>
+                </div>
+            </div>
+        `;
+    }).join('');
+}
+
+async function decideAccessRequest(requestId, decision) {
+    try {
+        const response = await fetch(`${API_BASE}/access-requests/${requestId}/${decision}`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to update access request');
+        }
+        
+        showSuccess(decision === 'approve' ? 'Access approved' : 'Access denied');
+    } catch (error) {
+        console.error('Error deciding access request:', error);
+        showError('Failed to update access request: ' + error.message);
+    }
+    await loadAccessRequests();
+}
+
+// Load actions waiting for the user's approval
+async function loadActionRequests() {
+    try {
+        const response = await fetch(`${API_BASE}/action-requests?status=pending`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load action requests');
+        
+        actionRequests = await response.json();
+        renderActionRequests();
+    } catch (error) {
+        console.error('Error loading action requests:', error);
+    }
+}
+
+function renderActionRequests() {
+    const section = document.getElementById('actionRequestsSection');
+    const container = document.getElementById('actionRequestsList');
     
-    container.innerHTML = `
-        <div class="search-box" style="margin-bottom: 10px;">
-            <input type="text" id="shareEntitySearch" placeholder="Search entities..." 
-                   oninput="filterShareEntities()" style="width: 100%; padding: 8px; border: 1px solid var(--border-color); border-radius: 6px;">
+    if (!actionRequests || actionRequests.length === 0) {
+        section.style.display = 'none';
+        container.innerHTML = '';
+        return;
+    }
+    
+    section.style.display = 'block';
+    container.innerHTML = actionRequests.map(request => {
+        const data = Object.assign({}, request.data || {});
+        delete data.entity_id;
+        const hasData = Object.keys(data).length > 0;
+        return `
+            <div class="share-item">
+                <div class="share-header">
+                    <div>
+                        <strong>${escapeHtml(request.requester_name)}</strong> wants to call <code>${escapeHtml(request.service)}</code> on <em>${escapeHtml(request.entity_id)}</em>
+                    </div>
+                    <div>
+                        <button class="btn btn-primary" onclick="decideActionRequest('${request.id}', 'approve')" style="margin-right: 5px;">Approve</button>
+                        <button class="btn btn-danger" onclick="decideActionRequest('${request.id}', 'reject')">Reject</button>
+                    </div>
+                </div>
+                <div class="share-details">
+                    ${hasData ? `<div>Data: <code>${escapeHtml(JSON.stringify(data))}</code></div>` : ''}
+                    <div>Requested: ${new Date(request.created_at).toLocaleString()} from ${escapeHtml(request.client_ip || 'unknown')}</div>
+                    <div>Expires: ${new Date(request.expires_at).toLocaleString()}</div>
+                </div>
+            </div>
+        `;
+    }).join('');
+}
+
+// Load pending auto-off timers of triggered share entities
+async function loadRevertJobs() {
+    try {
+        const response = await fetch(`${API_BASE}/revert-jobs?status=pending`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load auto-off timers');
+        
+        revertJobs = await response.json();
+        renderRevertJobs();
+    } catch (error) {
+        console.error('Error loading auto-off timers:', error);
+    }
+}
+
+function renderRevertJobs() {
+    const section = document.getElementById('revertJobsSection');
+    const container = document.getElementById('revertJobsList');
+    
+    if (!revertJobs || revertJobs.length === 0) {
+        section.style.display = 'none';
+        container.innerHTML = '';
+        return;
+    }
+    
+    section.style.display = 'block';
+    container.innerHTML = revertJobs.map(job => {
+        const link = shareLinks.find(s => s.id === job.share_link_id);
+        return `
+            <div class="share-item">
+                <div class="share-header">
+                    <div>
+                        <code>${escapeHtml(job.service)}</code> on <em>${escapeHtml(job.entity_id)}</em> at ${new Date(job.due_at).toLocaleTimeString()}
+                    </div>
+                    <button class="btn btn-danger" onclick="cancelRevertJob('${job.id}')">Keep As Is</button>
+                </div>
+                <div class="share-details">
+                    <div>Share link: ${escapeHtml((link && link.title) || job.share_link_id)}</div>
+                    <div>Triggered: ${new Date(job.created_at).toLocaleString()} (${escapeHtml(job.trigger_service)})</div>
+                </div>
+            </div>
+        `;
+    }).join('');
+}
+
+async function cancelRevertJob(jobId) {
+    try {
+        const response = await fetch(`${API_BASE}/revert-jobs/${jobId}/cancel`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to cancel auto-off timer');
+        }
+        
+        showSuccess('Auto-off timer cancelled');
+    } catch (error) {
+        console.error('Error cancelling auto-off timer:', error);
+        showError('Failed to cancel auto-off timer: ' + error.message);
+    }
+    await loadRevertJobs();
+}
+
+async function decideActionRequest(requestId, decision) {
+    try {
+        const response = await fetch(`${API_BASE}/action-requests/${requestId}/${decision}`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to update action request');
+        }
+        
+        showSuccess(decision === 'approve' ? 'Action approved and executed' : 'Action rejected');
+    } catch (error) {
+        console.error('Error deciding action request:', error);
+        showError('Failed to update action request: ' + error.message);
+    }
+    await loadActionRequests();
+}
+
+// Open a share link's QR code or printable guest card in a new tab
+async function openShareAsset(shareId, asset) {
+    try {
+        const response = await fetch(`${API_BASE}/shares/${shareId}/${asset}`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to load ' + asset);
+        }
+        
+        const blob = await response.blob();
+        window.open(URL.createObjectURL(blob), '_blank');
+    } catch (error) {
+        console.error('Error opening share asset:', error);
+        showError('Failed to open ' + (asset === 'qr' ? 'QR code' : 'guest card') + ': ' + error.message);
+    }
+}
+
+function editShareLink(shareId) {
+    const share = shareLinks.find(s => s.id === shareId);
+    if (!share) return;
+    
+    // Show edit modal (we'll create this)
+    const modal = document.getElementById('editShareModal');
+    if (!modal) {
+        // Create edit modal dynamically
+        const modalHTML = `
+            <div id="editShareModal" class="modal">
+                <div class="modal-content">
+                    <span class="close" onclick="document.getElementById('editShareModal').style.display='none'">&times;</span>
+                    <h2 style="color: var(--text-primary);">Edit Share Link</h2>
+                    <div id="editShareContent"></div>
+                </div>
+            </div>
+        `;
+        document.body.insertAdjacentHTML('beforeend', modalHTML);
+    }
+    
+    const filter = share.attribute_filter || {};
+    const ipRestriction = share.ip_restriction || {};
+    const geofence = share.geofence || {};
+    const embed = share.embed || {};
+    const action = share.action || {};
+    const content = document.getElementById('editShareContent');
+    content.innerHTML = `
+        ${action.entity_id ? `
+        <div class="form-group">
+            <label>Action (runs on ${escapeHtml(action.entity_id)}, the only entity of this link):</label>
+            <input type="text" id="editActionService" value="${escapeHtml(action.service || '')}" placeholder="Service, e.g. toggle" />
+            <textarea id="editActionData" rows="2" placeholder='Service data (optional JSON), e.g. {"brightness": 255}' style="margin-top: 8px;">${escapeHtml(action.data ? JSON.stringify(action.data) : '')}</textarea>
+            <label style="display: block; margin-top: 8px;">
+                <input type="checkbox" id="editActionConfirm" ${action.confirm ? 'checked' : ''} /> Ask for confirmation when opened in a browser
+            </label>
         </div>
-        <div style="margin-bottom: 10px; display: flex; gap: 10px;">
-            <button class="btn btn-secondary" onclick="selectAllShareEntities()" style="padding: 6px 12px; font-size: 13px;">Select All</button>
-            <button class="btn btn-secondary" onclick="deselectAllShareEntities()" style="padding: 6px 12px; font-size: 13px;">Deselect All</button>
+        ` : ''}
+        
+        <div class="form-group">
+            <label>Select Entities to Share:</label>
+            <div id="editShareEntitySelect" class="checkbox-group"></div>
         </div>
-        <div id="shareEntityList" class="checkbox-group" style="max-height: 300px; overflow-y: auto; border: 1px solid var(--border-color); border-radius: 6px; padding: 10px;">
-            ${sortedEntities.map(entity => `
-                <div class="checkbox-item" data-entity-id="${escapeHtml(entity.entity_id || entity.id)}">
-                    <label>
-                        <input type="checkbox" value="${escapeHtml(entity.entity_id || entity.id)}">
-                        ${escapeHtml(entity.entity_id || entity.id)}
-                        <span style="color: #999; font-size: 12px; margin-left: 8px;">(${escapeHtml(entity.state || 'unknown')})</span>
-                    </label>
+        
+        <div class="form-group">
+            <label>Or Match Entities by Pattern (comma-separated):</label>
+            <input type="text" id="editSharePatterns" value="${escapeHtml((share.selectors || []).filter(s => s.pattern).map(s => s.pattern).join(', '))}" placeholder="e.g. light.garden_*, switch.*" />
+        </div>
+        
+        <div class="form-group">
+            <label>Link Type:</label>
+            <select id="editShareType">
+                <option value="permanent" ${share.type === 'permanent' ? 'selected' : ''}>Permanent</option>
+                <option value="counter" ${share.type === 'counter' ? 'selected' : ''}>Counter-Limited</option>
+                <option value="time" ${share.type === 'time' ? 'selected' : ''}>Time-Limited</option>
+                <option value="kiosk" ${share.type === 'kiosk' ? 'selected' : ''}>Kiosk (wall tablet)</option>
+            </select>
+        </div>
+        
+        <div class="form-group">
+            <label>Default Access Mode:</label>
+            <select id="editAccessMode">
+                <option value="readonly" ${share.access_mode === 'readonly' ? 'selected' : ''}>Read-Only</option>
+                <option value="triggerable" ${share.access_mode === 'triggerable' ? 'selected' : ''}>Triggerable</option>
+            </select>
+        </div>
+        
+        <div id="editShareOptions"></div>
+        
+        <div class="form-group">
+            <label>Page Title:</label>
+            <input type="text" id="editShareTitle" maxlength="120" value="${escapeHtml(share.title || '')}" placeholder="e.g. Welcome to the Lake House" />
+        </div>
+        
+        <div class="form-group">
+            <label>Guest Instructions (Markdown):</label>
+            <textarea id="editShareInstructions" rows="5">${escapeHtml(share.instructions || '')}</textarea>
+        </div>
+        
+        <div class="form-group">
+            <label>Hidden Attributes (comma-separated):</label>
+            <input type="text" id="editAttributeDeny" value="${escapeHtml((filter.deny || []).join(', '))}" placeholder="e.g. ip_address, battery_level" />
+        </div>
+        
+        <div class="form-group">
+            <label>Location Precision (km, 0 hides coordinates):</label>
+            <input type="number" id="editLocationPrecision" min="0" step="0.5" value="${filter.location_precision_km || 0}" />
+        </div>
+        
+        <div class="form-group">
+            <label>Allowed Networks (IPs/CIDRs, comma-separated, empty allows all):</label>
+            <input type="text" id="editIPAllow" value="${escapeHtml((ipRestriction.allow || []).join(', '))}" placeholder="e.g. 192.168.1.0/24" />
+        </div>
+        
+        <div class="form-group">
+            <label>Blocked Networks (IPs/CIDRs, comma-separated):</label>
+            <input type="text" id="editIPDeny" value="${escapeHtml((ipRestriction.deny || []).join(', '))}" placeholder="e.g. 192.168.1.66" />
+        </div>
+        
+        <div class="form-group">
+            <label>
+                <input type="checkbox" id="editRequireApproval" ${share.require_approval ? 'checked' : ''} />
+                Visitors must request access and wait for my approval
+            </label>
+        </div>
+        
+        <div class="form-group">
+            <label>Only work on the first devices that open the link (0 = any device):</label>
+            <input type="number" id="editMaxDevices" min="0" max="20" value="${share.max_devices || 0}" />
+            <div id="editShareDevices"></div>
+        </div>
+        
+        <div class="form-group">
+            <label>Only active while (one Home Assistant condition per line, e.g. input_boolean.guest_mode = on):</label>
+            <textarea id="editShareConditions" rows="3" placeholder="e.g. alarm_control_panel.home = disarmed">${escapeHtml((share.conditions || []).map(formatCondition).join('\n'))}</textarea>
+        </div>
+        
+        <div class="form-group">
+            <label>Only available during (one time window per line, e.g. mon-fri 08:00-18:00):</label>
+            <textarea id="editShareSchedule" rows="2" placeholder="e.g. sat,sun 10:00-14:00">${escapeHtml(formatSchedule(share.schedule))}</textarea>
+        </div>
+        
+        <div class="form-group">
+            <label>
+                <input type="checkbox" id="editGeofenceEnabled" ${geofence.enabled ? 'checked' : ''} />
+                Only allow control near a location (geofence)
+            </label>
+        </div>
+        
+        <div id="editGeofenceOptions" style="display: ${geofence.enabled ? 'block' : 'none'};">
+            <div class="form-group">
+                <label>Zone (leave empty to use coordinates):</label>
+                <input type="text" id="editGeofenceZone" value="${escapeHtml(geofence.zone || '')}" placeholder="zone.home" />
+            </div>
+            <div class="form-group">
+                <label>Latitude / Longitude:</label>
+                <input type="number" id="editGeofenceLatitude" step="any" value="${geofence.latitude || ''}" />
+                <input type="number" id="editGeofenceLongitude" step="any" value="${geofence.longitude || ''}" />
+            </div>
+            <div class="form-group">
+                <label>Radius (m, 0 uses the zone's radius):</label>
+                <input type="number" id="editGeofenceRadius" min="0" value="${geofence.radius || 0}" />
+            </div>
+            <div class="form-group">
+                <label>Maximum Location Accuracy (m):</label>
+                <input type="number" id="editGeofenceMaxAccuracy" min="0" value="${geofence.max_accuracy || 100}" />
+            </div>
+        </div>
+        
+        <div class="form-group">
+            <label>
+                <input type="checkbox" id="editEmbedEnabled" ${embed.enabled ? 'checked' : ''} />
+                Allow embedding as a read-only widget in other sites
+            </label>
+        </div>
+        
+        <div id="editEmbedOptions" style="display: ${embed.enabled ? 'block' : 'none'};">
+            <div class="form-group">
+                <label>Widget Theme:</label>
+                <select id="editEmbedTheme">
+                    <option value="auto" ${!embed.theme || embed.theme === 'auto' ? 'selected' : ''}>Auto (follows the visitor's system)</option>
+                    <option value="light" ${embed.theme === 'light' ? 'selected' : ''}>Light</option>
+                    <option value="dark" ${embed.theme === 'dark' ? 'selected' : ''}>Dark</option>
+                </select>
+            </div>
+            <div class="form-group">
+                <label>Sites allowed to embed (origins, comma-separated):</label>
+                <input type="text" id="editEmbedAncestors" value="${escapeHtml((embed.frame_ancestors || []).join(', '))}" placeholder="e.g. https://wiki.example.com, https://*.grafana.net" />
+            </div>
+            <div class="form-group">
+                <label>Embed Code:</label>
+                <input type="text" readonly value="${escapeHtml(`<iframe src="${window.location.origin}/embed/${shareId}" width="400" height="300" style="border:0"></iframe>`)}" onclick="this.select()" />
+            </div>
+        </div>
+        
+        <button class="btn btn-primary" onclick="saveShareLink('${shareId}')">Save Changes</button>
+        <button class="btn btn-secondary" onclick="document.getElementById('editShareModal').style.display='none'">Cancel</button>
+    `;
+    
+    // Populate entities with their per-entity access mode
+    const entryMap = {};
+    (share.entries || []).forEach(entry => entryMap[entry.entity_id] = entry);
+    const entityContainer = document.getElementById('editShareEntitySelect');
+    entityContainer.innerHTML = trackedEntities.map(entity => {
+        const entry = entryMap[entity.entity_id];
+        const mode = entry ? entry.access_mode : share.access_mode;
+        const display = (entry && entry.display) || {};
+        return `
+            <div class="checkbox-item" data-entity-id="${escapeHtml(entity.entity_id)}">
+                <div style="display: flex; align-items: center; justify-content: space-between; gap: 10px;">
+                    <label>
+                        <input type="checkbox" value="${escapeHtml(entity.entity_id)}" ${entry ? 'checked' : ''}>
+                        ${escapeHtml(entity.entity_id)}
+                    </label>
+                    <select class="entry-access-mode" style="width: auto; padding: 4px 8px;">
+                        <option value="readonly" ${mode !== 'triggerable' ? 'selected' : ''}>Read-Only</option>
+                        <option value="triggerable" ${mode === 'triggerable' ? 'selected' : ''}>Triggerable</option>
+                    </select>
+                </div>
+                <div style="display: flex; gap: 6px; margin: 6px 0 0 24px;">
+                    <input type="text" class="entry-icon" maxlength="8" placeholder="Icon" value="${escapeHtml(display.icon || '')}" style="width: 60px; padding: 4px 8px;">
+                    <input type="text" class="entry-label" maxlength="64" placeholder="Label" value="${escapeHtml(display.label || '')}" style="flex: 2; padding: 4px 8px;">
+                    <input type="text" class="entry-section" maxlength="64" placeholder="Section" value="${escapeHtml(display.section || '')}" style="flex: 1; padding: 4px 8px;">
+                    <input type="number" class="entry-order" placeholder="Order" value="${display.order || 0}" style="width: 70px; padding: 4px 8px;">
+                </div>
+                <label style="display: block; margin: 6px 0 0 24px; font-size: 0.9em;">
+                    <input type="checkbox" class="entry-requires-approval" ${entry && entry.requires_approval ? 'checked' : ''}>
+                    Triggers need my approval
+                </label>
+                <label style="display: block; margin: 6px 0 0 24px; font-size: 0.9em;">
+                    Switch back automatically after
+                    <input type="number" class="entry-auto-revert" min="0" max="1440" value="${(entry && entry.auto_revert_minutes) || 0}" style="width: 80px; padding: 4px 8px;">
+                    minutes (0 = never)
+                </label>
+                <div style="margin: 6px 0 0 24px; font-size: 0.9em;">
+                    <label>Afterwards, also run (one step per line):</label>
+                    <textarea class="entry-chain" rows="2" placeholder="light.turn_on light.hallway {&quot;brightness&quot;: 255}&#10;delay 30&#10;try event guest_arrived" style="width: 100%; padding: 4px 8px; font-family: monospace;">${escapeHtml(formatChain(entry && entry.chain))}</textarea>
+                    <button type="button" class="btn btn-secondary" onclick="previewChain(this)" style="padding: 4px 10px; font-size: 12px;">Preview</button>
+                    <div class="entry-chain-preview"></div>
+                </div>
+            </div>
+        `;
+    }).join('');
+    
+    // Changing the default access mode applies it to every entity
+    document.getElementById('editAccessMode').addEventListener('change', function() {
+        document.querySelectorAll('#editShareEntitySelect .entry-access-mode').forEach(select => select.value = this.value);
+    });
+    
+    document.getElementById('editGeofenceEnabled').addEventListener('change', function() {
+        document.getElementById('editGeofenceOptions').style.display = this.checked ? 'block' : 'none';
+    });
+    
+    document.getElementById('editEmbedEnabled').addEventListener('change', function() {
+        document.getElementById('editEmbedOptions').style.display = this.checked ? 'block' : 'none';
+    });
+    
+    // Setup type change handler
+    document.getElementById('editShareType').addEventListener('change', updateEditShareOptions);
+    updateEditShareOptions();
+    
+    document.getElementById('editShareModal').style.display = 'block';
+    loadShareDevices(shareId);
+}
+
+// List the devices bound to a share link in the edit dialog
+async function loadShareDevices(shareId) {
+    const container = document.getElementById('editShareDevices');
+    if (!container) return;
+    
+    try {
+        const response = await fetch(`${API_BASE}/shares/${shareId}/devices`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load devices');
+        
+        const result = await response.json();
+        const devices = result.devices.filter(device => !device.revoked_at);
+        if (devices.length === 0) {
+            container.innerHTML = '';
+            return;
+        }
+        
+        container.innerHTML = `<div style="margin-top: 8px;">Bound devices:</div>` + devices.map(device => `
+            <div class="checkbox-item" style="display: flex; align-items: center; justify-content: space-between; gap: 10px;">
+                <span title="${escapeHtml(device.user_agent)}">${device.online ? '🟢' : '⚪'} ${escapeHtml(device.client_ip)} - last seen ${new Date(device.last_seen_at).toLocaleString()}</span>
+                <button class="btn btn-danger" onclick="revokeShareDevice('${shareId}', '${device.id}')" style="padding: 4px 10px; font-size: 12px;">Revoke</button>
+            </div>
+        `).join('');
+    } catch (error) {
+        console.error('Error loading devices:', error);
+        container.innerHTML = '';
+    }
+}
+
+async function revokeShareDevice(shareId, deviceId) {
+    const confirmed = await Dialog.confirm('Revoke this device? It can no longer open the share link.', 'Revoke Device');
+    if (!confirmed) return;
+    
+    try {
+        const response = await fetch(`${API_BASE}/shares/${shareId}/devices/${deviceId}`, {
+            method: 'DELETE',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to revoke device');
+        }
+        
+        showSuccess('Device revoked');
+        await loadShareDevices(shareId);
+    } catch (error) {
+        console.error('Error revoking device:', error);
+        showError('Failed to revoke device: ' + error.message);
+    }
+}
+
+function updateEditShareOptions() {
+    const type = document.getElementById('editShareType').value;
+    const container = document.getElementById('editShareOptions');
+    
+    if (type === 'counter') {
+        container.innerHTML = `
+            <div class="form-group">
+                <label>Max Access Count:</label>
+                <input type="number" id="editMaxAccess" min="1" value="10" />
+            </div>
+        `;
+    } else if (type === 'time') {
+        container.innerHTML = `
+            <div class="form-group">
+                <label>Expires At:</label>
+                <input type="datetime-local" id="editExpiresAt" />
+            </div>
+        `;
+    } else {
+        container.innerHTML = '';
+    }
+}
+
+async function saveShareLink(shareId) {
+    const type = document.getElementById('editShareType').value;
+    const accessMode = document.getElementById('editAccessMode').value;
+    
+    // Get selected entities, keeping existing per-entity settings
+    const share = shareLinks.find(s => s.id === shareId) || {};
+    const existingEntries = {};
+    (share.entries || []).forEach(entry => existingEntries[entry.entity_id] = entry);
+    
+    const items = document.querySelectorAll('#editShareEntitySelect .checkbox-item');
+    let entries;
+    try {
+        entries = Array.from(items)
+            .filter(item => item.querySelector('input[type="checkbox"]').checked)
+            .map(item => {
+                const entityId = item.getAttribute('data-entity-id');
+                const existing = existingEntries[entityId] || { entity_id: entityId };
+                return Object.assign({}, existing, {
+                    access_mode: item.querySelector('.entry-access-mode').value,
+                    requires_approval: item.querySelector('.entry-requires-approval').checked,
+                    auto_revert_minutes: parseInt(item.querySelector('.entry-auto-revert').value) || 0,
+                    chain: parseChain(item.querySelector('.entry-chain').value, entityId),
+                    display: Object.assign({}, existing.display || {}, {
+                        icon: item.querySelector('.entry-icon').value.trim(),
+                        label: item.querySelector('.entry-label').value.trim(),
+                        section: item.querySelector('.entry-section').value.trim(),
+                        order: parseInt(item.querySelector('.entry-order').value) || 0
+                    })
+                });
+            });
+    } catch (error) {
+        showError(error.message);
+        return;
+    }
+    
+    // Keep the settings of unchanged patterns and of selectors without a pattern
+    const existingSelectors = {};
+    (share.selectors || []).filter(s => s.pattern).forEach(s => existingSelectors[s.pattern] = s);
+    const selectors = (share.selectors || []).filter(s => !s.pattern).concat(
+        parsePatterns(document.getElementById('editSharePatterns').value)
+            .map(pattern => existingSelectors[pattern] || { pattern: pattern, access_mode: accessMode })
+    );
+    
+    if (entries.length === 0 && selectors.length === 0) {
+        showError('Please select at least one entity or enter a pattern');
+        return;
+    }
+    
+    let conditions, schedule, action;
+    try {
+        conditions = parseConditions(document.getElementById('editShareConditions').value, share.conditions || []);
+        schedule = parseSchedule(document.getElementById('editShareSchedule').value);
+        if (share.action && share.action.entity_id) {
+            action = readActionFields(share.action.entity_id, 'editAction');
+        }
+    } catch (error) {
+        showError(error.message);
+        return;
+    }
+    
+    const data = {
+        entries: entries,
+        selectors: selectors,
+        type: type,
+        access_mode: accessMode,
+        title: document.getElementById('editShareTitle').value.trim(),
+        instructions: document.getElementById('editShareInstructions').value.trim(),
+        attribute_filter: Object.assign({}, share.attribute_filter || {}, {
+            deny: document.getElementById('editAttributeDeny').value.split(',').map(a => a.trim()).filter(a => a),
+            location_precision_km: parseFloat(document.getElementById('editLocationPrecision').value) || 0
+        }),
+        ip_restriction: {
+            allow: document.getElementById('editIPAllow').value.split(',').map(a => a.trim()).filter(a => a),
+            deny: document.getElementById('editIPDeny').value.split(',').map(a => a.trim()).filter(a => a)
+        },
+        require_approval: document.getElementById('editRequireApproval').checked,
+        max_devices: parseInt(document.getElementById('editMaxDevices').value) || 0,
+        conditions: conditions,
+        schedule: schedule,
+        action: action,
+        geofence: {
+            enabled: document.getElementById('editGeofenceEnabled').checked,
+            zone: document.getElementById('editGeofenceZone').value.trim(),
+            latitude: parseFloat(document.getElementById('editGeofenceLatitude').value) || 0,
+            longitude: parseFloat(document.getElementById('editGeofenceLongitude').value) || 0,
+            radius: parseFloat(document.getElementById('editGeofenceRadius').value) || 0,
+            max_accuracy: parseFloat(document.getElementById('editGeofenceMaxAccuracy').value) || 0
+        },
+        embed: {
+            enabled: document.getElementById('editEmbedEnabled').checked,
+            theme: document.getElementById('editEmbedTheme').value,
+            frame_ancestors: document.getElementById('editEmbedAncestors').value.split(',').map(a => a.trim()).filter(a => a)
+        }
+    };
+    
+    if (type === 'counter') {
+        const maxAccess = parseInt(document.getElementById('editMaxAccess').value);
+        if (maxAccess < 1) {
+            showError('Max access must be at least 1');
+            return;
+        }
+        data.max_access = maxAccess;
+    } else if (type === 'time') {
+        const expiresAt = document.getElementById('editExpiresAt').value;
+        if (!expiresAt) {
+            showError('Please select an expiration date');
+            return;
+        }
+        data.expires_at = new Date(expiresAt).toISOString();
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE}/shares/${shareId}`, {
+            method: 'PUT',
+            headers: getAuthHeaders(),
+            body: JSON.stringify(data)
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to update share link');
+        }
+        
+        showSuccess('Share link updated successfully');
+        document.getElementById('editShareModal').style.display = 'none';
+        await loadShareLinks();
+    } catch (error) {
+        console.error('Error updating share link:', error);
+        showError('Failed to update share link: ' + error.message);
+    }
+}
+
+function updateShareEntitySelect() {
+    const container = document.getElementById('shareEntitySelect');
+    
+    if (!trackedEntities || trackedEntities.length === 0) {
+        container.innerHTML = '<div class="empty-state">No entities available. Add entities first.</div>';
+        return;
+    }
+    
+    // Sort entities: first alphabetically by entity_id, then by state
+    const sortedEntities = sortEntitiesByIdAndState(trackedEntities);
+    
+    container.innerHTML = `
+        <div class="search-box" style="margin-bottom: 10px;">
+            <input type="text" id="shareEntitySearch" placeholder="Search entities..." 
+                   oninput="filterShareEntities()" style="width: 100%; padding: 8px; border: 1px solid var(--border-color); border-radius: 6px;">
+        </div>
+        <div style="margin-bottom: 10px; display: flex; gap: 10px;">
+            <button class="btn btn-secondary" onclick="selectAllShareEntities()" style="padding: 6px 12px; font-size: 13px;">Select All</button>
+            <button class="btn btn-secondary" onclick="deselectAllShareEntities()" style="padding: 6px 12px; font-size: 13px;">Deselect All</button>
+        </div>
+        <div id="shareEntityList" class="checkbox-group" style="max-height: 300px; overflow-y: auto; border: 1px solid var(--border-color); border-radius: 6px; padding: 10px;">
+            ${sortedEntities.map(entity => `
+                <div class="checkbox-item" data-entity-id="${escapeHtml(entity.entity_id || entity.id)}">
+                    <label>
+                        <input type="checkbox" value="${escapeHtml(entity.entity_id || entity.id)}">
+                        ${escapeHtml(entity.entity_id || entity.id)}
+                        <span style="color: #999; font-size: 12px; margin-left: 8px;">(${escapeHtml(entity.state || 'unknown')})</span>
+                    </label>
+                </div>
+            `).join('')}
+        </div>
+    `;
+}
+
+function filterShareEntities() {
+    const searchTerm = document.getElementById('shareEntitySearch').value.toLowerCase();
+    const items = document.querySelectorAll('#shareEntityList .checkbox-item');
+    
+    items.forEach(item => {
+        const entityId = item.getAttribute('data-entity-id').toLowerCase();
+        if (entityId.includes(searchTerm)) {
+            item.style.display = '';
+        } else {
+            item.style.display = 'none';
+        }
+    });
+}
+
+function selectAllShareEntities() {
+    const checkboxes = document.querySelectorAll('#shareEntityList .checkbox-item:not([style*="display: none"]) input[type="checkbox"]');
+    checkboxes.forEach(cb => cb.checked = true);
+}
+
+function deselectAllShareEntities() {
+    const checkboxes = document.querySelectorAll('#shareEntityList input[type="checkbox"]');
+    checkboxes.forEach(cb => cb.checked = false);
+}
+
+function handleShareTypeChange() {
+    const type = document.getElementById('shareType').value;
+    const maxAccessGroup = document.getElementById('maxAccessGroup');
+    const expiresAtGroup = document.getElementById('expiresAtGroup');
+    const targetUserGroup = document.getElementById('targetUserGroup');
+    
+    maxAccessGroup.style.display = type === 'counter' ? 'block' : 'none';
+    expiresAtGroup.style.display = type === 'time' ? 'block' : 'none';
+    targetUserGroup.style.display = type === 'user' ? 'block' : 'none';
+    document.getElementById('instructionsGroup').style.display = type === 'user' ? 'none' : 'block';
+    document.getElementById('actionGroup').style.display = type === 'user' || type === 'kiosk' ? 'none' : 'block';
+}
+
+// Auto-refresh
+function startAutoRefresh() {
+    setInterval(async () => {
+        await loadEntities();
+        await loadAccessRequests();
+        await loadActionRequests();
+        await loadRevertJobs();
+        refreshKioskStatuses();
+    }, 30000); // Refresh every 30 seconds
+}
+
+function copyToClipboard(text) {
+    navigator.clipboard.writeText(text).then(() => {
+        showSuccess('Link copied to clipboard');
+    }).catch(err => {
+        showError('Failed to copy link');
+    });
+}
+
+function showError(message) {
+    const container = document.querySelector('.main-content');
+    const errorDiv = document.createElement('div');
+    errorDiv.className = 'error-message';
+    errorDiv.textContent = message;
+    container.insertBefore(errorDiv, container.firstChild);
+    
+    setTimeout(() => errorDiv.remove(), 5000);
+}
+
+function showSuccess(message) {
+    const container = document.querySelector('.main-content');
+    const successDiv = document.createElement('div');
+    successDiv.className = 'success-message';
+    successDiv.textContent = message;
+    container.insertBefore(successDiv, container.firstChild);
+    
+    setTimeout(() => successDiv.remove(), 3000);
+}
+
+// Admin functions
+async function checkAdminStatus() {
+    isAdmin = localStorage.getItem('is_admin') === 'true';
+    if (isAdmin) {
+        const adminMenuBtn = document.getElementById('adminMenuBtn');
+        if (adminMenuBtn) {
+            adminMenuBtn.style.display = 'inline-block';
+        }
+    }
+}
+
+function loadAdminPanel() {
+    const adminPanel = document.getElementById('adminPanel');
+    if (!adminPanel) return;
+    
+    adminPanel.innerHTML = `
+        <div class="section-header">
+            <h2>👨‍💼 Admin Panel</h2>
+            <div class="section-actions">
+                <button class="btn btn-primary" onclick="showCreateUserModal()">
+                    <span style="margin-right: 5px;">➕</span> Create New User
+                </button>
+            </div>
+        </div>
+        
+        <div class="admin-section">
+            <h3>User Management</h3>
+            <div id="usersList"></div>
+        </div>
+    `;
+    
+    loadAllUsers();
+}
+
+function showAdminPanel() {
+    // Legacy function - kept for compatibility
+    loadAdminPanel();
+}
+
+async function loadAllUsers() {
+    try {
+        // Use the public user list endpoint for dropdown population
+        const response = await fetch(`${API_BASE}/users/list`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            console.error('Failed to load user list');
+            return;
+        }
+        
+        const users = await response.json();
+        allUsers = users;
+        populateUserDropdown(users);
+        
+        // If admin, also load full user details for admin panel
+        if (isAdmin) {
+            await loadAdminUsers();
+        }
+    } catch (error) {
+        console.error('Error loading users:', error);
+    }
+}
+
+async function loadAdminUsers() {
+    try {
+        const response = await fetch(`${API_BASE}/users`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401 || response.status === 403) {
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load users');
+        
+        const users = await response.json();
+        allUsers = users; // Keep state consistent
+        renderUsersList(users);
+    } catch (error) {
+        console.error('Error loading admin users:', error);
+    }
+}
+
+function populateUserDropdown(users) {
+    const dropdown = document.getElementById('targetUser');
+    if (!dropdown) return;
+    
+    const currentUsername = localStorage.getItem('username');
+    const selected = dropdown.value;
+    // Users can share with their own groups and with admin-managed ones
+    const shareableGroups = groups.filter(group => group.admin_managed || group.can_manage);
+    dropdown.innerHTML = '<option value="">Select a user or group...</option>' + 
+        users
+            .filter(user => user.username !== currentUsername)
+            .map(user => `<option value="${user.id}">${escapeHtml(user.username)}</option>`)
+            .join('') +
+        (shareableGroups.length > 0 ? `
+            <optgroup label="Groups">
+                ${shareableGroups.map(group => `<option value="group:${group.id}">👥 ${escapeHtml(group.name)}</option>`).join('')}
+            </optgroup>
+        ` : '');
+    dropdown.value = selected;
+}
+
+function renderUsersList(users) {
+    const container = document.getElementById('usersList');
+    if (!container) return;
+    
+    container.innerHTML = `
+        <table class="modern-table">
+            <thead>
+                <tr>
+                    <th>Username</th>
+                    <th>Admin Status</th>
+                    <th>Created Date</th>
+                    <th>Actions</th>
+                </tr>
+            </thead>
+            <tbody>
+                ${users.map(user => `
+                    <tr>
+                        <td>
+                            <span style="font-weight: 600;">${escapeHtml(user.username)}</span>
+                        </td>
+                        <td>
+                            <label class="switch">
+                                <input type="checkbox" ${user.is_admin ? 'checked' : ''} onchange="toggleUserAdmin(${user.id}, this.checked)">
+                                <span class="slider round"></span>
+                            </label>
+                        </td>
+                        <td>${new Date(user.created_at).toLocaleDateString()}</td>
+                        <td>
+                            <div class="table-actions">
+                                <button class="btn btn-danger" onclick="deleteUser(${user.id})" ${user.is_admin ? 'disabled' : ''}>
+                                    🗑️ Delete
+                                </button>
+                            </div>
+                        </td>
+                    </tr>
+                `).join('')}
+            </tbody>
+        </table>
+    `;
+}
+
+function showCreateUserModal() {
+    const modal = document.createElement('div');
+    modal.className = 'modal';
+    modal.style.display = 'block';
+    modal.innerHTML = `
+        <div class="modal-content">
+            <span class="close" onclick="this.parentElement.parentElement.remove()">&times;</span>
+            <h2>Create New User</h2>
+            <div class="form-group">
+                <label>Username:</label>
+                <input type="text" id="newUsername" placeholder="Enter username" />
+            </div>
+            <button class="btn btn-primary" onclick="createNewUser()">Create User</button>
+            <div id="createUserResult"></div>
+        </div>
+    `;
+    document.body.appendChild(modal);
+}
+
+async function createNewUser() {
+    const username = document.getElementById('newUsername').value.trim();
+    if (!username) {
+        showError('Username is required');
+        return;
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE}/users`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ username })
+        });
+        
+        if (response.status === 401 || response.status === 403) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to create user');
+        }
+        
+        const data = await response.json();
+        
+        const resultDiv = document.getElementById('createUserResult');
+        resultDiv.innerHTML = `
+            <div class="success-message" style="margin-top: 20px;">
+                <strong>User created successfully!</strong><br><br>
+                <strong>Username:</strong> ${escapeHtml(data.user.username)}<br>
+                <strong>Generated Password:</strong><br>
+                <div style="background: #f5f5f5; padding: 10px; margin: 10px 0; font-family: monospace; word-break: break-all;">
+                    ${escapeHtml(data.generated_password)}
+                </div>
+                <strong>⚠️ Save this password! It cannot be recovered.</strong>
+            </div>
+        `;
+        
+        await loadAllUsers();
+    } catch (error) {
+        console.error('Error creating user:', error);
+        showError('Failed to create user: ' + error.message);
+    }
+}
+
+async function deleteUser(userId) {
+    const confirmed = await Dialog.confirm('Are you sure you want to delete this user? This will also delete all their entities and share links.', 'Delete User');
+    if (!confirmed) {
+        return;
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE}/users/${userId}`, {
+            method: 'DELETE',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401 || response.status === 403) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to delete user');
+        }
+        
+        showSuccess('User deleted successfully');
+        await loadAllUsers();
+    } catch (error) {
+        console.error('Error deleting user:', error);
+        showError('Failed to delete user: ' + error.message);
+    }
+}
+
+async function toggleUserAdmin(userId, isAdmin) {
+    try {
+        const response = await fetch(`${API_BASE}/users/${userId}/admin`, {
+            method: 'PUT',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ is_admin: isAdmin })
+        });
+        
+        if (response.status === 401 || response.status === 403) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to update admin status');
+        }
+        
+        showSuccess(`User admin status updated successfully`);
+        await loadAllUsers();
+    } catch (error) {
+        console.error('Error updating admin status:', error);
+        showError('Failed to update admin status: ' + error.message);
+        // Reload to revert the checkbox state
+        await loadAllUsers();
+    }
+}
+
+// Shared With Me functionality
+async function loadSharedWithMe() {
+    try {
+        const response = await fetch(`${API_BASE}/shared-with-me`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load shared entities');
+        
+        sharedWithMe = await response.json();
+        renderSharedWithMe();
+    } catch (error) {
+        console.error('Error loading shared entities:', error);
+        showError('Failed to load shared entities: ' + error.message);
+    }
+}
+
+async function renderSharedWithMe() {
+    const container = document.getElementById('sharedWithMeList');
+    
+    if (!sharedWithMe || sharedWithMe.length === 0) {
+        container.innerHTML = '<div class="empty-state">No entities have been shared with you yet.</div>';
+        return;
+    }
+    
+    // Sort entities: first alphabetically by EntityID, then by AccessMode
+    const sortedEntities = sortEntitiesByIdAndState(sharedWithMe, 'EntityID', 'AccessMode');
+    
+    // Group by owner
+    const groupedByOwner = {};
+    sortedEntities.forEach(item => {
+        const ownerName = item.Owner ? item.Owner.username : 'Unknown';
+        if (!groupedByOwner[ownerName]) {
+            groupedByOwner[ownerName] = [];
+        }
+        groupedByOwner[ownerName].push(item);
+    });
+    
+    container.innerHTML = Object.keys(groupedByOwner).map(ownerName => {
+        const entities = groupedByOwner[ownerName];
+        const entitiesHtml = entities.map(item => `
+            <div class="entity-item" id="shared-entity-container-${escapeHtml(item.EntityID).replace(/\./g, '-')}">
+                <div class="entity-info">
+                    <div class="entity-id">${escapeHtml(item.EntityID)}</div>
+                    <div class="entity-access" style="margin-top: 5px;">
+                        <span class="badge badge-${item.AccessMode === 'triggerable' ? 'success' : 'info'}">
+                            ${item.AccessMode === 'triggerable' ? '🎛️ Triggerable' : '👁️ Read-Only'}
+                        </span>
+                    </div>
+                    ${item.Group ? `<div class="entity-state">👥 Via group ${escapeHtml(item.Group.name)}</div>` : ''}
+                    ${describeShareAccess(item)}
+                    <div id="shared-entity-details-${escapeHtml(item.EntityID).replace(/\./g, '-')}">
+                        <div style="margin-top: 10px; color: #999;">Loading...</div>
+                    </div>
+                </div>
+                <button class="btn btn-secondary" onclick="leaveSharedEntity(${item.id}, ${!!(item.Selector && (item.Selector.pattern || (item.Selector.domains || []).length))})">
+                    Leave
+                </button>
+            </div>
+        `).join('');
+        
+        return `
+            <div class="shared-group">
+                <h3 class="shared-owner">📤 Shared from: ${escapeHtml(ownerName)}</h3>
+                ${entitiesHtml}
+            </div>
+        `;
+    }).join('');
+    
+    // Load entity states
+    sortedEntities.forEach(item => {
+        loadSharedEntityState(item.EntityID, item.AccessMode);
+    });
+}
+
+// Share invitations functionality
+async function loadShareInvitations() {
+    try {
+        const response = await fetch(`${API_BASE}/share-invitations`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load share invitations');
+        
+        renderShareInvitations(await response.json());
+    } catch (error) {
+        console.error('Error loading share invitations:', error);
+    }
+}
+
+function renderShareInvitations(invitations) {
+    const card = document.getElementById('shareInvitationsCard');
+    const container = document.getElementById('shareInvitationsList');
+    if (!card || !container) return;
+    
+    card.style.display = invitations.length > 0 ? 'block' : 'none';
+    container.innerHTML = invitations.map(item => `
+        <div class="entity-item">
+            <div class="entity-info">
+                <div class="entity-id">${escapeHtml(item.EntityID || describeSelector(item.Selector || {}))}</div>
+                <div class="entity-state">
+                    From ${escapeHtml(item.Owner ? item.Owner.username : 'Unknown')}
+                    <span class="badge badge-${item.AccessMode === 'triggerable' ? 'success' : 'info'}">
+                        ${item.AccessMode === 'triggerable' ? '🎛️ Triggerable' : '👁️ Read-Only'}
+                    </span>
                 </div>
-            `).join('')}
+                ${item.Group ? `<div class="entity-state">👥 Via group ${escapeHtml(item.Group.name)}</div>` : ''}
+                ${item.Message ? `<div class="entity-state">💬 ${escapeHtml(item.Message)}</div>` : ''}
+                ${describeShareAccess(item)}
+            </div>
+            <div>
+                <button class="btn btn-primary" onclick="respondToShareInvitation(${item.id}, 'accept')" style="margin-right: 5px;">Accept</button>
+                <button class="btn btn-secondary" onclick="respondToShareInvitation(${item.id}, 'decline')">Decline</button>
+            </div>
         </div>
-    `;
+    `).join('');
 }
 
-function filterShareEntities() {
-    const searchTerm = document.getElementById('shareEntitySearch').value.toLowerCase();
-    const items = document.querySelectorAll('#shareEntityList .checkbox-item');
+async function respondToShareInvitation(sharedEntityId, action) {
+    try {
+        const response = await fetch(`${API_BASE}/share-invitations/${sharedEntityId}/${action}`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to respond to invitation');
+        }
+        
+        showSuccess(action === 'accept' ? 'Invitation accepted' : 'Invitation declined');
+    } catch (error) {
+        console.error('Error responding to share invitation:', error);
+        showError('Failed to respond to invitation: ' + error.message);
+    }
+    await loadShareInvitations();
+    await loadSharedWithMe();
+}
+
+async function leaveSharedEntity(sharedEntityId, isSelector) {
+    const message = isSelector
+        ? 'Leave this share? You lose access to every entity matching its pattern until the owner invites you again.'
+        : 'Leave this share? You lose access to the entity until the owner invites you again.';
+    const confirmed = await Dialog.confirm(message, 'Leave Share');
+    if (!confirmed) return;
     
-    items.forEach(item => {
-        const entityId = item.getAttribute('data-entity-id').toLowerCase();
-        if (entityId.includes(searchTerm)) {
-            item.style.display = '';
-        } else {
-            item.style.display = 'none';
+    try {
+        const response = await fetch(`${API_BASE}/shared-with-me/${sharedEntityId}/leave`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
         }
-    });
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to leave share');
+        }
+        
+        showSuccess('You left the share');
+    } catch (error) {
+        console.error('Error leaving shared entity:', error);
+        showError('Failed to leave share: ' + error.message);
+    }
+    await loadSharedWithMe();
+    await loadReservations();
 }
 
-function selectAllShareEntities() {
-    const checkboxes = document.querySelectorAll('#shareEntityList .checkbox-item:not([style*="display: none"]) input[type="checkbox"]');
-    checkboxes.forEach(cb => cb.checked = true);
+// Describe whether the user accepted a user share, or how the members responded to a group share
+function describeShareStatus(item) {
+    const labels = {
+        pending: '⏳ Invitation pending',
+        declined: '✖️ Declined',
+        left: '🚪 Left by user'
+    };
+    if (item.Group) {
+        const members = item.Members || [];
+        const accepted = members.filter(member => member.status === 'accepted').length;
+        const others = members.filter(member => labels[member.status]).map(member =>
+            `${escapeHtml(member.user ? member.user.username : 'Unknown')}: ${labels[member.status]}`);
+        return `<div class="entity-state">${accepted} of ${members.length} members accepted${others.length ? ` (${others.join(', ')})` : ''}</div>`;
+    }
+    if (!labels[item.Status]) return '';
+    const since = item.RespondedAt ? ` (${new Date(item.RespondedAt).toLocaleString()})` : '';
+    return `<div class="entity-state"><span class="badge">${labels[item.Status]}</span>${since}</div>`;
 }
 
-function deselectAllShareEntities() {
-    const checkboxes = document.querySelectorAll('#shareEntityList input[type="checkbox"]');
-    checkboxes.forEach(cb => cb.checked = false);
+// Load the reservation calendar of the next days
+async function loadReservations() {
+    try {
+        const response = await fetch(`${API_BASE}/reservations`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load reservations');
+        
+        const result = await response.json();
+        reservations = result.reservations;
+        renderReservations();
+    } catch (error) {
+        console.error('Error loading reservations:', error);
+    }
 }
 
-function handleShareTypeChange() {
-    const type = document.getElementById('shareType').value;
-    const maxAccessGroup = document.getElementById('maxAccessGroup');
-    const expiresAtGroup = document.getElementById('expiresAtGroup');
-    const targetUserGroup = document.getElementById('targetUserGroup');
+function renderReservations() {
+    const container = document.getElementById('reservationsList');
+    if (!container) return;
     
-    maxAccessGroup.style.display = type === 'counter' ? 'block' : 'none';
-    expiresAtGroup.style.display = type === 'time' ? 'block' : 'none';
-    targetUserGroup.style.display = type === 'user' ? 'block' : 'none';
+    // Suggest the triggerable entities shared with the user
+    document.getElementById('reservationEntities').innerHTML = (sharedWithMe || [])
+        .filter(item => item.AccessMode === 'triggerable')
+        .map(item => `<option value="${escapeHtml(item.EntityID)}">`)
+        .join('');
+    
+    if (!reservations || reservations.length === 0) {
+        container.innerHTML = '<div class="empty-state">No reservations in the next 7 days.</div>';
+        return;
+    }
+    
+    const username = localStorage.getItem('username');
+    const now = new Date();
+    container.innerHTML = reservations.map(reservation => {
+        const startsAt = new Date(reservation.starts_at);
+        const endsAt = new Date(reservation.ends_at);
+        const mine = reservation.user && reservation.user.username === username;
+        const current = reservation.status === 'active' && startsAt <= now && endsAt > now;
+        const action = reservation.status !== 'active' ? '' : mine
+            ? `<button class="btn btn-secondary" onclick="releaseReservation('${reservation.id}')">Release</button>`
+            : `<button class="btn btn-danger" onclick="releaseReservation('${reservation.id}')">Cancel</button>`;
+        return `
+            <div class="share-item">
+                <div class="share-header">
+                    <div>
+                        <em>${escapeHtml(reservation.entity_id)}</em> - ${escapeHtml(reservation.user ? reservation.user.username : '')}
+                        ${current ? '<span class="badge badge-success">Now</span>' : ''}
+                        ${reservation.status === 'completed' ? '<span class="badge badge-info">Completed</span>' : ''}
+                    </div>
+                    ${action}
+                </div>
+                <div class="share-details">
+                    <div>${startsAt.toLocaleString()} - ${endsAt.toLocaleString()}</div>
+                    ${reservation.note ? `<div>${escapeHtml(reservation.note)}</div>` : ''}
+                </div>
+            </div>
+        `;
+    }).join('');
 }
 
-// Auto-refresh
-function startAutoRefresh() {
-    setInterval(async () => {
-        await loadEntities();
-    }, 30000); // Refresh every 30 seconds
+async function createReservation() {
+    const entityId = document.getElementById('reservationEntity').value.trim();
+    const start = document.getElementById('reservationStart').value;
+    const end = document.getElementById('reservationEnd').value;
+    
+    if (!entityId || !end) {
+        showError('Please enter an entity and the end of the reservation');
+        return;
+    }
+    
+    const body = {
+        entity_id: entityId,
+        ends_at: new Date(end).toISOString(),
+        note: document.getElementById('reservationNote').value.trim(),
+        override: document.getElementById('reservationOverride').checked
+    };
+    if (start) body.starts_at = new Date(start).toISOString();
+    
+    try {
+        const response = await fetch(`${API_BASE}/reservations`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify(body)
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        const result = await response.json();
+        if (response.status === 409 && result.conflicts) {
+            const taken = result.conflicts.map(r => `${r.user ? r.user.username : ''} (${new Date(r.starts_at).toLocaleString()} - ${new Date(r.ends_at).toLocaleTimeString()})`);
+            throw new Error(`${result.error}: ${taken.join(', ')}`);
+        }
+        if (!response.ok) {
+            throw new Error(result.error || 'Failed to create reservation');
+        }
+        
+        showSuccess(`${entityId} reserved`);
+        document.getElementById('reservationNote').value = '';
+        document.getElementById('reservationOverride').checked = false;
+    } catch (error) {
+        console.error('Error creating reservation:', error);
+        showError('Failed to reserve: ' + error.message);
+    }
+    await loadReservations();
 }
 
-function copyToClipboard(text) {
-    navigator.clipboard.writeText(text).then(() => {
-        showSuccess('Link copied to clipboard');
-    }).catch(err => {
-        showError('Failed to copy link');
-    });
+async function releaseReservation(reservationId) {
+    try {
+        const response = await fetch(`${API_BASE}/reservations/${reservationId}/release`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to release reservation');
+        }
+        
+        showSuccess('Reservation released');
+    } catch (error) {
+        console.error('Error releasing reservation:', error);
+        showError('Failed to release reservation: ' + error.message);
+    }
+    await loadReservations();
 }
 
-function showError(message) {
-    const container = document.querySelector('.main-content');
-    const errorDiv = document.createElement('div');
-    errorDiv.className = 'error-message';
-    errorDiv.textContent = message;
-    container.insertBefore(errorDiv, container.firstChild);
-    
-    setTimeout(() => errorDiv.remove(), 5000);
+async function loadWebhooks() {
+    try {
+        const response = await fetch(`${API_BASE}/webhooks`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load webhooks');
+        
+        webhooks = await response.json();
+        renderWebhooks();
+    } catch (error) {
+        console.error('Error loading webhooks:', error);
+    }
 }
 
-function showSuccess(message) {
-    const container = document.querySelector('.main-content');
-    const successDiv = document.createElement('div');
-    successDiv.className = 'success-message';
-    successDiv.textContent = message;
-    container.insertBefore(successDiv, container.firstChild);
+function renderWebhooks() {
+    const container = document.getElementById('webhooksList');
+    if (!container) return;
     
-    setTimeout(() => successDiv.remove(), 3000);
+    // Suggest the tracked entities
+    document.getElementById('webhookEntities').innerHTML = trackedEntities
+        .map(entity => `<option value="${escapeHtml(entity.entity_id)}">`)
+        .join('');
+    
+    if (!webhooks || webhooks.length === 0) {
+        container.innerHTML = '<div class="empty-state">No webhooks created yet</div>';
+        return;
+    }
+    
+    container.innerHTML = webhooks.map(webhook => {
+        const url = `${window.location.origin}/api/hooks/${webhook.id}`;
+        const hasData = webhook.data && Object.keys(webhook.data).length > 0;
+        return `
+            <div class="share-item">
+                <div class="share-header">
+                    <div>
+                        <strong>${escapeHtml(webhook.name || webhook.entity_id)}</strong>
+                        <span class="badge ${webhook.active ? 'badge-active' : 'badge-inactive'}">${webhook.active ? 'Active' : 'Disabled'}</span>
+                    </div>
+                    <div>
+                        <button class="btn btn-secondary" onclick="toggleWebhook('${webhook.id}', ${!webhook.active})" style="margin-right: 5px;">${webhook.active ? 'Disable' : 'Enable'}</button>
+                        <button class="btn btn-secondary" onclick="rotateWebhookSecret('${webhook.id}')" style="margin-right: 5px;">Rotate Secret</button>
+                        <button class="btn btn-danger" onclick="deleteWebhook('${webhook.id}')">Delete</button>
+                    </div>
+                </div>
+                <div class="share-details">
+                    <div>Calls ${escapeHtml(webhook.service)} on ${escapeHtml(webhook.entity_id)}</div>
+                    ${hasData ? `<div>Data: <code>${escapeHtml(JSON.stringify(webhook.data))}</code></div>` : ''}
+                    <div>Last used: ${webhook.last_used_at ? new Date(webhook.last_used_at).toLocaleString() : 'never'}</div>
+                </div>
+                <div class="share-link">${url}</div>
+                <button class="btn btn-copy" onclick="copyToClipboard('${url}')">Copy URL</button>
+            </div>
+        `;
+    }).join('');
 }
 
-// Admin functions
-async function checkAdminStatus() {
-    isAdmin = localStorage.getItem('is_admin') === 'true';
-    if (isAdmin) {
-        const adminMenuBtn = document.getElementById('adminMenuBtn');
-        if (adminMenuBtn) {
-            adminMenuBtn.style.display = 'inline-block';
+async function createWebhook() {
+    const entityId = document.getElementById('webhookEntity').value.trim();
+    const service = document.getElementById('webhookService').value.trim();
+    if (!entityId || !service) {
+        showError('Please enter the entity and service of the webhook');
+        return;
+    }
+    
+    const body = {
+        name: document.getElementById('webhookName').value.trim(),
+        entity_id: entityId,
+        service: service
+    };
+    const data = document.getElementById('webhookData').value.trim();
+    if (data) {
+        try {
+            body.data = JSON.parse(data);
+        } catch (error) {
+            showError('The service data must be a JSON object');
+            return;
+        }
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE}/webhooks`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify(body)
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        const result = await response.json();
+        if (!response.ok) {
+            throw new Error(result.error || 'Failed to create webhook');
         }
+        
+        showWebhookSecret(result.secret);
+        document.getElementById('webhookName').value = '';
+        document.getElementById('webhookData').value = '';
+        await loadWebhooks();
+    } catch (error) {
+        console.error('Error creating webhook:', error);
+        showError('Failed to create webhook: ' + error.message);
     }
 }
 
-function loadAdminPanel() {
-    const adminPanel = document.getElementById('adminPanel');
-    if (!adminPanel) return;
-    
-    adminPanel.innerHTML = `
-        <div class="section-header">
-            <h2>👨‍💼 Admin Panel</h2>
-            <div class="section-actions">
-                <button class="btn btn-primary" onclick="showCreateUserModal()">
-                    <span style="margin-right: 5px;">➕</span> Create New User
-                </button>
+// Show a signing secret once; it cannot be retrieved later
+function showWebhookSecret(secret) {
+    document.getElementById('webhookSecret').innerHTML = `
+        <div class="success-message" style="margin-top: 20px;">
+            <strong>Signing Secret:</strong><br>
+            <div style="background: #f5f5f5; padding: 10px; margin: 10px 0; font-family: monospace; word-break: break-all;">
+                ${escapeHtml(secret)}
             </div>
-        </div>
-        
-        <div class="admin-section">
-            <h3>User Management</h3>
-            <div id="usersList"></div>
+            Sign each request with <code>X-Hassh-Timestamp: &lt;unix seconds&gt;</code> and
+            <code>X-Hassh-Signature: sha256=&lt;hex HMAC-SHA256 of "timestamp.body"&gt;</code>.<br>
+            <strong>⚠️ Save this secret! It cannot be shown again.</strong>
         </div>
     `;
-    
-    loadAllUsers();
 }
 
-function showAdminPanel() {
-    // Legacy function - kept for compatibility
-    loadAdminPanel();
+async function toggleWebhook(webhookId, active) {
+    try {
+        const response = await fetch(`${API_BASE}/webhooks/${webhookId}`, {
+            method: 'PUT',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ active: active })
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to update webhook');
+        }
+        
+        showSuccess(active ? 'Webhook enabled' : 'Webhook disabled');
+    } catch (error) {
+        console.error('Error updating webhook:', error);
+        showError('Failed to update webhook: ' + error.message);
+    }
+    await loadWebhooks();
 }
 
-async function loadAllUsers() {
+async function rotateWebhookSecret(webhookId) {
+    const confirmed = await Dialog.confirm('Rotate the signing secret? Requests signed with the current secret will be refused.', 'Rotate Secret');
+    if (!confirmed) return;
+    
     try {
-        // Use the public user list endpoint for dropdown population
-        const response = await fetch(`${API_BASE}/users/list`, {
+        const response = await fetch(`${API_BASE}/webhooks/${webhookId}/rotate`, {
+            method: 'POST',
             headers: getAuthHeaders()
         });
         
@@ -883,224 +2686,225 @@ async function loadAllUsers() {
             return;
         }
         
+        const result = await response.json();
         if (!response.ok) {
-            console.error('Failed to load user list');
-            return;
+            throw new Error(result.error || 'Failed to rotate secret');
         }
         
-        const users = await response.json();
-        allUsers = users;
-        populateUserDropdown(users);
-        
-        // If admin, also load full user details for admin panel
-        if (isAdmin) {
-            await loadAdminUsers();
-        }
+        showWebhookSecret(result.secret);
     } catch (error) {
-        console.error('Error loading users:', error);
+        console.error('Error rotating webhook secret:', error);
+        showError('Failed to rotate secret: ' + error.message);
     }
 }
 
-async function loadAdminUsers() {
+async function deleteWebhook(webhookId) {
+    const confirmed = await Dialog.confirm('Delete this webhook? Requests to its URL will be refused.', 'Delete Webhook');
+    if (!confirmed) return;
+    
     try {
-        const response = await fetch(`${API_BASE}/users`, {
+        const response = await fetch(`${API_BASE}/webhooks/${webhookId}`, {
+            method: 'DELETE',
             headers: getAuthHeaders()
         });
         
-        if (response.status === 401 || response.status === 403) {
+        if (response.status === 401) {
+            logout();
             return;
         }
         
-        if (!response.ok) throw new Error('Failed to load users');
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to delete webhook');
+        }
         
-        const users = await response.json();
-        allUsers = users; // Keep state consistent
-        renderUsersList(users);
+        showSuccess('Webhook deleted');
     } catch (error) {
-        console.error('Error loading admin users:', error);
+        console.error('Error deleting webhook:', error);
+        showError('Failed to delete webhook: ' + error.message);
     }
+    await loadWebhooks();
 }
 
-function populateUserDropdown(users) {
-    const dropdown = document.getElementById('targetUser');
-    if (!dropdown) return;
-    
-    const currentUsername = localStorage.getItem('username');
-    dropdown.innerHTML = '<option value="">Select a user...</option>' + 
-        users
-            .filter(user => user.username !== currentUsername)
-            .map(user => `<option value="${user.id}">${escapeHtml(user.username)}</option>`)
-            .join('');
+async function loadWebhookSubscriptions() {
+    document.getElementById('subscriptionAllUsersGroup').style.display = isAdmin ? 'block' : 'none';
+    try {
+        const response = await fetch(`${API_BASE}/webhook-subscriptions`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load webhook subscriptions');
+        
+        webhookSubscriptions = await response.json();
+        renderWebhookSubscriptions();
+    } catch (error) {
+        console.error('Error loading webhook subscriptions:', error);
+    }
 }
 
-function renderUsersList(users) {
-    const container = document.getElementById('usersList');
+function renderWebhookSubscriptions() {
+    const container = document.getElementById('subscriptionsList');
     if (!container) return;
     
-    container.innerHTML = `
-        <table class="modern-table">
-            <thead>
-                <tr>
-                    <th>Username</th>
-                    <th>Admin Status</th>
-                    <th>Created Date</th>
-                    <th>Actions</th>
-                </tr>
-            </thead>
-            <tbody>
-                ${users.map(user => `
-                    <tr>
-                        <td>
-                            <span style="font-weight: 600;">${escapeHtml(user.username)}</span>
-                        </td>
-                        <td>
-                            <label class="switch">
-                                <input type="checkbox" ${user.is_admin ? 'checked' : ''} onchange="toggleUserAdmin(${user.id}, this.checked)">
-                                <span class="slider round"></span>
-                            </label>
-                        </td>
-                        <td>${new Date(user.created_at).toLocaleDateString()}</td>
-                        <td>
-                            <div class="table-actions">
-                                <button class="btn btn-danger" onclick="deleteUser(${user.id})" ${user.is_admin ? 'disabled' : ''}>
-                                    🗑️ Delete
-                                </button>
-                            </div>
-                        </td>
-                    </tr>
-                `).join('')}
-            </tbody>
-        </table>
-    `;
-}
-
-function showCreateUserModal() {
-    const modal = document.createElement('div');
-    modal.className = 'modal';
-    modal.style.display = 'block';
-    modal.innerHTML = `
-        <div class="modal-content">
-            <span class="close" onclick="this.parentElement.parentElement.remove()">&times;</span>
-            <h2>Create New User</h2>
-            <div class="form-group">
-                <label>Username:</label>
-                <input type="text" id="newUsername" placeholder="Enter username" />
+    if (!webhookSubscriptions || webhookSubscriptions.length === 0) {
+        container.innerHTML = '<div class="empty-state">No webhook subscriptions yet</div>';
+        return;
+    }
+    
+    container.innerHTML = webhookSubscriptions.map(subscription => {
+        const eventTypes = subscription.event_types && subscription.event_types.length > 0
+            ? subscription.event_types.join(', ')
+            : 'all events';
+        return `
+            <div class="share-item">
+                <div class="share-header">
+                    <div>
+                        <strong>${escapeHtml(subscription.name || subscription.url)}</strong>
+                        <span class="badge ${subscription.active ? 'badge-active' : 'badge-inactive'}">${subscription.active ? 'Active' : 'Disabled'}</span>
+                        ${subscription.all_users ? '<span class="badge">All users</span>' : ''}
+                    </div>
+                    <div>
+                        <button class="btn btn-secondary" onclick="toggleWebhookDeliveries('${subscription.id}')" style="margin-right: 5px;">Deliveries</button>
+                        <button class="btn btn-secondary" onclick="toggleWebhookSubscription('${subscription.id}', ${!subscription.active})" style="margin-right: 5px;">${subscription.active ? 'Disable' : 'Enable'}</button>
+                        <button class="btn btn-secondary" onclick="rotateWebhookSubscriptionSecret('${subscription.id}')" style="margin-right: 5px;">Rotate Secret</button>
+                        <button class="btn btn-danger" onclick="deleteWebhookSubscription('${subscription.id}')">Delete</button>
+                    </div>
+                </div>
+                <div class="share-details">
+                    <div>Posts ${escapeHtml(eventTypes)} to ${escapeHtml(subscription.url)}</div>
+                </div>
+                <div id="deliveries-${subscription.id}" style="display: none;"></div>
             </div>
-            <button class="btn btn-primary" onclick="createNewUser()">Create User</button>
-            <div id="createUserResult"></div>
-        </div>
-    `;
-    document.body.appendChild(modal);
+        `;
+    }).join('');
 }
 
-async function createNewUser() {
-    const username = document.getElementById('newUsername').value.trim();
-    if (!username) {
-        showError('Username is required');
+async function createWebhookSubscription() {
+    const url = document.getElementById('subscriptionURL').value.trim();
+    if (!url) {
+        showError('Please enter the URL to deliver events to');
         return;
     }
     
+    const eventTypes = document.getElementById('subscriptionEvents').value
+        .split(',')
+        .map(eventType => eventType.trim())
+        .filter(eventType => eventType);
+    
     try {
-        const response = await fetch(`${API_BASE}/users`, {
+        const response = await fetch(`${API_BASE}/webhook-subscriptions`, {
             method: 'POST',
             headers: getAuthHeaders(),
-            body: JSON.stringify({ username })
+            body: JSON.stringify({
+                name: document.getElementById('subscriptionName').value.trim(),
+                url: url,
+                event_types: eventTypes,
+                all_users: isAdmin && document.getElementById('subscriptionAllUsers').checked
+            })
         });
         
-        if (response.status === 401 || response.status === 403) {
+        if (response.status === 401) {
             logout();
             return;
         }
         
+        const result = await response.json();
         if (!response.ok) {
-            const error = await response.json();
-            throw new Error(error.error || 'Failed to create user');
+            throw new Error(result.error || 'Failed to create webhook subscription');
         }
         
-        const data = await response.json();
-        
-        const resultDiv = document.getElementById('createUserResult');
-        resultDiv.innerHTML = `
-            <div class="success-message" style="margin-top: 20px;">
-                <strong>User created successfully!</strong><br><br>
-                <strong>Username:</strong> ${escapeHtml(data.user.username)}<br>
-                <strong>Generated Password:</strong><br>
-                <div style="background: #f5f5f5; padding: 10px; margin: 10px 0; font-family: monospace; word-break: break-all;">
-                    ${escapeHtml(data.generated_password)}
-                </div>
-                <strong>⚠️ Save this password! It cannot be recovered.</strong>
-            </div>
-        `;
-        
-        await loadAllUsers();
+        showSubscriptionSecret(result.secret);
+        document.getElementById('subscriptionName').value = '';
+        document.getElementById('subscriptionURL').value = '';
+        document.getElementById('subscriptionEvents').value = '';
+        document.getElementById('subscriptionAllUsers').checked = false;
+        await loadWebhookSubscriptions();
     } catch (error) {
-        console.error('Error creating user:', error);
-        showError('Failed to create user: ' + error.message);
+        console.error('Error creating webhook subscription:', error);
+        showError('Failed to create webhook subscription: ' + error.message);
     }
 }
 
-async function deleteUser(userId) {
-    const confirmed = await Dialog.confirm('Are you sure you want to delete this user? This will also delete all their entities and share links.', 'Delete User');
-    if (!confirmed) {
-        return;
-    }
-    
+// Show a subscription's signing secret once; it cannot be retrieved later
+function showSubscriptionSecret(secret) {
+    document.getElementById('subscriptionSecret').innerHTML = `
+        <div class="success-message" style="margin-top: 20px;">
+            <strong>Signing Secret:</strong><br>
+            <div style="background: #f5f5f5; padding: 10px; margin: 10px 0; font-family: monospace; word-break: break-all;">
+                ${escapeHtml(secret)}
+            </div>
+            Each delivery carries <code>X-Hassh-Timestamp</code> and
+            <code>X-Hassh-Signature: sha256=&lt;hex HMAC-SHA256 of "timestamp.body"&gt;</code>; verify it before trusting the payload.<br>
+            <strong>⚠️ Save this secret! It cannot be shown again.</strong>
+        </div>
+    `;
+}
+
+async function toggleWebhookSubscription(subscriptionId, active) {
     try {
-        const response = await fetch(`${API_BASE}/users/${userId}`, {
-            method: 'DELETE',
-            headers: getAuthHeaders()
+        const response = await fetch(`${API_BASE}/webhook-subscriptions/${subscriptionId}`, {
+            method: 'PUT',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ active: active })
         });
         
-        if (response.status === 401 || response.status === 403) {
+        if (response.status === 401) {
             logout();
             return;
         }
         
         if (!response.ok) {
             const error = await response.json();
-            throw new Error(error.error || 'Failed to delete user');
+            throw new Error(error.error || 'Failed to update webhook subscription');
         }
         
-        showSuccess('User deleted successfully');
-        await loadAllUsers();
+        showSuccess(active ? 'Subscription enabled' : 'Subscription disabled');
     } catch (error) {
-        console.error('Error deleting user:', error);
-        showError('Failed to delete user: ' + error.message);
+        console.error('Error updating webhook subscription:', error);
+        showError('Failed to update webhook subscription: ' + error.message);
     }
+    await loadWebhookSubscriptions();
 }
 
-async function toggleUserAdmin(userId, isAdmin) {
+async function rotateWebhookSubscriptionSecret(subscriptionId) {
+    const confirmed = await Dialog.confirm('Rotate the signing secret? Deliveries will be signed with the new secret.', 'Rotate Secret');
+    if (!confirmed) return;
+    
     try {
-        const response = await fetch(`${API_BASE}/users/${userId}/admin`, {
-            method: 'PUT',
-            headers: getAuthHeaders(),
-            body: JSON.stringify({ is_admin: isAdmin })
+        const response = await fetch(`${API_BASE}/webhook-subscriptions/${subscriptionId}/rotate`, {
+            method: 'POST',
+            headers: getAuthHeaders()
         });
         
-        if (response.status === 401 || response.status === 403) {
+        if (response.status === 401) {
             logout();
             return;
         }
         
+        const result = await response.json();
         if (!response.ok) {
-            const error = await response.json();
-            throw new Error(error.error || 'Failed to update admin status');
+            throw new Error(result.error || 'Failed to rotate secret');
         }
         
-        showSuccess(`User admin status updated successfully`);
-        await loadAllUsers();
+        showSubscriptionSecret(result.secret);
     } catch (error) {
-        console.error('Error updating admin status:', error);
-        showError('Failed to update admin status: ' + error.message);
-        // Reload to revert the checkbox state
-        await loadAllUsers();
+        console.error('Error rotating webhook subscription secret:', error);
+        showError('Failed to rotate secret: ' + error.message);
     }
 }
 
-// Shared With Me functionality
-async function loadSharedWithMe() {
+async function deleteWebhookSubscription(subscriptionId) {
+    const confirmed = await Dialog.confirm('Delete this subscription and its delivery log?', 'Delete Subscription');
+    if (!confirmed) return;
+    
     try {
-        const response = await fetch(`${API_BASE}/shared-with-me`, {
+        const response = await fetch(`${API_BASE}/webhook-subscriptions/${subscriptionId}`, {
+            method: 'DELETE',
             headers: getAuthHeaders()
         });
         
@@ -1109,67 +2913,91 @@ async function loadSharedWithMe() {
             return;
         }
         
-        if (!response.ok) throw new Error('Failed to load shared entities');
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to delete webhook subscription');
+        }
         
-        sharedWithMe = await response.json();
-        renderSharedWithMe();
+        showSuccess('Subscription deleted');
     } catch (error) {
-        console.error('Error loading shared entities:', error);
-        showError('Failed to load shared entities: ' + error.message);
+        console.error('Error deleting webhook subscription:', error);
+        showError('Failed to delete webhook subscription: ' + error.message);
     }
+    await loadWebhookSubscriptions();
 }
 
-async function renderSharedWithMe() {
-    const container = document.getElementById('sharedWithMeList');
-    
-    if (!sharedWithMe || sharedWithMe.length === 0) {
-        container.innerHTML = '<div class="empty-state">No entities have been shared with you yet.</div>';
+async function toggleWebhookDeliveries(subscriptionId) {
+    const container = document.getElementById(`deliveries-${subscriptionId}`);
+    if (container.style.display === 'block') {
+        container.style.display = 'none';
         return;
     }
-    
-    // Sort entities: first alphabetically by EntityID, then by AccessMode
-    const sortedEntities = sortEntitiesByIdAndState(sharedWithMe, 'EntityID', 'AccessMode');
-    
-    // Group by owner
-    const groupedByOwner = {};
-    sortedEntities.forEach(item => {
-        const ownerName = item.Owner ? item.Owner.username : 'Unknown';
-        if (!groupedByOwner[ownerName]) {
-            groupedByOwner[ownerName] = [];
-        }
-        groupedByOwner[ownerName].push(item);
-    });
-    
-    container.innerHTML = Object.keys(groupedByOwner).map(ownerName => {
-        const entities = groupedByOwner[ownerName];
-        const entitiesHtml = entities.map(item => `
-            <div class="entity-item" id="shared-entity-container-${escapeHtml(item.EntityID).replace(/\./g, '-')}">
-                <div class="entity-info">
-                    <div class="entity-id">${escapeHtml(item.EntityID)}</div>
-                    <div class="entity-access" style="margin-top: 5px;">
-                        <span class="badge badge-${item.AccessMode === 'triggerable' ? 'success' : 'info'}">
-                            ${item.AccessMode === 'triggerable' ? '🎛️ Triggerable' : '👁️ Read-Only'}
-                        </span>
-                    </div>
-                    <div id="shared-entity-details-${escapeHtml(item.EntityID).replace(/\./g, '-')}">
-                        <div style="margin-top: 10px; color: #999;">Loading...</div>
-                    </div>
+    container.style.display = 'block';
+    await loadWebhookDeliveries(subscriptionId);
+}
+
+async function loadWebhookDeliveries(subscriptionId) {
+    const container = document.getElementById(`deliveries-${subscriptionId}`);
+    try {
+        const response = await fetch(`${API_BASE}/webhook-subscriptions/${subscriptionId}/deliveries`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load deliveries');
+        
+        const deliveries = await response.json();
+        if (deliveries.length === 0) {
+            container.innerHTML = '<div class="empty-state">No deliveries yet</div>';
+            return;
+        }
+        
+        container.innerHTML = deliveries.map(delivery => `
+            <div class="share-details">
+                <div>
+                    <strong>${escapeHtml(delivery.event_type)}</strong>
+                    <span class="badge ${delivery.status === 'failed' ? 'badge-inactive' : 'badge-active'}">${escapeHtml(delivery.status)}</span>
+                    ${new Date(delivery.created_at).toLocaleString()}
+                    ${delivery.status === 'failed' ? `<button class="btn btn-secondary" onclick="retryWebhookDelivery('${delivery.id}', '${subscriptionId}')">Retry</button>` : ''}
                 </div>
+                <div>Attempts: ${delivery.attempts}${delivery.response_status ? `, last response: HTTP ${delivery.response_status}` : ''}</div>
+                ${delivery.last_error ? `<div>Error: ${escapeHtml(delivery.last_error)}</div>` : ''}
+                ${delivery.status === 'pending' && delivery.attempts > 0 ? `<div>Next attempt: ${new Date(delivery.next_attempt_at).toLocaleString()}</div>` : ''}
             </div>
         `).join('');
+    } catch (error) {
+        console.error('Error loading webhook deliveries:', error);
+        container.innerHTML = '<div class="empty-state">Failed to load deliveries</div>';
+    }
+}
+
+async function retryWebhookDelivery(deliveryId, subscriptionId) {
+    try {
+        const response = await fetch(`${API_BASE}/webhook-deliveries/${deliveryId}/retry`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
         
-        return `
-            <div class="shared-group">
-                <h3 class="shared-owner">📤 Shared from: ${escapeHtml(ownerName)}</h3>
-                ${entitiesHtml}
-            </div>
-        `;
-    }).join('');
-    
-    // Load entity states
-    sortedEntities.forEach(item => {
-        loadSharedEntityState(item.EntityID, item.AccessMode);
-    });
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to retry delivery');
+        }
+        
+        showSuccess('Delivery queued for retry');
+    } catch (error) {
+        console.error('Error retrying webhook delivery:', error);
+        showError('Failed to retry delivery: ' + error.message);
+    }
+    await loadWebhookDeliveries(subscriptionId);
 }
 
 async function loadSharedEntityState(entityId, accessMode) {
@@ -1179,7 +3007,8 @@ async function loadSharedEntityState(entityId, accessMode) {
         });
         
         if (!response.ok) {
-            updateSharedEntityStateDisplay(entityId, null, 'Error loading state', accessMode);
+            const error = await response.json().catch(() => ({}));
+            updateSharedEntityStateDisplay(entityId, null, error.unavailable ? error.error : 'Error loading state', accessMode);
             return;
         }
         
@@ -1306,6 +3135,12 @@ async function triggerSharedEntityAction(entityId, service) {
             throw new Error(error.error || 'Failed to trigger entity');
         }
         
+        // Sensitive entities wait for the owner's approval
+        if (response.status === 202) {
+            showSuccess('Waiting for the owner to approve this action');
+            return;
+        }
+        
         showSuccess('Entity triggered successfully');
         
         // Refresh entity state after a short delay
@@ -1355,10 +3190,13 @@ async function renderMySharedEntities() {
     // Sort entities: first alphabetically by EntityID, then by AccessMode
     const sortedEntities = sortEntitiesByIdAndState(mySharedEntities, 'EntityID', 'AccessMode');
     
-    // Group by target user
+    // Group by target user or group
     const groupedByUser = {};
     sortedEntities.forEach(item => {
-        const targetName = item.SharedUser ? item.SharedUser.username : 'Unknown';
+        let targetName = item.SharedUser ? '👤 ' + item.SharedUser.username : '👤 Unknown';
+        if (item.Group) {
+            targetName = '👥 ' + item.Group.name;
+        }
         if (!groupedByUser[targetName]) {
             groupedByUser[targetName] = [];
         }
@@ -1370,12 +3208,15 @@ async function renderMySharedEntities() {
         const entitiesHtml = entities.map(item => `
             <div class="entity-item">
                 <div class="entity-info">
-                    <div class="entity-id">${escapeHtml(item.EntityID)}</div>
+                    <div class="entity-id">${escapeHtml(item.EntityID || describeSelector(item.Selector || {}))}</div>
                     <div class="entity-state">
                         <span class="badge badge-${item.AccessMode === 'triggerable' ? 'success' : 'info'}">
                             ${item.AccessMode === 'triggerable' ? '🎛️ Triggerable' : '👁️ Read-Only'}
                         </span>
                     </div>
+                    ${(item.Conditions || []).length > 0 ? `<div class="entity-state">Only while: ${escapeHtml(item.Conditions.map(formatCondition).join(', ').replace(/\n/g, ', '))}</div>` : ''}
+                    ${describeShareAccess(item)}
+                    ${describeShareStatus(item)}
                 </div>
                 <button class="btn btn-danger" onclick="unshareEntity(${item.id})">
                     Unshare
@@ -1385,7 +3226,7 @@ async function renderMySharedEntities() {
         
         return `
             <div class="shared-group">
-                <h3 class="shared-owner">👤 Shared with: ${escapeHtml(targetName)}</h3>
+                <h3 class="shared-owner">Shared with: ${escapeHtml(targetName)}</h3>
                 ${entitiesHtml}
             </div>
         `;
@@ -1417,6 +3258,243 @@ async function unshareEntity(sharedEntityId) {
     }
 }
 
+// Groups functionality
+async function loadGroups() {
+    try {
+        const response = await fetch(`${API_BASE}/groups`, {
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) throw new Error('Failed to load groups');
+        
+        groups = await response.json();
+        populateUserDropdown(allUsers);
+        renderGroups();
+    } catch (error) {
+        console.error('Error loading groups:', error);
+    }
+}
+
+function renderGroups() {
+    const container = document.getElementById('groupsList');
+    if (!container) return;
+    document.getElementById('groupAdminManagedGroup').style.display = isAdmin ? 'block' : 'none';
+    
+    if (!groups || groups.length === 0) {
+        container.innerHTML = '<div class="empty-state">No groups yet</div>';
+        return;
+    }
+    
+    const currentUsername = localStorage.getItem('username');
+    container.innerHTML = groups.map(group => {
+        const members = group.members || [];
+        const memberIds = members.map(member => member.user_id);
+        const membersHtml = members.length === 0
+            ? '<span style="color: #999;">No members</span>'
+            : members.map(member => {
+                const isMe = member.user && member.user.username === currentUsername;
+                const removable = group.can_manage || isMe;
+                return `
+                    <span class="badge" style="margin-right: 5px;">
+                        ${escapeHtml(member.user ? member.user.username : 'Unknown')}
+                        ${removable ? `<a href="#" onclick="removeGroupMember(${group.id}, ${member.user_id}, ${isMe}); return false;" title="${isMe ? 'Leave group' : 'Remove member'}">✕</a>` : ''}
+                    </span>
+                `;
+            }).join('');
+        const candidates = allUsers.filter(user => !memberIds.includes(user.id));
+        return `
+            <div class="share-item">
+                <div class="share-header">
+                    <div>
+                        <strong>${escapeHtml(group.name)}</strong>
+                        ${group.admin_managed ? '<span class="badge">Admin-managed</span>' : ''}
+                    </div>
+                    ${group.can_manage ? `
+                        <div>
+                            <input type="text" id="groupRename-${group.id}" maxlength="80" value="${escapeHtml(group.name)}" style="width: auto;" />
+                            <button class="btn btn-secondary" onclick="renameGroup(${group.id})" style="margin-right: 5px;">Rename</button>
+                            <button class="btn btn-danger" onclick="deleteGroup(${group.id})">Delete</button>
+                        </div>
+                    ` : ''}
+                </div>
+                <div class="share-details">
+                    <div>Members: ${membersHtml}</div>
+                    ${group.can_manage && candidates.length > 0 ? `
+                        <div style="margin-top: 8px;">
+                            <select id="groupMemberSelect-${group.id}">
+                                ${candidates.map(user => `<option value="${user.id}">${escapeHtml(user.username)}</option>`).join('')}
+                            </select>
+                            <button class="btn btn-secondary" onclick="addGroupMember(${group.id})">Add Member</button>
+                        </div>
+                    ` : ''}
+                </div>
+            </div>
+        `;
+    }).join('');
+}
+
+async function createGroup() {
+    const name = document.getElementById('groupName').value.trim();
+    if (!name) {
+        showError('Please enter a group name');
+        return;
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE}/groups`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({
+                name: name,
+                admin_managed: isAdmin && document.getElementById('groupAdminManaged').checked
+            })
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to create group');
+        }
+        
+        showSuccess('Group created');
+        document.getElementById('groupName').value = '';
+        document.getElementById('groupAdminManaged').checked = false;
+    } catch (error) {
+        console.error('Error creating group:', error);
+        showError('Failed to create group: ' + error.message);
+    }
+    await loadGroups();
+}
+
+async function renameGroup(groupId) {
+    const name = document.getElementById(`groupRename-${groupId}`).value.trim();
+    if (!name) {
+        showError('Please enter a group name');
+        return;
+    }
+    
+    try {
+        const response = await fetch(`${API_BASE}/groups/${groupId}`, {
+            method: 'PUT',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ name: name })
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to rename group');
+        }
+        
+        showSuccess('Group renamed');
+    } catch (error) {
+        console.error('Error renaming group:', error);
+        showError('Failed to rename group: ' + error.message);
+    }
+    await loadGroups();
+}
+
+async function deleteGroup(groupId) {
+    const confirmed = await Dialog.confirm('Delete this group? Entities shared with it are unshared from all members.', 'Delete Group');
+    if (!confirmed) return;
+    
+    try {
+        const response = await fetch(`${API_BASE}/groups/${groupId}`, {
+            method: 'DELETE',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to delete group');
+        }
+        
+        showSuccess('Group deleted');
+    } catch (error) {
+        console.error('Error deleting group:', error);
+        showError('Failed to delete group: ' + error.message);
+    }
+    await loadGroups();
+    await loadMySharedEntities();
+}
+
+async function addGroupMember(groupId) {
+    const userId = document.getElementById(`groupMemberSelect-${groupId}`).value;
+    if (!userId) return;
+    
+    try {
+        const response = await fetch(`${API_BASE}/groups/${groupId}/members`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({ user_id: parseInt(userId) })
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to add member');
+        }
+        
+        showSuccess('Member added');
+    } catch (error) {
+        console.error('Error adding group member:', error);
+        showError('Failed to add member: ' + error.message);
+    }
+    await loadGroups();
+}
+
+async function removeGroupMember(groupId, userId, leaving) {
+    const confirmed = leaving
+        ? await Dialog.confirm('Leave this group? You lose access to the entities shared with it.', 'Leave Group')
+        : await Dialog.confirm('Remove this member from the group?', 'Remove Member');
+    if (!confirmed) return;
+    
+    try {
+        const response = await fetch(`${API_BASE}/groups/${groupId}/members/${userId}`, {
+            method: 'DELETE',
+            headers: getAuthHeaders()
+        });
+        
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+        
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to remove member');
+        }
+        
+        showSuccess(leaving ? 'You left the group' : 'Member removed');
+    } catch (error) {
+        console.error('Error removing group member:', error);
+        showError('Failed to remove member: ' + error.message);
+    }
+    await loadGroups();
+}
+
 // Settings functionality
 async function loadSettings() {
     try {
@@ -1437,6 +3515,11 @@ async function loadSettings() {
         if (data.ha_url) {
             document.getElementById('haUrl').value = data.ha_url;
         }
+        document.getElementById('notifyService').value = data.notify_service || '';
+        document.getElementById('mqttKeyStatus').innerHTML = data.mqtt_key_set
+            ? '<p>✅ An MQTT key is set</p>'
+            : '<p>No MQTT key yet; MQTT commands are refused</p>';
+        document.getElementById('mqttKeyRevoke').style.display = data.mqtt_key_set ? 'inline-block' : 'none';
 
         // Show status
         if (data.has_ha_config) {
@@ -1463,6 +3546,7 @@ async function loadSettings() {
     if (!settingsListenersSet) {
         const passwordForm = document.getElementById('passwordForm');
         const haConfigForm = document.getElementById('haConfigForm');
+        const notificationForm = document.getElementById('notificationForm');
         const otpEnableForm = document.getElementById('otpEnableForm');
         const otpDisableFormElement = document.getElementById('otpDisableFormElement');
         
@@ -1474,6 +3558,10 @@ async function loadSettings() {
             haConfigForm.addEventListener('submit', handleHAConfig);
         }
         
+        if (notificationForm) {
+            notificationForm.addEventListener('submit', handleNotificationSettings);
+        }
+        
         if (otpEnableForm) {
             otpEnableForm.addEventListener('submit', handleOTPEnable);
         }
@@ -1571,6 +3659,100 @@ async function handleHAConfig(e) {
     }
 }
 
+async function handleNotificationSettings(e) {
+    e.preventDefault();
+
+    try {
+        const response = await fetch(`${API_BASE}/settings/notifications`, {
+            method: 'POST',
+            headers: getAuthHeaders(),
+            body: JSON.stringify({
+                notify_service: document.getElementById('notifyService').value.trim()
+            })
+        });
+
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to save notification settings');
+        }
+
+        showSuccess('Notification settings saved successfully!');
+    } catch (error) {
+        console.error('Error saving notification settings:', error);
+        showError('Error: ' + error.message);
+    }
+}
+
+async function createMQTTKey() {
+    const confirmed = await Dialog.confirm('Generate a new MQTT key? Commands using the previous key are refused from now on.', 'MQTT Key');
+    if (!confirmed) return;
+
+    try {
+        const response = await fetch(`${API_BASE}/settings/mqtt-key`, {
+            method: 'POST',
+            headers: getAuthHeaders()
+        });
+
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+
+        const result = await response.json();
+        if (!response.ok) {
+            throw new Error(result.error || 'Failed to create MQTT key');
+        }
+
+        document.getElementById('mqttKeyResult').innerHTML = `
+            <div class="success-message" style="margin-top: 15px;">
+                <strong>MQTT Key:</strong><br>
+                <div style="background: #f5f5f5; padding: 10px; margin: 10px 0; font-family: monospace; word-break: break-all;">
+                    ${escapeHtml(result.key)}
+                </div>
+                <strong>⚠️ Save this key! It cannot be shown again.</strong>
+            </div>
+        `;
+        await loadSettings();
+    } catch (error) {
+        console.error('Error creating MQTT key:', error);
+        showError('Error: ' + error.message);
+    }
+}
+
+async function deleteMQTTKey() {
+    const confirmed = await Dialog.confirm('Revoke your MQTT key? MQTT commands are refused until you generate a new one.', 'MQTT Key');
+    if (!confirmed) return;
+
+    try {
+        const response = await fetch(`${API_BASE}/settings/mqtt-key`, {
+            method: 'DELETE',
+            headers: getAuthHeaders()
+        });
+
+        if (response.status === 401) {
+            logout();
+            return;
+        }
+
+        if (!response.ok) {
+            const error = await response.json();
+            throw new Error(error.error || 'Failed to revoke MQTT key');
+        }
+
+        document.getElementById('mqttKeyResult').innerHTML = '';
+        showSuccess('MQTT key revoked');
+        await loadSettings();
+    } catch (error) {
+        console.error('Error revoking MQTT key:', error);
+        showError('Error: ' + error.message);
+    }
+}
+
 // OTP Functions
 async function loadOTPStatus() {
     try {
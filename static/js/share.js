@@ -4,6 +4,13 @@ const API_BASE = '/api';
 // Get share ID from URL
 const shareId = window.location.pathname.split('/').pop();
 let accessMode = 'readonly';  // Will be set when data loads
+let geofence = null;  // Set when triggering requires the guest's location
+let accessRequestPoll = null;  // Polls the outcome of a pending access request
+let autoReverts = {};  // When triggered entities are switched back automatically, by entity ID
+
+// Viewer sessions and pending access requests are kept per share link
+const sessionKey = `hassh-share-session-${shareId}`;
+const accessRequestKey = `hassh-share-request-${shareId}`;
 
 // Initialize
 document.addEventListener('DOMContentLoaded', function() {
@@ -11,26 +18,57 @@ document.addEventListener('DOMContentLoaded', function() {
     startAutoRefresh();
 });
 
+// Headers for share requests, including the viewer session granted by the owner's approval
+function getShareHeaders() {
+    const headers = { 'Content-Type': 'application/json' };
+    const session = localStorage.getItem(sessionKey);
+    if (session) {
+        headers['X-Share-Session'] = session;
+    }
+    return headers;
+}
+
 async function loadSharedEntities() {
+    if (accessRequestPoll) {
+        return; // Waiting for the owner's decision
+    }
+    
     try {
-        const response = await fetch(`${API_BASE}/shares/${shareId}`);
+        const response = await fetch(`${API_BASE}/shares/${shareId}`, {
+            headers: getShareHeaders()
+        });
         
         if (!response.ok) {
             const error = await response.json();
+            if (error.approval_required) {
+                localStorage.removeItem(sessionKey);
+                showAccessRequest(error.title);
+                return;
+            }
+            if (error.kiosk) {
+                window.location.href = `/kiosk/${encodeURIComponent(shareId)}`;
+                return;
+            }
+            if (error.unavailable) {
+                showUnavailable(error.reasons || [error.error]);
+                return;
+            }
             throw new Error(error.error || 'Failed to load shared entities');
         }
         
         const data = await response.json();
         accessMode = data.access_mode || 'readonly';
-        renderShareInfo(data.share, accessMode);
-        renderSharedEntities(data.entities, accessMode);
+        geofence = data.share.geofence && data.share.geofence.enabled ? data.share.geofence : null;
+        autoReverts = data.auto_revert || {};
+        renderShareInfo(data.share, accessMode, data.instructions_html);
+        renderSharedEntities(data.entities, data.share.entries || [], data.sections || []);
     } catch (error) {
         console.error('Error loading shared entities:', error);
         showError(error.message);
     }
 }
 
-function renderShareInfo(share, accessMode) {
+function renderShareInfo(share, accessMode, instructionsHtml) {
     const container = document.getElementById('shareInfo');
     
     let details = '';
@@ -69,19 +107,26 @@ function renderShareInfo(share, accessMode) {
         details = '<p>Permanent Share</p>';
     }
     
-    const accessModeLabel = accessMode === 'triggerable' ? '🎮 Triggerable' : '👁️ Read-Only';
+    let accessModeLabel = '👁️ Read-Only';
+    if (accessMode === 'triggerable') {
+        accessModeLabel = '🎮 Triggerable';
+    } else if (accessMode === 'mixed') {
+        accessModeLabel = '🎮 Partially Triggerable';
+    }
     
+    // instructions_html is rendered and sanitized by the server
     container.innerHTML = `
-        <h2>Shared Entities</h2>
+        <h2>${escapeHtml(share.title || 'Shared Entities')}</h2>
+        ${instructionsHtml ? `<div class="share-instructions">${instructionsHtml}</div>` : ''}
         <div style="margin-bottom: 20px; color: #666;">
             ${details}
-            <p>Sharing ${share.entity_ids.length} entities - ${accessModeLabel}</p>
+            <p>Sharing ${share.entries.length} entities - ${accessModeLabel}</p>
             ${progressBar}
         </div>
     `;
 }
 
-function renderSharedEntities(entities, accessMode) {
+function renderSharedEntities(entities, entries, sections) {
     const container = document.getElementById('sharedEntities');
     
     if (!entities || entities.length === 0) {
@@ -89,85 +134,112 @@ function renderSharedEntities(entities, accessMode) {
         return;
     }
     
-    // Sort entities: first alphabetically by entity_id, then by state
-    const sortedEntities = sortEntitiesByIdAndState(entities);
+    // Per-entity access rules and display options
+    const entryMap = {};
+    entries.forEach(entry => entryMap[entry.entity_id] = entry);
+    const entityMap = {};
+    entities.forEach(entity => entityMap[entity.entity_id] = entity);
     
-    container.innerHTML = sortedEntities.map(entity => {
-        const attributes = entity.attributes || {};
-        const attributesList = Object.entries(attributes)
-            .slice(0, 5) // Show only first 5 attributes
-            .map(([key, value]) => `<div>${escapeHtml(key)}: ${escapeHtml(String(value))}</div>`)
-            .join('');
-        
-        // Add control buttons for triggerable shares
-        let controlButtons = '';
-        if (accessMode === 'triggerable') {
-            const domain = entity.entity_id.split('.')[0];
-            const isOn = entity.state === 'on' || entity.state === 'open';
-            
-            if (domain === 'light' || domain === 'switch') {
-                controlButtons = `
-                    <div style="margin-top: 10px; display: flex; align-items: center; gap: 10px;">
-                        <span style="font-size: 13px; color: #666;">Control:</span>
-                        <label class="switch">
-                            <input type="checkbox" ${isOn ? 'checked' : ''} onchange="toggleEntity('${entity.entity_id}', this.checked)">
-                            <span class="slider round"></span>
-                        </label>
-                        <span style="font-size: 13px; color: #666;">${isOn ? 'On' : 'Off'}</span>
-                    </div>
-                `;
-            } else if (domain === 'cover') {
-                const isOpen = entity.state === 'open';
-                controlButtons = `
-                    <div style="margin-top: 10px; display: flex; align-items: center; gap: 10px;">
-                        <span style="font-size: 13px; color: #666;">Control:</span>
-                        <label class="switch">
-                            <input type="checkbox" ${isOpen ? 'checked' : ''} onchange="toggleCover('${entity.entity_id}', this.checked)">
-                            <span class="slider round"></span>
-                        </label>
-                        <span style="font-size: 13px; color: #666;">${isOpen ? 'Open' : 'Closed'}</span>
-                    </div>
-                `;
-            } else if (domain === 'scene' || domain === 'script') {
-                controlButtons = `
-                    <div style="margin-top: 10px;">
-                        <button class="btn btn-primary" onclick="triggerEntity('${entity.entity_id}', 'turn_on')" style="padding: 6px 12px; font-size: 12px;">Activate</button>
-                    </div>
-                `;
-            }
-        }
+    // Sections and their order come from the owner's configuration
+    if (sections.length === 0) {
+        sections = [{ name: '', entity_ids: sortEntitiesByIdAndState(entities).map(entity => entity.entity_id) }];
+    }
+    
+    container.innerHTML = sections.map(section => {
+        const sectionEntities = section.entity_ids.map(id => entityMap[id]).filter(entity => entity);
+        if (sectionEntities.length === 0) return '';
         
         return `
-            <div class="entity-item">
-                <div class="entity-info">
-                    <div class="entity-id">${escapeHtml(entity.entity_id)}</div>
-                    <div class="entity-state">
-                        <strong>State:</strong> ${escapeHtml(entity.state || 'unknown')}
-                    </div>
-                    ${attributesList ? `
-                        <div style="margin-top: 10px; font-size: 13px; color: #777;">
-                            <strong>Attributes:</strong>
-                            ${attributesList}
-                        </div>
-                    ` : ''}
-                    ${entity.last_updated ? `
-                        <div style="margin-top: 5px; font-size: 12px; color: #999;">
-                            Last updated: ${new Date(entity.last_updated).toLocaleString()}
-                        </div>
-                    ` : ''}
-                    ${controlButtons}
-                </div>
-            </div>
+            ${section.name ? `<h3 class="share-section-title">${escapeHtml(section.name)}</h3>` : ''}
+            ${sectionEntities.map(entity => renderSharedEntity(entity, entryMap[entity.entity_id] || {})).join('')}
         `;
     }).join('');
 }
 
+function renderSharedEntity(entity, entry) {
+    const display = entry.display || {};
+    const attributes = display.hide_attributes ? {} : (entity.attributes || {});
+    const attributesList = Object.entries(attributes)
+        .slice(0, 5) // Show only first 5 attributes
+        .map(([key, value]) => `<div>${escapeHtml(key)}: ${escapeHtml(String(value))}</div>`)
+        .join('');
+    
+    // Add control buttons for triggerable entities
+    let controlButtons = '';
+    if (entry.access_mode === 'triggerable') {
+        const domain = entity.entity_id.split('.')[0];
+        const isOn = entity.state === 'on' || entity.state === 'open';
+        
+        if (domain === 'light' || domain === 'switch') {
+            controlButtons = `
+                <div style="margin-top: 10px; display: flex; align-items: center; gap: 10px;">
+                    <span style="font-size: 13px; color: #666;">Control:</span>
+                    <label class="switch">
+                        <input type="checkbox" ${isOn ? 'checked' : ''} onchange="toggleEntity('${entity.entity_id}', this.checked)">
+                        <span class="slider round"></span>
+                    </label>
+                    <span style="font-size: 13px; color: #666;">${isOn ? 'On' : 'Off'}</span>
+                </div>
+            `;
+        } else if (domain === 'cover') {
+            const isOpen = entity.state === 'open';
+            controlButtons = `
+                <div style="margin-top: 10px; display: flex; align-items: center; gap: 10px;">
+                    <span style="font-size: 13px; color: #666;">Control:</span>
+                    <label class="switch">
+                        <input type="checkbox" ${isOpen ? 'checked' : ''} onchange="toggleCover('${entity.entity_id}', this.checked)">
+                        <span class="slider round"></span>
+                    </label>
+                    <span style="font-size: 13px; color: #666;">${isOpen ? 'Open' : 'Closed'}</span>
+                </div>
+            `;
+        } else if (domain === 'scene' || domain === 'script') {
+            controlButtons = `
+                <div style="margin-top: 10px;">
+                    <button class="btn btn-primary" onclick="triggerEntity('${entity.entity_id}', 'turn_on')" style="padding: 6px 12px; font-size: 12px;">Activate</button>
+                </div>
+            `;
+        }
+    }
+    
+    return `
+        <div class="entity-item">
+            <div class="entity-info">
+                <div class="entity-id">${display.icon ? escapeHtml(display.icon) + ' ' : ''}${escapeHtml(display.label || entity.entity_id)}</div>
+                <div class="entity-state">
+                    <strong>State:</strong> ${escapeHtml(entity.state || 'unknown')}
+                </div>
+                ${autoReverts[entity.entity_id] ? `
+                    <div style="margin-top: 6px; font-size: 13px; color: #666;">⏲️ Switches back automatically at ${formatTime(autoReverts[entity.entity_id])}</div>
+                ` : ''}
+                ${attributesList ? `
+                    <div style="margin-top: 10px; font-size: 13px; color: #777;">
+                        <strong>Attributes:</strong>
+                        ${attributesList}
+                    </div>
+                ` : ''}
+                ${entity.last_updated ? `
+                    <div style="margin-top: 5px; font-size: 12px; color: #999;">
+                        Last updated: ${new Date(entity.last_updated).toLocaleString()}
+                    </div>
+                ` : ''}
+                ${controlButtons}
+            </div>
+        </div>
+    `;
+}
+
 async function triggerEntity(entityId, service) {
     try {
+        const body = { service: service };
+        if (geofence) {
+            body.position = await getCurrentPosition();
+        }
+        
         const response = await fetch(`${API_BASE}/shares/${shareId}/trigger/${entityId}`, {
             method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ service: service })
+            headers: getShareHeaders(),
+            body: JSON.stringify(body)
         });
         
         if (!response.ok) {
@@ -175,6 +247,20 @@ async function triggerEntity(entityId, service) {
             throw new Error(error.error || 'Failed to trigger entity');
         }
         
+        // Sensitive entities wait for the owner's approval
+        if (response.status === 202) {
+            const data = await response.json();
+            Toast.info('Waiting for the owner to approve this action...');
+            waitForActionDecision(data.action_request.id);
+            return;
+        }
+        
+        // Tell the guest when the entity is switched back automatically
+        const data = await response.json();
+        if (data.auto_revert_at) {
+            Toast.info(`Done - it switches back automatically at ${formatTime(data.auto_revert_at)}`);
+        }
+        
         // Reload entities to show updated state
         setTimeout(() => loadSharedEntities(), 500);
     } catch (error) {
@@ -183,6 +269,25 @@ async function triggerEntity(entityId, service) {
     }
 }
 
+// Ask the browser for the guest's position (required by geofenced share links)
+function getCurrentPosition() {
+    return new Promise((resolve, reject) => {
+        if (!navigator.geolocation) {
+            reject(new Error('Your browser does not support location access'));
+            return;
+        }
+        navigator.geolocation.getCurrentPosition(
+            position => resolve({
+                latitude: position.coords.latitude,
+                longitude: position.coords.longitude,
+                accuracy: position.coords.accuracy
+            }),
+            () => reject(new Error('Location access is required to control this device')),
+            { enableHighAccuracy: true, timeout: 15000, maximumAge: 0 }
+        );
+    });
+}
+
 async function toggleEntity(entityId, isOn) {
     const service = isOn ? 'turn_on' : 'turn_off';
     await triggerEntity(entityId, service);
@@ -193,12 +298,166 @@ async function toggleCover(entityId, isOpen) {
     await triggerEntity(entityId, service);
 }
 
+// Explain why the owner's conditions currently keep the share closed; the auto-refresh reopens it
+function showUnavailable(reasons) {
+    document.getElementById('sharedEntities').innerHTML = '';
+    document.getElementById('shareInfo').innerHTML = `
+        <h2>Currently unavailable</h2>
+        <p style="margin-bottom: 10px; color: #666;">This share is only available while the owner's conditions hold:</p>
+        <ul style="margin-left: 20px; color: #666;">
+            ${reasons.map(reason => `<li>${escapeHtml(reason)}</li>`).join('')}
+        </ul>
+    `;
+}
+
+// Show the access request form (or the status of a pending request) for links requiring approval
+function showAccessRequest(title) {
+    const pendingRequest = localStorage.getItem(accessRequestKey);
+    if (pendingRequest) {
+        waitForAccessDecision(pendingRequest);
+        return;
+    }
+    
+    document.getElementById('sharedEntities').innerHTML = '';
+    document.getElementById('shareInfo').innerHTML = `
+        <h2>${escapeHtml(title || 'Shared Entities')}</h2>
+        <p style="margin-bottom: 20px; color: #666;">The owner needs to approve your visit before you can use this link.</p>
+        <form id="accessRequestForm">
+            <div class="form-group">
+                <label>Your Name:</label>
+                <input type="text" id="accessRequestName" maxlength="64" required />
+            </div>
+            <div class="form-group">
+                <label>Message (optional):</label>
+                <input type="text" id="accessRequestMessage" maxlength="280" placeholder="e.g. I'm at the front door" />
+            </div>
+            <button type="submit" class="btn btn-primary">Request Access</button>
+        </form>
+    `;
+    document.getElementById('accessRequestForm').addEventListener('submit', requestAccess);
+}
+
+async function requestAccess(e) {
+    e.preventDefault();
+    
+    try {
+        const response = await fetch(`${API_BASE}/shares/${shareId}/access-requests`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                name: document.getElementById('accessRequestName').value.trim(),
+                message: document.getElementById('accessRequestMessage').value.trim()
+            })
+        });
+        
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || 'Failed to request access');
+        }
+        
+        localStorage.setItem(accessRequestKey, data.id);
+        waitForAccessDecision(data.id);
+    } catch (error) {
+        console.error('Error requesting access:', error);
+        Toast.error(error.message);
+    }
+}
+
+// Poll the outcome of an access request until the owner decides or it expires
+function waitForAccessDecision(requestId) {
+    document.getElementById('sharedEntities').innerHTML = '';
+    document.getElementById('shareInfo').innerHTML = `
+        <h2>⏳ Waiting for approval</h2>
+        <p style="color: #666;">Your request was sent to the owner. This page updates automatically.</p>
+    `;
+    
+    const check = async () => {
+        try {
+            const response = await fetch(`${API_BASE}/shares/${shareId}/access-requests/${requestId}`);
+            const data = await response.json();
+            if (!response.ok) {
+                throw new Error(data.error || 'Failed to check access request');
+            }
+            if (data.status === 'pending') {
+                return;
+            }
+            
+            clearInterval(accessRequestPoll);
+            accessRequestPoll = null;
+            localStorage.removeItem(accessRequestKey);
+            
+            if (data.status === 'approved' && data.session_token) {
+                localStorage.setItem(sessionKey, data.session_token);
+                loadSharedEntities();
+            } else {
+                Toast.error(data.status === 'denied' ? 'The owner declined your request' : 'Your request expired');
+                showAccessRequest();
+            }
+        } catch (error) {
+            console.error('Error checking access request:', error);
+            clearInterval(accessRequestPoll);
+            accessRequestPoll = null;
+            localStorage.removeItem(accessRequestKey);
+            showAccessRequest();
+        }
+    };
+    
+    clearInterval(accessRequestPoll);
+    accessRequestPoll = setInterval(check, 3000);
+    check();
+}
+
+// Follow an action waiting for the owner's approval until it is decided
+function waitForActionDecision(requestId) {
+    const url = `${API_BASE}/shares/${shareId}/actions/${requestId}`;
+    const source = new EventSource(`${url}/stream`);
+    
+    const finish = (data) => {
+        source.close();
+        if (data.status === 'executed') {
+            Toast.success('The owner approved your action');
+            setTimeout(() => loadSharedEntities(), 500);
+        } else if (data.status === 'failed') {
+            Toast.error('Your action was approved but failed: ' + (data.error || 'unknown error'));
+        } else if (data.status === 'rejected') {
+            Toast.error('The owner rejected your action');
+        } else if (data.status === 'expired') {
+            Toast.error('Your action was not approved in time');
+        }
+    };
+    
+    source.addEventListener('status', (event) => {
+        const data = JSON.parse(event.data);
+        if (data.status !== 'pending' && data.status !== 'approved') {
+            finish(data);
+        }
+    });
+    
+    // Fall back to a single check when the stream is interrupted
+    source.onerror = async () => {
+        source.close();
+        try {
+            const response = await fetch(url);
+            const data = await response.json();
+            if (response.ok) {
+                finish(data);
+            }
+        } catch (error) {
+            console.error('Error checking action request:', error);
+        }
+    };
+}
+
 function startAutoRefresh() {
     setInterval(async () => {
         await loadSharedEntities();
     }, 30000); // Refresh every 30 seconds
 }
 
+function formatTime(timestamp) {
+    return new Date(timestamp).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+}
+
 function showError(message) {
     const container = document.querySelector('.main-content');
     container.innerHTML = `